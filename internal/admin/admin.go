@@ -0,0 +1,116 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Server - служебный HTTP сервер рядом с gRPC (см. комментарий в metrics.go: прометеус не умеет ходить в gRPC, ему нужен обычный http)
+//
+//	/metrics       - метрики prometheus
+//	/debug/pprof/  - профилировщик, наружу этот порт открывать нельзя, только внутри кластера
+//	/healthz       - процесс жив (liveness), всегда 200
+//	/readyz        - сервис готов принимать трафик (readiness), 503 если ready вернул ошибку
+type Server struct {
+	log  *slog.Logger
+	srv  *http.Server
+	addr string
+}
+
+// ReadyFunc сообщает, готов ли сервис, nil - готов
+type ReadyFunc func() error
+
+// DegradedFunc возвращает имена зависимостей, без которых сервис работает в деградированном режиме, выводится в /readyz
+type DegradedFunc func() []string
+
+// New создаёт admin сервер на addr (например ":2112"), ready и degraded могут быть nil
+func New(log *slog.Logger, addr string, ready ReadyFunc, degraded DegradedFunc) *Server {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &Server{
+		log:  log,
+		addr: addr,
+		srv: &http.Server{
+			Addr:              addr,
+			Handler:           Handler(ready, degraded),
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+}
+
+// Handler собирает роутер admin сервера, вынесен отдельно для тестов
+func Handler(ready ReadyFunc, degraded DegradedFunc) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/metrics", promhttp.Handler())
+
+	// pprof регистрируем явно в своём mux, а не через импорт net/http/pprof в DefaultServeMux
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if ready != nil {
+			if err := ready(); err != nil {
+				http.Error(w, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if degraded != nil {
+			if names := degraded(); len(names) > 0 {
+				_, _ = fmt.Fprintf(w, "ok, degraded: %s\n", strings.Join(names, ", "))
+				return
+			}
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	})
+
+	return mux
+}
+
+// Run слушает addr и блокируется до Shutdown
+func (s *Server) Run() error {
+	const op = "admin.Run"
+
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.log.Info("admin http server is running", slog.String("op", op), slog.String("addr", l.Addr().String()))
+
+	if err := s.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Shutdown дожидается текущих запросов (например идущего scrape метрик), но не дольше ctx
+func (s *Server) Shutdown(ctx context.Context) error {
+	const op = "admin.Shutdown"
+
+	if err := s.srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
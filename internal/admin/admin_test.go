@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	body, err := io.ReadAll(rec.Result().Body)
+	require.NoError(t, err)
+	return rec.Code, string(body)
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	var readyErr error
+	degraded := []string{}
+
+	h := Handler(func() error { return readyErr }, func() []string { return degraded })
+
+	code, _ := get(t, h, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, body := get(t, h, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok\n", body)
+
+	degraded = []string{"redis"}
+	code, body = get(t, h, "/readyz")
+	assert.Equal(t, http.StatusOK, code, "деградация не снимает сервис с балансировки")
+	assert.Contains(t, body, "redis")
+
+	readyErr = errors.New("postgres: connection refused")
+	code, body = get(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "postgres")
+
+	// liveness от зависимостей не зависит
+	code, _ = get(t, h, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, body = get(t, h, "/metrics")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "go_goroutines")
+
+	code, _ = get(t, h, "/debug/pprof/")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestHandler_NilReady(t *testing.T) {
+	t.Parallel()
+
+	code, _ := get(t, Handler(nil, nil), "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+}
@@ -1,32 +1,181 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net"
+	"sync"
+	"time"
 
+	"github.com/Derbik-Git/user-service/internal/admin"
+	"github.com/Derbik-Git/user-service/internal/audit"
+	"github.com/Derbik-Git/user-service/internal/auth"
+	"github.com/Derbik-Git/user-service/internal/gateway"
+	"github.com/Derbik-Git/user-service/internal/health"
+	"github.com/Derbik-Git/user-service/internal/idempotency"
 	"github.com/Derbik-Git/user-service/internal/metrics"
+	"github.com/Derbik-Git/user-service/internal/mtls"
+	"github.com/Derbik-Git/user-service/internal/ratelimit"
 	"github.com/Derbik-Git/user-service/internal/server"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"github.com/Derbik-Git/user-service/internal/watch"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 type App struct {
 	log        *slog.Logger
 	gRPCServer *grpc.Server
 	port       int
+
+	health     *health.Monitor    // может быть nil, тогда grpc.health.v1 не регистрируется
+	stopHealth context.CancelFunc // останавливает периодические проверки зависимостей и перечитывание сертификатов
+
+	admin *admin.Server // /metrics, pprof, /healthz, /readyz, nil если AdminPort = 0
+
+	gateway *gateway.Gateway // REST/JSON API, nil если HTTPPort = 0
+
+	watch *watch.Hub // подписки WatchUsers, nil - стрим не зарегистрирован
 }
 
-func NewApp(log *slog.Logger, userService server.UserService, port int) *App {
-	gRPCServer := grpc.NewServer(
-		grpc.UnaryInterceptor(metrics.UnaryInterceptor()), // зарегестрировали для нашего grpc, перехватчик для prometheus
-	)
+const (
+	// сколько Stop ждёт текущие запросы admin сервера (scrape метрик, pprof)
+	adminShutdownTimeout = 5 * time.Second
+	// сколько Stop ждёт текущие запросы HTTP шлюза
+	gatewayShutdownTimeout = 10 * time.Second
+)
+
+// Options - необязательные части приложения, нулевое значение поля = выключено
+type Options struct {
+	// Health регистрируется в том же gRPC сервере как grpc.health.v1, проверки зависимостей начинаются сразу, ещё до Run,
+	// поэтому к моменту, когда сервер начнёт принимать запросы, readiness уже отражает состояние зависимостей
+	Health *health.Monitor
+
+	AdminPort int // порт служебного HTTP сервера (/metrics, pprof, /healthz, /readyz)
+	HTTPPort  int // порт REST/JSON шлюза к тому же userService
 
-	server.RegisteGRPCrServer(gRPCServer, userService, log)
+	// Auth проверяет JWT и политику доступа для gRPC и HTTP шлюза, nil - все методы открыты
+	Auth *auth.Authenticator
+
+	// TLS включает TLS (и mTLS, если задан CA клиентов) для gRPC и HTTP шлюза, nil - plaintext
+	// сертификаты перечитываются с диска, пока приложение работает
+	TLS *mtls.Reloader
+
+	// RateLimit ограничивает запросы каждого клиента к gRPC и HTTP шлюзу, nil - без ограничений
+	RateLimit *ratelimit.Limiter
+
+	// Idempotency повторяет сохранённый ответ для ретраев CreateUser с тем же idempotency-key, nil - ключ игнорируется
+	Idempotency *idempotency.Interceptor
+
+	// Deadlines - дедлайны по умолчанию для gRPC и HTTP запросов, у которых клиент не задал свой
+	Deadlines server.Deadlines
+
+	// Audit - журнал изменений пользователей для GetUserAuditTrail (auditpb.UserAuditService), nil - сервис не регистрируется
+	Audit audit.TrailReader
+
+	// Watch - источник изменений для стримингового WatchUsers (watchpb.UserWatchService), nil - сервис не регистрируется
+	Watch *watch.Hub
+}
+
+func NewApp(log *slog.Logger, userService server.UserService, port int, opts Options) *App {
+	// recovery стоит дважды: внешний ловит панику в самих интерцепторах (логирование, авторизация, лимит, идемпотентность),
+	// иначе она уронит процесс, а внутренний (в конце цепочки) - панику в обработчике, что бы интерцепторы выше, в том числе метрики, увидели обычный Internal
+	interceptors := []grpc.UnaryServerInterceptor{
+		server.RecoveryInterceptor(log),
+		server.LoggingInterceptor(log), // первым после recovery, что бы request_id и логгер запроса были в контексте у всех следующих
+		server.DeadlineInterceptor(opts.Deadlines),
+	}
+	// стримам нужна та же цепочка в том же порядке, кроме идемпотентности (она только для CreateUser)
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		server.RecoveryStreamInterceptor(log),
+		server.LoggingStreamInterceptor(log),
+	}
+	// спан на каждый вызов (trace context берётся из метаданных клиента), health проверки в трассы не пишем: их много и они неинтересны
+	serverOpts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))),
+	}
+	if opts.TLS != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(opts.TLS.ServerConfig("h2"))))
+		interceptors = append(interceptors, mtls.UnaryInterceptor()) // личность из сертификата клиента нужна авторизации ниже
+		streamInterceptors = append(streamInterceptors, mtls.StreamInterceptor())
+	}
+	interceptors = append(interceptors, metrics.UnaryInterceptor()) // зарегестрировали для нашего grpc, перехватчик для prometheus
+	streamInterceptors = append(streamInterceptors, metrics.StreamInterceptor())
+
+	gwOpts := gateway.Options{Deadlines: opts.Deadlines}
+	if opts.Auth != nil {
+		interceptors = append(interceptors, opts.Auth.UnaryInterceptor()) // после метрик, что бы отказы в доступе тоже были видны в grpc_requests_total
+		streamInterceptors = append(streamInterceptors, opts.Auth.StreamInterceptor())
+		gwOpts.Authorizer = opts.Auth
+	}
+	if opts.RateLimit != nil {
+		interceptors = append(interceptors, opts.RateLimit.UnaryInterceptor()) // после авторизации: лимит считается по subject токена, а не по адресу
+		streamInterceptors = append(streamInterceptors, opts.RateLimit.StreamInterceptor())
+		gwOpts.RateLimiter = opts.RateLimit
+	}
+	if opts.Idempotency != nil {
+		// после авторизации (ключи клиентов не пересекаются) и лимита (повторы тоже считаются в лимит)
+		interceptors = append(interceptors, opts.Idempotency.UnaryInterceptor())
+	}
+	// последним, паника в обработчике становится обычной ошибкой Internal для всех интерцепторов выше (внешний recovery - в начале цепочки)
+	interceptors = append(interceptors, server.RecoveryInterceptor(log))
+	streamInterceptors = append(streamInterceptors, server.RecoveryStreamInterceptor(log))
+
+	serverOpts = append(serverOpts, grpc.ChainUnaryInterceptor(interceptors...), grpc.ChainStreamInterceptor(streamInterceptors...))
+	gRPCServer := grpc.NewServer(serverOpts...)
+
+	server.RegisterGRPCServer(gRPCServer, userService, log)
+	if opts.Watch != nil {
+		watch.Register(gRPCServer, opts.Watch, log)
+	}
+	if opts.Audit != nil {
+		audit.Register(gRPCServer, opts.Audit, log)
+	}
+
+	if opts.Health != nil {
+		opts.Health.Register(gRPCServer)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if opts.Health != nil {
+		go opts.Health.Run(ctx)
+	}
+	if opts.TLS != nil {
+		go opts.TLS.Run(ctx)
+	}
+
+	var adminSrv *admin.Server
+	if opts.AdminPort > 0 {
+		var (
+			ready    admin.ReadyFunc
+			degraded admin.DegradedFunc
+		)
+		if opts.Health != nil {
+			ready, degraded = opts.Health.Ready, opts.Health.Degraded
+		}
+		adminSrv = admin.New(log, fmt.Sprintf(":%d", opts.AdminPort), ready, degraded)
+	}
+
+	var gw *gateway.Gateway
+	if opts.HTTPPort > 0 {
+		if opts.TLS != nil {
+			gwOpts.TLSConfig = opts.TLS.ServerConfig("h2", "http/1.1")
+		}
+		gw = gateway.New(log, fmt.Sprintf(":%d", opts.HTTPPort), userService, gwOpts)
+	}
 
 	return &App{
 		log:        log,
 		gRPCServer: gRPCServer,
 		port:       port,
+		health:     opts.Health,
+		stopHealth: cancel,
+		admin:      adminSrv,
+		gateway:    gw,
+		watch:      opts.Watch,
 	}
 }
 
@@ -48,6 +197,24 @@ func (a *App) Run() error {
 
 	log.Info("grpc server is running", slog.String("addr", l.Addr().String()))
 
+	if a.admin != nil {
+		go func() {
+			// admin сервер не критичен для обслуживания запросов, поэтому его ошибка только логируется
+			if err := a.admin.Run(); err != nil {
+				log.Error("admin http server failed", sl.Err(err))
+			}
+		}()
+	}
+
+	if a.gateway != nil {
+		go func() {
+			// шлюз - второй вход в тот же сервис, его падение не должно останавливать gRPC
+			if err := a.gateway.Run(); err != nil {
+				log.Error("http gateway failed", sl.Err(err))
+			}
+		}()
+	}
+
 	if err := a.gRPCServer.Serve(l); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -60,5 +227,44 @@ func (a *App) Stop() {
 
 	a.log.With(slog.String("op", op)).Info("grpc server is stopped", slog.Int("port", a.port))
 
+	// сначала пробы readiness/liveness переходят в NOT_SERVING, что бы балансировщик перестал слать новые запросы,
+	// затем GracefulStop дожидается текущих
+	if a.health != nil {
+		a.health.Shutdown()
+	}
+	a.stopHealth()
+
+	// стримы WatchUsers сами не заканчиваются, без этого GracefulStop ждал бы их вечно
+	// клиенты получают Unavailable, буфер изменений пропадает вместе с процессом, поэтому last_event_id после рестарта
+	// уже не продолжить: клиент получит OUT_OF_RANGE, перечитает пользователей и подпишется заново (см. watch.Hub)
+	if a.watch != nil {
+		a.watch.Close()
+	}
+
+	// HTTP шлюз и gRPC дорабатывают текущие запросы параллельно, новые оба уже не принимают
+	var wg sync.WaitGroup
+	if a.gateway != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), gatewayShutdownTimeout)
+			defer cancel()
+			if err := a.gateway.Shutdown(ctx); err != nil {
+				a.log.Error("http gateway shutdown failed", slog.String("op", op), sl.Err(err))
+			}
+		}()
+	}
+
 	a.gRPCServer.GracefulStop()
+	wg.Wait()
+
+	// admin сервер останавливаем последним, что бы метрики можно было снять до самого конца
+	if a.admin != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+		defer cancel()
+		if err := a.admin.Shutdown(ctx); err != nil {
+			a.log.Error("admin http server shutdown failed", slog.String("op", op), sl.Err(err))
+		}
+	}
 }
@@ -1,28 +1,126 @@
 package appassembling
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"time"
 
+	userv1 "github.com/Derbik-Git/protos-tren-redis/user/v1"
 	"github.com/Derbik-Git/user-service/internal/app"
+	"github.com/Derbik-Git/user-service/internal/auth"
+	"github.com/Derbik-Git/user-service/internal/broker/kafka"
 	"github.com/Derbik-Git/user-service/internal/cache"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/health"
+	"github.com/Derbik-Git/user-service/internal/idempotency"
+	"github.com/Derbik-Git/user-service/internal/mtls"
+	"github.com/Derbik-Git/user-service/internal/ratelimit"
 	"github.com/Derbik-Git/user-service/internal/repository/postgres"
+	"github.com/Derbik-Git/user-service/internal/server"
 	"github.com/Derbik-Git/user-service/internal/service"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"github.com/Derbik-Git/user-service/internal/tracing"
+	"github.com/Derbik-Git/user-service/internal/watch"
 	"github.com/redis/go-redis/v9"
+	kafkago "github.com/segmentio/kafka-go"
 )
 
+const defaultShutdownTimeout = 30 * time.Second
+
 type App struct {
 	GRPCSrv *app.App
 }
 
-func NewAppMain(log *slog.Logger, grpcPort int, postgresDSN string, redisAddrs []string, cacheTTL time.Duration, opts *redis.ClusterOptions) (*App, func() error) {
+// Config - всё, что нужно для сборки приложения, заполняется в main.go из флагов
+type Config struct {
+	GRPCPort    int
+	AdminPort   int // служебный HTTP: /metrics, pprof, /healthz, /readyz, 0 - выключен
+	HTTPPort    int // REST/JSON шлюз (/v1/users), 0 - выключен
+	PostgresDSN string
+
+	ShutdownTimeout time.Duration // сколько cleanup ждёт дообработки текущих сообщений консьюмера
+
+	HealthInterval time.Duration // как часто проверяются зависимости для grpc.health.v1
+	HealthTimeout  time.Duration // таймаут одной проверки
+
+	RedisAddrs []string
+	RedisOpts  *redis.ClusterOptions
+	CacheTTL   time.Duration
+
+	KafkaBrokers     []string // если пусто, события в kafka не публикуются
+	KafkaEventMode   kafka.EventMode
+	KafkaEncoding    kafka.PayloadEncoding
+	KafkaGroupID     string // группа консьюмера для режима cache-sync
+	KafkaConcurrency int
+
+	KafkaHealthInterval time.Duration // консьюмер без успешного чтения дольше этого времени считается зависшим, 0 = проверка выключена
+
+	// настройки продюсера: по умолчанию строгая синхронная отправка (RequireAll, без сжатия),
+	// KafkaAsync = true включает high-throughput режим, где ошибки доставки видны только в логах и метриках
+	KafkaAsync        bool
+	KafkaCompression  kafkago.Compression
+	KafkaRequiredAcks kafkago.RequiredAcks
+	KafkaBatchSize    int
+	KafkaBatchTimeout time.Duration
+
+	// создать compacted топик domain.TopicUserState на старте, если его нет (удобно локально, в проде топик заводится заранее)
+	KafkaCreateStateTopic bool
+	KafkaStatePartitions  int
+	KafkaStateReplication int
+
+	// JWT авторизация: путь к локальному JWKS файлу с ключами HS256/RS256, пустой - авторизация выключена (только для локальной разработки)
+	AuthJWKSFile string
+	AuthIssuer   string // ожидаемый iss, пустой - не проверяется
+	AuthAudience string // ожидаемый aud, пустой - не проверяется
+	// скоупы для клиентов с сертификатом (mTLS) без токена: имя из сертификата -> скоупы
+	AuthCertScopes map[string][]string
+
+	// TLS для gRPC и HTTP шлюза, пустой TLSCertFile - plaintext
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSClientCA       string          // CA бандл для проверки сертификатов клиентов
+	TLSClientAuth     mtls.ClientAuth // пустое значение - require, если задан TLSClientCA, иначе none
+	TLSReloadInterval time.Duration   // как часто проверять, не обновились ли файлы сертификатов
+
+	// лимиты запросов на клиента (subject токена, сертификат или IP), пустой конфиг - без ограничений
+	RateLimit ratelimit.Config
+	// считать лимиты в redis (того же, что кеш), что бы они были общими для всех реплик, без redis - в памяти каждой реплики
+	RateLimitRedis bool
+
+	// сколько хранится ответ CreateUser по idempotency-key, 0 - ключи не поддерживаются
+	IdempotencyTTL time.Duration
+
+	// WatchUsers: сколько последних изменений хранится для переподключения с last_event_id
+	// и сколько изменений может ждать одного клиента, прежде чем его отключат как медленного, 0 - значения по умолчанию
+	WatchBufferSize       int
+	WatchSubscriberBuffer int
+
+	// дедлайны по умолчанию для запросов без дедлайна клиента и бюджеты обращений сервиса к redis, postgres и kafka
+	Deadlines server.Deadlines
+	Timeouts  service.Timeouts
+
+	// трассировка: куда отправляются спаны (otlp коллектор или stdout) и какая доля трасс записывается, нулевое значение - выключена
+	Tracing tracing.Config
+}
+
+// сколько cleanup ждёт отправки накопленных спанов в коллектор
+const tracingShutdownTimeout = 5 * time.Second
+
+func NewAppMain(log *slog.Logger, cfg Config) (*App, func() error) {
 	const op = "app_main.NewAppMain"
 
 	if log == nil {
 		log = slog.Default()
 	}
 
-	repo, err := postgres.NewStorage(postgresDSN)
+	// до создания клиентов: спаны postgres, redis и kafka пишутся в провайдер, установленный здесь
+	tracingShutdown, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		panic(err)
+	}
+
+	repo, err := postgres.NewStorage(cfg.PostgresDSN)
 	if err != nil {
 		panic(err)
 	}
@@ -33,8 +131,8 @@ func NewAppMain(log *slog.Logger, grpcPort int, postgresDSN string, redisAddrs [
 	)
 
 	// тут логика пропуска или работы с кешем, то есть если успешно удалось создать кеш(структуру cache.RedisCache под капотом), то мы присваиваем переменной cacheInterface объект redisCache, тем самым интерфейс связывается со структурой и мы можем дергать через этот интерфейс кеш, если не удалось создать кеш, то мы присваиваем переменной cacheInterface значение nil и программа продолжает работу без redis(кеша)
-	if len(redisAddrs) > 0 {
-		redisCache, err := cache.NewRedisCache(redisAddrs, cacheTTL, opts, log)
+	if len(cfg.RedisAddrs) > 0 {
+		redisCache, err := cache.NewRedisCache(cfg.RedisAddrs, cfg.CacheTTL, cfg.RedisOpts, log)
 		if err != nil {
 			log.Warn("redis disabled, service wil run without cache", slog.String("op", op), slog.String("err", err.Error()))
 		} else {
@@ -43,9 +141,126 @@ func NewAppMain(log *slog.Logger, grpcPort int, postgresDSN string, redisAddrs [
 		}
 	}
 
-	userService := service.NewUserService(repo, cacheInterface, log, cacheTTL) // тут передаём кеш интерейс в сервис, где и будет логика работы с редисом, соответственно если интерфейс не узнал о структуре, реализующей эти методы(логика чуть выше), кеша не будут включены в работу
+	// так же как с кешем: если брокеры не указаны, интерфейс остаётся nil и сервис работает без kafka
+	var (
+		broker        service.EventProducer
+		producerClose func() error
+	)
+	if len(cfg.KafkaBrokers) > 0 {
+		opts := []kafka.ProducerOption{
+			kafka.WithCloudEvents(cfg.KafkaEventMode, kafka.DefaultCloudEventsSource),
+			kafka.WithEncoding(cfg.KafkaEncoding),
+			kafka.WithCompression(cfg.KafkaCompression),
+			kafka.WithRequiredAcks(cfg.KafkaRequiredAcks),
+			kafka.WithBatch(cfg.KafkaBatchSize, cfg.KafkaBatchTimeout),
+		}
+		if cfg.KafkaAsync {
+			opts = append(opts, kafka.WithAsync(func(messages []kafkago.Message, err error) {
+				if err != nil {
+					log.Error("kafka async delivery failed", slog.String("op", op), slog.Int("messages", len(messages)), sl.Err(err))
+				}
+			}))
+		}
+
+		producer := kafka.NewProducer(cfg.KafkaBrokers, opts...)
+
+		if cfg.KafkaCreateStateTopic {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := kafka.EnsureStateTopic(ctx, cfg.KafkaBrokers, domain.TopicUserState, cfg.KafkaStatePartitions, cfg.KafkaStateReplication)
+			cancel()
+			if err != nil {
+				// без топика состояние просто не опубликуется, события в user-events при этом продолжат уходить
+				log.Warn("failed to create user state topic", slog.String("op", op), sl.Err(err))
+			}
+		}
+		broker = producer
+		producerClose = producer.Close
+	}
+
+	// WatchUsers получает те же события, что сервис публикует в kafka: Producer отдаёт их в watchHub и дальше в kafka (если она есть)
+	// watchHub видит только записи через эту реплику, поэтому WatchUsers рассчитан на запуск в одну реплику (см. watch.Hub)
+	watchHub := watch.NewHub(log, cfg.WatchBufferSize, cfg.WatchSubscriberBuffer)
+	broker = watch.NewProducer(watchHub, broker)
+
+	userService := service.NewUserService(repo, cacheInterface, broker, log, cfg.CacheTTL) // тут передаём кеш интерейс в сервис, где и будет логика работы с редисом, соответственно если интерфейс не узнал о структуре, реализующей эти методы(логика чуть выше), кеша не будут включены в работу
+	userService.Timeouts = cfg.Timeouts
+
+	// критичен только postgres: без него сервис не может выполнять запросы
+	// redis и kafka - деградация: без redis просто нет кеша, без kafka запросы выполняются, а публикация событий best-effort (ошибка только логируется),
+	// снимать из-за неё реплики с балансировки значит отказать во всех запросах вместо потери части событий
+	deps := []health.Dependency{
+		{Name: "postgres", Check: repo.Ping, Critical: true},
+	}
+	if redisCache, ok := cacheInterface.(*cache.RedisCache); ok {
+		deps = append(deps, health.Dependency{Name: "redis", Check: redisCache.Ping, Critical: false})
+	}
+	if len(cfg.KafkaBrokers) > 0 {
+		brokers := cfg.KafkaBrokers
+		deps = append(deps, health.Dependency{Name: "kafka", Check: func(ctx context.Context) error {
+			return kafka.PingBrokers(ctx, brokers)
+		}, Critical: false})
+	}
+	healthMonitor := health.NewMonitor(log, cfg.HealthInterval, cfg.HealthTimeout, deps, userv1.UserService_ServiceDesc.ServiceName)
+
+	var authenticator *auth.Authenticator
+	if cfg.AuthJWKSFile != "" || len(cfg.AuthCertScopes) > 0 {
+		authenticator = &auth.Authenticator{Policy: auth.DefaultPolicy(), CertScopes: cfg.AuthCertScopes}
+		if cfg.AuthJWKSFile != "" {
+			keys, err := auth.LoadJWKS(cfg.AuthJWKSFile)
+			if err != nil {
+				panic(err) // без ключей сервис не должен подниматься открытым
+			}
+			authenticator.Verifier = &auth.Verifier{Keys: keys, Issuer: cfg.AuthIssuer, Audience: cfg.AuthAudience, Leeway: 30 * time.Second}
+		}
+	} else {
+		log.Warn("auth is disabled, any client can call any method", slog.String("op", op))
+	}
+
+	var tlsReloader *mtls.Reloader
+	if cfg.TLSCertFile != "" {
+		tlsReloader, err = mtls.NewReloader(log, cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCA, cfg.TLSClientAuth, cfg.TLSReloadInterval)
+		if err != nil {
+			panic(err)
+		}
+		log.Info("tls is enabled", slog.String("op", op), slog.String("client_auth", string(tlsReloader.ClientAuth)))
+	}
 
-	grpcApp := app.NewApp(log, userService, grpcPort) // ВОЗВРАЩАЕТ струтктуру, которую app_main.go должен заполнить, и передавть в свою структуру App с параметром экземляра структуры из app.go, тем амым app.go передаёт струткуру, которую нужнозаполнить, что бы он работал, мы заполняем с данными из конфига в main.go, и передаём обратно в app.go через структуру в app_main.go
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled() {
+		var shared ratelimit.Store
+		if cfg.RateLimitRedis {
+			if redisCache, ok := cacheInterface.(*cache.RedisCache); ok {
+				shared = ratelimit.NewRedis(redisCache.Client())
+			} else {
+				log.Warn("redis is not available, rate limits are per replica", slog.String("op", op))
+			}
+		}
+		limiter = ratelimit.New(log, cfg.RateLimit, shared)
+	}
+
+	var idempotent *idempotency.Interceptor
+	if cfg.IdempotencyTTL > 0 {
+		// ключи хранятся в redis, postgres (таблица idempotency_keys) - на время, пока redis недоступен
+		var store idempotency.Store = postgres.NewIdempotencyStore(repo)
+		if redisCache, ok := cacheInterface.(*cache.RedisCache); ok {
+			store = idempotency.NewFallback(log, idempotency.NewRedisStore(redisCache.Client()), store)
+		}
+		idempotent = idempotency.New(log, store, cfg.IdempotencyTTL)
+	}
+
+	grpcApp := app.NewApp(log, userService, cfg.GRPCPort, app.Options{
+		Health:    healthMonitor,
+		AdminPort: cfg.AdminPort,
+		HTTPPort:  cfg.HTTPPort,
+		Auth:      authenticator,
+		TLS:       tlsReloader,
+		RateLimit: limiter,
+
+		Idempotency: idempotent,
+		Deadlines:   cfg.Deadlines,
+		Audit:       repo, // журнал пишется в той же транзакции, что и изменения пользователей, поэтому живёт в postgres
+		Watch:       watchHub,
+	}) // ВОЗВРАЩАЕТ струтктуру, которую app_main.go должен заполнить, и передавть в свою структуру App с параметром экземляра структуры из app.go, тем амым app.go передаёт струткуру, которую нужнозаполнить, что бы он работал, мы заполняем с данными из конфига в main.go, и передаём обратно в app.go через структуру в app_main.go
 
 	application := &App{
 		GRPCSrv: grpcApp,
@@ -55,8 +270,14 @@ func NewAppMain(log *slog.Logger, grpcPort int, postgresDSN string, redisAddrs [
 	cleanup := func() error {
 		var err error
 
+		if producerClose != nil {
+			if e := producerClose(); e != nil {
+				err = e
+			}
+		}
+
 		if cacheClose != nil { // если cacheClose, не был создан, значит редиса просто нету и условие не выполняется
-			if e := cacheClose(); e != nil { //если redis был, мы его сразу после этого аккуратно закрывем по завершении задачи редисом, во избежании утечки соединений/памяти
+			if e := cacheClose(); e != nil && err == nil { //если redis был, мы его сразу после этого аккуратно закрывем по завершении задачи редисом, во избежании утечки соединений/памяти
 				err = e // если произошла ошибка закрытия redis, то сохраняем ее в err, что бы метод cleanup() мог её вернуть
 			}
 		}
@@ -65,6 +286,10 @@ func NewAppMain(log *slog.Logger, grpcPort int, postgresDSN string, redisAddrs [
 			err = e
 		}
 
+		if e := shutdownTracing(tracingShutdown); e != nil && err == nil { // последним, что бы в трассы попали спаны закрытия клиентов выше
+			err = e
+		}
+
 		return err
 	}
 
@@ -72,9 +297,76 @@ func NewAppMain(log *slog.Logger, grpcPort int, postgresDSN string, redisAddrs [
 
 }
 
+// NewCacheSyncMain собирает режим cache-sync: консьюмер user-events, который поддерживает redis в актуальном состоянии (см. kafka.NewCacheSyncHandler)
+// в этом режиме gRPC сервер и postgres не нужны, только redis и kafka
+// консьюмер запускается через Run, а cleanup останавливает его через Shutdown, не бросая обработку сообщений на середине
+func NewCacheSyncMain(log *slog.Logger, cfg Config) (*kafka.Consumer, func() error, error) {
+	const op = "app_main.NewCacheSyncMain"
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	if len(cfg.KafkaBrokers) == 0 {
+		return nil, nil, fmt.Errorf("%s: kafka brokers are required", op)
+	}
+
+	tracingShutdown, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	redisCache, err := cache.NewRedisCache(cfg.RedisAddrs, cfg.CacheTTL, cfg.RedisOpts, log)
+	if err != nil {
+		_ = shutdownTracing(tracingShutdown)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	consumer := kafka.NewConsumer(cfg.KafkaBrokers, domain.TopicUserEvents, cfg.KafkaGroupID, log, nil,
+		kafka.WithMessageHandler(kafka.NewCacheSyncHandler(redisCache, cfg.CacheTTL, log)),
+		kafka.WithConcurrency(cfg.KafkaConcurrency),
+		kafka.WithHealthInterval(cfg.KafkaHealthInterval),
+	)
+
+	// сначала консьюмер дообрабатывает прочитанные сообщения (кеш ещё открыт) и коммитит их, только потом закрывается redis
+	cleanup := func() error {
+		var err error
+
+		timeout := cfg.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = defaultShutdownTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if e := consumer.Shutdown(ctx); e != nil {
+			err = e
+		}
+
+		if e := redisCache.Close(); e != nil && err == nil {
+			err = e
+		}
+
+		if e := shutdownTracing(tracingShutdown); e != nil && err == nil {
+			err = e
+		}
+
+		return err
+	}
+
+	return consumer, cleanup, nil
+}
+
+// shutdownTracing дописывает накопленные спаны, недоступный коллектор не задерживает остановку дольше tracingShutdownTimeout
+func shutdownTracing(shutdown func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	return shutdown(ctx)
+}
+
 // использовать в main:
 /*
-app, cleanup := app.NewAppMain(...)
+app, cleanup := app.NewAppMain(log, cfg)
 
 defer func() {
  if err := cleanup(); err != nil {
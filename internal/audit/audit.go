@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/auth"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/mtls"
+	"google.golang.org/grpc/peer"
+)
+
+// операции в журнале
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Entry - запись журнала изменений пользователя (таблица user_audit)
+// Журнал только дописывается: запись пишется в той же транзакции, что и само изменение, поэтому изменения без записи не бывает,
+// а менять и удалять записи запрещает триггер в базе
+type Entry struct {
+	ID        int64
+	UserID    int64
+	Operation string
+	Actor     string
+	RequestID string
+	Before    json.RawMessage // nil - пользователя до операции не было (create)
+	After     json.RawMessage // nil - после операции пользователя нет (delete)
+	CreatedAt time.Time
+}
+
+// snapshot - пользователь в журнале, формат не зависит от domain.User, что бы старые записи читались так же после изменений в коде
+type snapshot struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Snapshot - состояние пользователя для Before/After, nil - пользователя нет
+func Snapshot(u *domain.User) json.RawMessage {
+	if u == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(snapshot{ID: u.ID, Email: u.Email, Name: u.Name, CreatedAt: u.CreatedAt, UpdatedAt: u.UpdatedAt})
+	if err != nil { // у snapshot только строки, числа и время, Marshal не ошибается
+		return nil
+	}
+	return b
+}
+
+// Actor - кто делает запрос: subject токена, имя из клиентского сертификата, адрес клиента gRPC или anonymous,
+// если запрос пришёл не от клиента (фоновая задача, тест)
+func Actor(ctx context.Context) string {
+	if p, ok := auth.PrincipalFromContext(ctx); ok && p.Subject != "" {
+		return "sub:" + p.Subject
+	}
+	if id, ok := mtls.IdentityFromContext(ctx); ok {
+		return "cert:" + id.Name()
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return "ip:" + host
+	}
+	return "anonymous"
+}
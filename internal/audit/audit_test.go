@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/audit/auditpb"
+	"github.com/Derbik-Git/user-service/internal/auth"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/mtls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// memoryTrail - журнал в памяти с той же семантикой, что postgres.Storage.UserAuditTrail
+type memoryTrail struct {
+	entries []Entry // по возрастанию id
+	err     error
+}
+
+func (m *memoryTrail) UserAuditTrail(_ context.Context, userID, beforeID int64, limit int) ([]Entry, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	var res []Entry
+	for i := len(m.entries) - 1; i >= 0 && len(res) < limit; i-- {
+		e := m.entries[i]
+		if e.UserID == userID && (beforeID == 0 || e.ID < beforeID) {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func TestServer_GetUserAuditTrail(t *testing.T) {
+	t.Parallel()
+
+	trail := &memoryTrail{}
+	for i := range 5 {
+		trail.entries = append(trail.entries,
+			Entry{ID: int64(2*i + 1), UserID: 1, Operation: OpUpdate, Actor: "sub:42", After: json.RawMessage(`{"id":1}`), CreatedAt: time.Now()},
+			Entry{ID: int64(2*i + 2), UserID: 2, Operation: OpUpdate},
+		)
+	}
+	s := &Server{reader: trail}
+	ctx := context.Background()
+
+	var (
+		ids   []int64
+		token string
+	)
+	for range 3 {
+		resp, err := s.GetUserAuditTrail(ctx, &auditpb.GetUserAuditTrailRequest{UserId: 1, PageSize: 2, PageToken: token})
+		require.NoError(t, err)
+		for _, e := range resp.GetEntries() {
+			ids = append(ids, e.GetId())
+			assert.Equal(t, "sub:42", e.GetActor())
+			assert.Equal(t, `{"id":1}`, e.GetAfterJson())
+			assert.Empty(t, e.GetBeforeJson())
+		}
+		token = resp.GetNextPageToken()
+	}
+	assert.Equal(t, []int64{9, 7, 5, 3, 1}, ids, "от новых к старым, без пропусков и повторов между страницами")
+	assert.Empty(t, token, "последняя страница")
+
+	_, err := s.GetUserAuditTrail(ctx, &auditpb.GetUserAuditTrailRequest{UserId: 1, PageToken: "garbage!"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.GetUserAuditTrail(ctx, &auditpb.GetUserAuditTrailRequest{UserId: 0})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	trail.err = errors.New("db is down")
+	_, err = s.GetUserAuditTrail(ctx, &auditpb.GetUserAuditTrailRequest{UserId: 1})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestActor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	assert.Equal(t, "anonymous", Actor(ctx))
+
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 51000}})
+	assert.Equal(t, "ip:10.0.0.7", Actor(ctx))
+
+	ctx = mtls.WithIdentity(ctx, mtls.Identity{CommonName: "billing"})
+	assert.Equal(t, "cert:billing", Actor(ctx))
+
+	ctx = auth.WithPrincipal(ctx, auth.Principal{Subject: "42"})
+	assert.Equal(t, "sub:42", Actor(ctx), "токен важнее сертификата, как в ratelimit.ClientKey")
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, Snapshot(nil))
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	b := Snapshot(&domain.User{ID: 1, Email: "a@b.c", Name: "alice", CreatedAt: created, UpdatedAt: created})
+	assert.JSONEq(t, `{"id":1,"email":"a@b.c","name":"alice","created_at":"2024-01-02T03:04:05Z","updated_at":"2024-01-02T03:04:05Z"}`, string(b))
+}
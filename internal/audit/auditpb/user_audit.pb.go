@@ -0,0 +1,326 @@
+// Схема gRPC сервиса журнала изменений пользователей.
+// UserService описан во внешнем модуле protos-tren-redis, поэтому чтение журнала живёт в отдельном сервисе того же gRPC сервера.
+//
+// Go код в этой папке сгенерирован из этого файла через protoc-gen-go и protoc-gen-go-grpc:
+//   protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative internal/audit/auditpb/user_audit.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: internal/audit/auditpb/user_audit.proto
+
+package auditpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetUserAuditTrailRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        int64                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	PageSize      int32                  `protobuf:"varint,2,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`   // 0 - 50, больше 500 не отдаётся
+	PageToken     string                 `protobuf:"bytes,3,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"` // next_page_token из предыдущего ответа, пустой - первая страница
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetUserAuditTrailRequest) Reset() {
+	*x = GetUserAuditTrailRequest{}
+	mi := &file_internal_audit_auditpb_user_audit_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetUserAuditTrailRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetUserAuditTrailRequest) ProtoMessage() {}
+
+func (x *GetUserAuditTrailRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_audit_auditpb_user_audit_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetUserAuditTrailRequest.ProtoReflect.Descriptor instead.
+func (*GetUserAuditTrailRequest) Descriptor() ([]byte, []int) {
+	return file_internal_audit_auditpb_user_audit_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetUserAuditTrailRequest) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *GetUserAuditTrailRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *GetUserAuditTrailRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+type AuditEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	UserId        int64                  `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Operation     string                 `protobuf:"bytes,3,opt,name=operation,proto3" json:"operation,omitempty"` // create | update | delete
+	Actor         string                 `protobuf:"bytes,4,opt,name=actor,proto3" json:"actor,omitempty"`         // sub:<subject токена> | cert:<имя из сертификата> | ip:<адрес> | anonymous
+	RequestId     string                 `protobuf:"bytes,5,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	BeforeJson    string                 `protobuf:"bytes,6,opt,name=before_json,json=beforeJson,proto3" json:"before_json,omitempty"` // пользователь до изменения, пустой для create
+	AfterJson     string                 `protobuf:"bytes,7,opt,name=after_json,json=afterJson,proto3" json:"after_json,omitempty"`    // пользователь после изменения, пустой для delete
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuditEntry) Reset() {
+	*x = AuditEntry{}
+	mi := &file_internal_audit_auditpb_user_audit_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditEntry) ProtoMessage() {}
+
+func (x *AuditEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_audit_auditpb_user_audit_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditEntry.ProtoReflect.Descriptor instead.
+func (*AuditEntry) Descriptor() ([]byte, []int) {
+	return file_internal_audit_auditpb_user_audit_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AuditEntry) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *AuditEntry) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *AuditEntry) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetBeforeJson() string {
+	if x != nil {
+		return x.BeforeJson
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetAfterJson() string {
+	if x != nil {
+		return x.AfterJson
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+type GetUserAuditTrailResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*AuditEntry          `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	NextPageToken string                 `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"` // пустой - это последняя страница
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetUserAuditTrailResponse) Reset() {
+	*x = GetUserAuditTrailResponse{}
+	mi := &file_internal_audit_auditpb_user_audit_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetUserAuditTrailResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetUserAuditTrailResponse) ProtoMessage() {}
+
+func (x *GetUserAuditTrailResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_audit_auditpb_user_audit_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetUserAuditTrailResponse.ProtoReflect.Descriptor instead.
+func (*GetUserAuditTrailResponse) Descriptor() ([]byte, []int) {
+	return file_internal_audit_auditpb_user_audit_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetUserAuditTrailResponse) GetEntries() []*AuditEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *GetUserAuditTrailResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+var File_internal_audit_auditpb_user_audit_proto protoreflect.FileDescriptor
+
+const file_internal_audit_auditpb_user_audit_proto_rawDesc = "" +
+	"\n" +
+	"'internal/audit/auditpb/user_audit.proto\x12\ruser.audit.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"o\n" +
+	"\x18GetUserAuditTrailRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\x03R\x06userId\x12\x1b\n" +
+	"\tpage_size\x18\x02 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x03 \x01(\tR\tpageToken\"\x83\x02\n" +
+	"\n" +
+	"AuditEntry\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\x03R\x06userId\x12\x1c\n" +
+	"\toperation\x18\x03 \x01(\tR\toperation\x12\x14\n" +
+	"\x05actor\x18\x04 \x01(\tR\x05actor\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x05 \x01(\tR\trequestId\x12\x1f\n" +
+	"\vbefore_json\x18\x06 \x01(\tR\n" +
+	"beforeJson\x12\x1d\n" +
+	"\n" +
+	"after_json\x18\a \x01(\tR\tafterJson\x129\n" +
+	"\n" +
+	"created_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\"x\n" +
+	"\x19GetUserAuditTrailResponse\x123\n" +
+	"\aentries\x18\x01 \x03(\v2\x19.user.audit.v1.AuditEntryR\aentries\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken2z\n" +
+	"\x10UserAuditService\x12f\n" +
+	"\x11GetUserAuditTrail\x12'.user.audit.v1.GetUserAuditTrailRequest\x1a(.user.audit.v1.GetUserAuditTrailResponseBCZAgithub.com/Derbik-Git/user-service/internal/audit/auditpb;auditpbb\x06proto3"
+
+var (
+	file_internal_audit_auditpb_user_audit_proto_rawDescOnce sync.Once
+	file_internal_audit_auditpb_user_audit_proto_rawDescData []byte
+)
+
+func file_internal_audit_auditpb_user_audit_proto_rawDescGZIP() []byte {
+	file_internal_audit_auditpb_user_audit_proto_rawDescOnce.Do(func() {
+		file_internal_audit_auditpb_user_audit_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_internal_audit_auditpb_user_audit_proto_rawDesc), len(file_internal_audit_auditpb_user_audit_proto_rawDesc)))
+	})
+	return file_internal_audit_auditpb_user_audit_proto_rawDescData
+}
+
+var file_internal_audit_auditpb_user_audit_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_internal_audit_auditpb_user_audit_proto_goTypes = []any{
+	(*GetUserAuditTrailRequest)(nil),  // 0: user.audit.v1.GetUserAuditTrailRequest
+	(*AuditEntry)(nil),                // 1: user.audit.v1.AuditEntry
+	(*GetUserAuditTrailResponse)(nil), // 2: user.audit.v1.GetUserAuditTrailResponse
+	(*timestamppb.Timestamp)(nil),     // 3: google.protobuf.Timestamp
+}
+var file_internal_audit_auditpb_user_audit_proto_depIdxs = []int32{
+	3, // 0: user.audit.v1.AuditEntry.created_at:type_name -> google.protobuf.Timestamp
+	1, // 1: user.audit.v1.GetUserAuditTrailResponse.entries:type_name -> user.audit.v1.AuditEntry
+	0, // 2: user.audit.v1.UserAuditService.GetUserAuditTrail:input_type -> user.audit.v1.GetUserAuditTrailRequest
+	2, // 3: user.audit.v1.UserAuditService.GetUserAuditTrail:output_type -> user.audit.v1.GetUserAuditTrailResponse
+	3, // [3:4] is the sub-list for method output_type
+	2, // [2:3] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_internal_audit_auditpb_user_audit_proto_init() }
+func file_internal_audit_auditpb_user_audit_proto_init() {
+	if File_internal_audit_auditpb_user_audit_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_audit_auditpb_user_audit_proto_rawDesc), len(file_internal_audit_auditpb_user_audit_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_internal_audit_auditpb_user_audit_proto_goTypes,
+		DependencyIndexes: file_internal_audit_auditpb_user_audit_proto_depIdxs,
+		MessageInfos:      file_internal_audit_auditpb_user_audit_proto_msgTypes,
+	}.Build()
+	File_internal_audit_auditpb_user_audit_proto = out.File
+	file_internal_audit_auditpb_user_audit_proto_goTypes = nil
+	file_internal_audit_auditpb_user_audit_proto_depIdxs = nil
+}
@@ -0,0 +1,131 @@
+// Схема gRPC сервиса журнала изменений пользователей.
+// UserService описан во внешнем модуле protos-tren-redis, поэтому чтение журнала живёт в отдельном сервисе того же gRPC сервера.
+//
+// Go код в этой папке сгенерирован из этого файла через protoc-gen-go и protoc-gen-go-grpc:
+//   protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative internal/audit/auditpb/user_audit.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: internal/audit/auditpb/user_audit.proto
+
+package auditpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	UserAuditService_GetUserAuditTrail_FullMethodName = "/user.audit.v1.UserAuditService/GetUserAuditTrail"
+)
+
+// UserAuditServiceClient is the client API for UserAuditService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type UserAuditServiceClient interface {
+	// GetUserAuditTrail возвращает изменения пользователя от новых к старым, постранично.
+	// Журнал хранится и после удаления пользователя.
+	GetUserAuditTrail(ctx context.Context, in *GetUserAuditTrailRequest, opts ...grpc.CallOption) (*GetUserAuditTrailResponse, error)
+}
+
+type userAuditServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUserAuditServiceClient(cc grpc.ClientConnInterface) UserAuditServiceClient {
+	return &userAuditServiceClient{cc}
+}
+
+func (c *userAuditServiceClient) GetUserAuditTrail(ctx context.Context, in *GetUserAuditTrailRequest, opts ...grpc.CallOption) (*GetUserAuditTrailResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetUserAuditTrailResponse)
+	err := c.cc.Invoke(ctx, UserAuditService_GetUserAuditTrail_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UserAuditServiceServer is the server API for UserAuditService service.
+// All implementations must embed UnimplementedUserAuditServiceServer
+// for forward compatibility.
+type UserAuditServiceServer interface {
+	// GetUserAuditTrail возвращает изменения пользователя от новых к старым, постранично.
+	// Журнал хранится и после удаления пользователя.
+	GetUserAuditTrail(context.Context, *GetUserAuditTrailRequest) (*GetUserAuditTrailResponse, error)
+	mustEmbedUnimplementedUserAuditServiceServer()
+}
+
+// UnimplementedUserAuditServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedUserAuditServiceServer struct{}
+
+func (UnimplementedUserAuditServiceServer) GetUserAuditTrail(context.Context, *GetUserAuditTrailRequest) (*GetUserAuditTrailResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetUserAuditTrail not implemented")
+}
+func (UnimplementedUserAuditServiceServer) mustEmbedUnimplementedUserAuditServiceServer() {}
+func (UnimplementedUserAuditServiceServer) testEmbeddedByValue()                          {}
+
+// UnsafeUserAuditServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UserAuditServiceServer will
+// result in compilation errors.
+type UnsafeUserAuditServiceServer interface {
+	mustEmbedUnimplementedUserAuditServiceServer()
+}
+
+func RegisterUserAuditServiceServer(s grpc.ServiceRegistrar, srv UserAuditServiceServer) {
+	// If the following call panics, it indicates UnimplementedUserAuditServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&UserAuditService_ServiceDesc, srv)
+}
+
+func _UserAuditService_GetUserAuditTrail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserAuditTrailRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserAuditServiceServer).GetUserAuditTrail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserAuditService_GetUserAuditTrail_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserAuditServiceServer).GetUserAuditTrail(ctx, req.(*GetUserAuditTrailRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// UserAuditService_ServiceDesc is the grpc.ServiceDesc for UserAuditService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UserAuditService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "user.audit.v1.UserAuditService",
+	HandlerType: (*UserAuditServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetUserAuditTrail",
+			Handler:    _UserAuditService_GetUserAuditTrail_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/audit/auditpb/user_audit.proto",
+}
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"log/slog"
+	"strconv"
+
+	"github.com/Derbik-Git/user-service/internal/audit/auditpb"
+	errorsx "github.com/Derbik-Git/user-service/internal/errors"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// TrailReader - чтение журнала, реализует postgres.Storage
+type TrailReader interface {
+	// UserAuditTrail - до limit записей пользователя с id < beforeID от новых к старым, beforeID = 0 - с самой новой
+	UserAuditTrail(ctx context.Context, userID, beforeID int64, limit int) ([]Entry, error)
+}
+
+// Server - реализация auditpb.UserAuditServiceServer
+type Server struct {
+	auditpb.UnimplementedUserAuditServiceServer
+
+	log    *slog.Logger
+	reader TrailReader
+}
+
+func Register(gRPCServer *grpc.Server, reader TrailReader, log *slog.Logger) {
+	if log == nil {
+		log = slog.Default()
+	}
+	auditpb.RegisterUserAuditServiceServer(gRPCServer, &Server{log: log, reader: reader})
+}
+
+func (s *Server) GetUserAuditTrail(ctx context.Context, req *auditpb.GetUserAuditTrailRequest) (*auditpb.GetUserAuditTrailResponse, error) {
+	const op = "audit.Server.GetUserAuditTrail"
+
+	if req.GetUserId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id must be > 0")
+	}
+
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, status.Error(codes.InvalidArgument, "page_size must be >= 0")
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	beforeID, err := decodePageToken(req.GetPageToken())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+	}
+
+	// на одну запись больше страницы: так без отдельного COUNT понятно, есть ли следующая страница
+	entries, err := s.reader.UserAuditTrail(ctx, req.GetUserId(), beforeID, pageSize+1)
+	if err != nil {
+		sl.FromContext(ctx, s.log).Error("failed to read audit trail", slog.String("op", op), sl.Err(err))
+		return nil, errorsx.ToGRPC(err)
+	}
+
+	resp := &auditpb.GetUserAuditTrailResponse{}
+	if len(entries) > pageSize {
+		entries = entries[:pageSize]
+		resp.NextPageToken = encodePageToken(entries[len(entries)-1].ID)
+	}
+
+	resp.Entries = make([]*auditpb.AuditEntry, 0, len(entries))
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, toProto(e))
+	}
+	return resp, nil
+}
+
+// page_token - id последней записи страницы, для клиента это непрозрачная строка
+func encodePageToken(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodePageToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return id, nil
+}
+
+func toProto(e Entry) *auditpb.AuditEntry {
+	return &auditpb.AuditEntry{
+		Id:         e.ID,
+		UserId:     e.UserID,
+		Operation:  e.Operation,
+		Actor:      e.Actor,
+		RequestId:  e.RequestID,
+		BeforeJson: string(e.Before),
+		AfterJson:  string(e.After),
+		CreatedAt:  timestamppb.New(e.CreatedAt),
+	}
+}
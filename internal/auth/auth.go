@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Скоупы, которые проверяет DefaultPolicy
+const (
+	ScopeRead  = "users:read"
+	ScopeWrite = "users:write"
+	ScopeAudit = "users:audit" // чтение журнала изменений: кто и когда менял пользователей
+	ScopeAdmin = "users:admin" // включает все остальные
+)
+
+var (
+	ErrNoToken      = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Principal - кто делает запрос: subject из токена (для пользователей это их id) и выданные скоупы
+type Principal struct {
+	Subject string
+	Scopes  []string
+}
+
+// HasScope учитывает, что users:admin включает любой скоуп
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+type principalKey struct{}
+
+// WithPrincipal кладёт проверенного клиента в контекст
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext достаёт клиента, положенного интерцептором, ok = false - запрос не проходил аутентификацию
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// claims - поля токена, скоупы принимаются в двух распространённых форматах: строка "scope" через пробел (OAuth2) и массив "scp"
+type claims struct {
+	jwt.RegisteredClaims
+	Scope string   `json:"scope,omitempty"`
+	Scp   []string `json:"scp,omitempty"`
+}
+
+// Verifier проверяет подпись и стандартные поля JWT
+type Verifier struct {
+	Keys     *KeySet
+	Issuer   string        // пустое значение - iss не проверяется
+	Audience string        // пустое значение - aud не проверяется
+	Leeway   time.Duration // допустимое расхождение часов для exp/nbf
+}
+
+// Verify проверяет токен и возвращает клиента, любые проблемы с токеном оборачивают ErrInvalidToken
+func (v *Verifier) Verify(token string) (Principal, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256"}), // защита от alg=none и подмены алгоритма
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.Leeway),
+	}
+	if v.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.Issuer))
+	}
+	if v.Audience != "" {
+		opts = append(opts, jwt.WithAudience(v.Audience))
+	}
+
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, v.keyFunc, opts...)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if c.Subject == "" {
+		return Principal{}, fmt.Errorf("%w: sub is required", ErrInvalidToken)
+	}
+
+	scopes := append(strings.Fields(c.Scope), c.Scp...)
+	return Principal{Subject: c.Subject, Scopes: scopes}, nil
+}
+
+func (v *Verifier) keyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	key, err := v.Keys.Lookup(kid, t.Method.Alg())
+	if err != nil {
+		return nil, err
+	}
+	return key.Key, nil
+}
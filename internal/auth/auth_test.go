@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	userv1 "github.com/Derbik-Git/protos-tren-redis/user/v1"
+	"github.com/Derbik-Git/user-service/internal/mtls"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var hsSecret = []byte("0123456789abcdef0123456789abcdef")
+
+type testKeys struct {
+	rsa  *rsa.PrivateKey
+	path string // JWKS файл с hs-1 (HS256) и rs-1 (RS256)
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "oct", "kid": "hs-1", "alg": "HS256", "k": %q},
+		{"kty": "RSA", "kid": "rs-1", "alg": "RS256", "use": "sig", "n": %q, "e": %q},
+		{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": "AQAB", "e": "AQAB"}
+	]}`, b64(hsSecret), b64(priv.N.Bytes()), b64(big.NewInt(int64(priv.E)).Bytes()))
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, []byte(jwks), 0o600))
+
+	return testKeys{rsa: priv, path: path}
+}
+
+type tokenOpts struct {
+	kid    string
+	sub    string
+	scopes string
+	exp    time.Duration
+}
+
+func (k testKeys) hs(t *testing.T, o tokenOpts) string {
+	return k.sign(t, jwt.SigningMethodHS256, hsSecret, o)
+}
+
+func (k testKeys) rs(t *testing.T, o tokenOpts) string {
+	return k.sign(t, jwt.SigningMethodRS256, k.rsa, o)
+}
+
+func (k testKeys) sign(t *testing.T, m jwt.SigningMethod, key any, o tokenOpts) string {
+	t.Helper()
+
+	if o.exp == 0 {
+		o.exp = time.Hour
+	}
+	tok := jwt.NewWithClaims(m, jwt.MapClaims{
+		"sub":   o.sub,
+		"scope": o.scopes,
+		"iss":   "https://auth.example",
+		"aud":   "user-service",
+		"exp":   time.Now().Add(o.exp).Unix(),
+	})
+	if o.kid != "" {
+		tok.Header["kid"] = o.kid
+	}
+
+	s, err := tok.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func newVerifier(t *testing.T, k testKeys) *Verifier {
+	t.Helper()
+
+	ks, err := LoadJWKS(k.path)
+	require.NoError(t, err)
+	return &Verifier{Keys: ks, Issuer: "https://auth.example", Audience: "user-service"}
+}
+
+func TestVerifier(t *testing.T) {
+	t.Parallel()
+
+	k := newTestKeys(t)
+	v := newVerifier(t, k)
+
+	p, err := v.Verify(k.hs(t, tokenOpts{kid: "hs-1", sub: "42", scopes: "users:read users:write"}))
+	require.NoError(t, err)
+	assert.Equal(t, Principal{Subject: "42", Scopes: []string{ScopeRead, ScopeWrite}}, p)
+
+	p, err = v.Verify(k.rs(t, tokenOpts{kid: "rs-1", sub: "svc-billing", scopes: "users:admin"}))
+	require.NoError(t, err)
+	assert.Equal(t, "svc-billing", p.Subject)
+	assert.True(t, p.HasScope(ScopeRead), "admin включает остальные скоупы")
+
+	// без kid подходит единственный ключ нужного алгоритма
+	_, err = v.Verify(k.rs(t, tokenOpts{sub: "1"}))
+	require.NoError(t, err)
+
+	// массив scp вместо строки scope
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "7", "scp": []string{ScopeRead}, "iss": "https://auth.example", "aud": "user-service", "exp": time.Now().Add(time.Minute).Unix(),
+	})
+	s, err := tok.SignedString(hsSecret)
+	require.NoError(t, err)
+	p, err = v.Verify(s)
+	require.NoError(t, err)
+	assert.Equal(t, []string{ScopeRead}, p.Scopes)
+}
+
+func TestVerifier_Rejects(t *testing.T) {
+	t.Parallel()
+
+	k := newTestKeys(t)
+	v := newVerifier(t, k)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// HS256 токен, подписанный публичным ключом RSA как секретом - классическая подмена алгоритма
+	pubAsSecret := k.sign(t, jwt.SigningMethodHS256, k.rsa.N.Bytes(), tokenOpts{kid: "rs-1", sub: "1"})
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"sub": "1", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"expired":         k.hs(t, tokenOpts{kid: "hs-1", sub: "1", exp: -time.Hour}),
+		"unknown kid":     k.hs(t, tokenOpts{kid: "hs-2", sub: "1"}),
+		"foreign rsa key": k.sign(t, jwt.SigningMethodRS256, other, tokenOpts{kid: "rs-1", sub: "1"}),
+		"alg confusion":   pubAsSecret,
+		"alg none":        unsigned,
+		"no subject":      k.hs(t, tokenOpts{kid: "hs-1"}),
+		"garbage":         "not.a.jwt",
+	}
+
+	for name, token := range tests {
+		_, err := v.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+
+	wrongAud := &Verifier{Keys: v.Keys, Audience: "other-service"}
+	_, err = wrongAud.Verify(k.hs(t, tokenOpts{kid: "hs-1", sub: "1"}))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestParseJWKS_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"not json":     `{`,
+		"no keys":      `{"keys": []}`,
+		"short secret": `{"keys": [{"kty": "oct", "k": "c2hvcnQ"}]}`,
+		"unknown kty":  `{"keys": [{"kty": "EC", "kid": "ec"}]}`,
+		"wrong alg":    `{"keys": [{"kty": "RSA", "alg": "PS256", "n": "AQAB", "e": "AQAB"}]}`,
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	strong, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaKey := func(n *big.Int, e []byte) string {
+		return fmt.Sprintf(`{"keys": [{"kty": "RSA", "alg": "RS256", "n": %q, "e": %q}]}`, b64(n.Bytes()), b64(e))
+	}
+	tests["short rsa key"] = rsaKey(weak.N, []byte{1, 0, 1})
+	tests["exponent overflows int64"] = rsaKey(strong.N, []byte{0x80, 0, 0, 0, 0, 0, 0, 0, 1})
+	tests["exponent overflows int32"] = rsaKey(strong.N, []byte{1, 0, 0, 0, 1})
+	tests["even exponent"] = rsaKey(strong.N, []byte{2})
+
+	_, err = ParseJWKS([]byte(rsaKey(strong.N, []byte{1, 0, 1})))
+	require.NoError(t, err)
+
+	for name, doc := range tests {
+		_, err := ParseJWKS([]byte(doc))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestAuthenticator_Policy(t *testing.T) {
+	t.Parallel()
+
+	k := newTestKeys(t)
+	a := &Authenticator{Verifier: newVerifier(t, k), Policy: DefaultPolicy()}
+
+	reader := k.hs(t, tokenOpts{kid: "hs-1", sub: "svc-reader", scopes: ScopeRead})
+	writer := k.hs(t, tokenOpts{kid: "hs-1", sub: "svc-writer", scopes: ScopeWrite})
+	admin := k.rs(t, tokenOpts{kid: "rs-1", sub: "ops", scopes: ScopeAdmin})
+	user42 := k.hs(t, tokenOpts{kid: "hs-1", sub: "42"}) // обычный пользователь без скоупов
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		req    any
+		want   codes.Code
+	}{
+		{"no token", userv1.UserService_GetUser_FullMethodName, "", &userv1.GetUserRequest{Id: 1}, codes.Unauthenticated},
+		{"bad token", userv1.UserService_GetUser_FullMethodName, "xxx", &userv1.GetUserRequest{Id: 1}, codes.Unauthenticated},
+		{"reader gets", userv1.UserService_GetUser_FullMethodName, reader, &userv1.GetUserRequest{Id: 1}, codes.OK},
+		{"reader cannot create", userv1.UserService_CreateUser_FullMethodName, reader, &userv1.CreateUserRequest{}, codes.PermissionDenied},
+		{"writer creates", userv1.UserService_CreateUser_FullMethodName, writer, &userv1.CreateUserRequest{}, codes.OK},
+		{"writer cannot delete", userv1.UserService_DeleteUser_FullMethodName, writer, &userv1.DeleteUserRequest{Id: 1}, codes.PermissionDenied},
+		{"admin deletes", userv1.UserService_DeleteUser_FullMethodName, admin, &userv1.DeleteUserRequest{Id: 1}, codes.OK},
+		{"user updates self", userv1.UserService_UpdateUser_FullMethodName, user42, &userv1.UpdateUserRequest{Id: 42}, codes.OK},
+		{"user cannot update other", userv1.UserService_UpdateUser_FullMethodName, user42, &userv1.UpdateUserRequest{Id: 43}, codes.PermissionDenied},
+		{"user cannot delete self", userv1.UserService_DeleteUser_FullMethodName, user42, &userv1.DeleteUserRequest{Id: 42}, codes.PermissionDenied},
+		{"health is public", "/grpc.health.v1.Health/Check", "", nil, codes.OK},
+		{"unknown method denied", "/user.v1.UserService/DropAll", admin, nil, codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		ctx, err := a.Authorize(context.Background(), tt.method, tt.token, tt.req)
+		assert.Equal(t, tt.want, status.Code(err), tt.name)
+
+		if tt.want == codes.OK && tt.token != "" {
+			p, ok := PrincipalFromContext(ctx)
+			assert.True(t, ok, tt.name)
+			assert.NotEmpty(t, p.Subject, tt.name)
+		}
+	}
+}
+
+func TestAuthenticator_UnaryInterceptor(t *testing.T) {
+	t.Parallel()
+
+	k := newTestKeys(t)
+	a := &Authenticator{Verifier: newVerifier(t, k), Policy: DefaultPolicy()}
+	info := &grpc.UnaryServerInfo{FullMethod: userv1.UserService_GetUser_FullMethodName}
+
+	var subject string
+	handler := func(ctx context.Context, req any) (any, error) {
+		p, _ := PrincipalFromContext(ctx)
+		subject = p.Subject
+		return "ok", nil
+	}
+
+	token := k.hs(t, tokenOpts{kid: "hs-1", sub: "svc-reader", scopes: ScopeRead})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+
+	resp, err := a.UnaryInterceptor()(ctx, &userv1.GetUserRequest{Id: 1}, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+	assert.Equal(t, "svc-reader", subject)
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Basic dXNlcjpwYXNz"))
+	_, err = a.UnaryInterceptor()(ctx, &userv1.GetUserRequest{Id: 1}, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAuthenticator_ClientCertificate(t *testing.T) {
+	t.Parallel()
+
+	const billing = "spiffe://cluster.local/ns/billing/sa/billing"
+
+	scopes, err := ParseCertScopes(billing + "=users:read, users:write; ops-cli=users:admin")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{billing: {ScopeRead, ScopeWrite}, "ops-cli": {ScopeAdmin}}, scopes)
+
+	_, err = ParseCertScopes("no-scopes=")
+	assert.Error(t, err)
+
+	// только mTLS, без JWKS
+	a := &Authenticator{Policy: DefaultPolicy(), CertScopes: scopes}
+
+	ctx := mtls.WithIdentity(context.Background(), mtls.Identity{CommonName: "billing", URIs: []string{billing}})
+
+	ctx2, err := a.Authorize(ctx, userv1.UserService_CreateUser_FullMethodName, "", &userv1.CreateUserRequest{})
+	require.NoError(t, err)
+	p, _ := PrincipalFromContext(ctx2)
+	assert.Equal(t, billing, p.Subject)
+
+	_, err = a.Authorize(ctx, userv1.UserService_DeleteUser_FullMethodName, "", &userv1.DeleteUserRequest{Id: 1})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// сертификат, которого нет в CertScopes, не даёт доступа
+	unknown := mtls.WithIdentity(context.Background(), mtls.Identity{CommonName: "stranger"})
+	_, err = a.Authorize(unknown, userv1.UserService_GetUser_FullMethodName, "", &userv1.GetUserRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// JWT при выключенной проверке токенов отклоняется, а не пропускается
+	_, err = a.Authorize(ctx, userv1.UserService_GetUser_FullMethodName, "some.jwt.token", &userv1.GetUserRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
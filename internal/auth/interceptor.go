@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	userv1 "github.com/Derbik-Git/protos-tren-redis/user/v1"
+	"github.com/Derbik-Git/user-service/internal/audit/auditpb"
+	"github.com/Derbik-Git/user-service/internal/mtls"
+	"github.com/Derbik-Git/user-service/internal/server"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"github.com/Derbik-Git/user-service/internal/watch/watchpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Rule - требования к вызову метода
+type Rule struct {
+	Public bool     // токен не нужен (health проверки балансировщика)
+	Scopes []string // достаточно любого из перечисленных скоупов
+	Self   bool     // без скоупов вызов разрешён, если id из запроса совпадает с subject токена (пользователь меняет сам себя)
+}
+
+// Policy - правила по полному имени gRPC метода, метод без правила запрещён (deny by default),
+// поэтому новый RPC не окажется открытым только потому, что его забыли сюда добавить
+type Policy map[string]Rule
+
+// DefaultPolicy - политика UserService: чтение и подписка на изменения - users:read, создание и изменение - users:write,
+// удаление - только users:admin, журнал изменений - users:audit, свою запись пользователь может изменить без скоупов
+func DefaultPolicy() Policy {
+	return Policy{
+		userv1.UserService_GetUser_FullMethodName:    {Scopes: []string{ScopeRead}},
+		userv1.UserService_CreateUser_FullMethodName: {Scopes: []string{ScopeWrite}},
+		userv1.UserService_UpdateUser_FullMethodName: {Scopes: []string{ScopeWrite}, Self: true},
+		userv1.UserService_DeleteUser_FullMethodName: {Scopes: []string{ScopeAdmin}},
+
+		watchpb.UserWatchService_WatchUsers_FullMethodName: {Scopes: []string{ScopeRead}},
+
+		auditpb.UserAuditService_GetUserAuditTrail_FullMethodName: {Scopes: []string{ScopeAudit}},
+
+		"/grpc.health.v1.Health/Check": {Public: true},
+		"/grpc.health.v1.Health/Watch": {Public: true},
+		"/grpc.health.v1.Health/List":  {Public: true},
+	}
+}
+
+// Authenticator проверяет токен и политику, общий для gRPC интерцептора и HTTP шлюза
+type Authenticator struct {
+	Verifier *Verifier // nil - JWT не принимаются, только клиентские сертификаты из CertScopes
+	Policy   Policy
+
+	// CertScopes - скоупы для клиентов, которые пришли по mTLS без токена: имя из сертификата (mtls.Identity.Name) -> скоупы
+	// так сервисы внутри кластера ходят со своим сертификатом и не получают JWT
+	CertScopes map[string][]string
+}
+
+// idRequest - запрос, в котором есть id пользователя (Get/Update/DeleteUserRequest), нужен для правила Self
+type idRequest interface {
+	GetId() int64
+}
+
+// Authorize проверяет токен (без префикса Bearer) для вызова fullMethod с запросом req
+// и возвращает контекст с Principal и subject в логгере запроса
+// Ошибки - gRPC статусы: Unauthenticated, если токена нет или он невалиден, PermissionDenied, если прав не хватает
+func (a *Authenticator) Authorize(ctx context.Context, fullMethod, token string, req any) (context.Context, error) {
+	rule, ok := a.Policy[fullMethod]
+	if !ok {
+		return ctx, status.Error(codes.PermissionDenied, "method is not allowed by policy")
+	}
+	if rule.Public {
+		return ctx, nil
+	}
+
+	p, err := a.authenticate(ctx, token)
+	if err != nil {
+		if !errors.Is(err, ErrNoToken) {
+			sl.FromContext(ctx, nil).Warn("token rejected", slog.String("method", fullMethod), sl.Err(err))
+		}
+		return ctx, status.Error(codes.Unauthenticated, authMessage(err)) // причину отказа в токене клиенту не раскрываем
+	}
+
+	ctx = WithPrincipal(ctx, p)
+	ctx = sl.WithLogger(ctx, sl.FromContext(ctx, nil).With(slog.String("subject", p.Subject)))
+
+	if slices.ContainsFunc(rule.Scopes, p.HasScope) {
+		return ctx, nil
+	}
+	if rule.Self && isSelf(p, req) {
+		return ctx, nil
+	}
+
+	return ctx, status.Errorf(codes.PermissionDenied, "one of scopes %v is required", rule.Scopes)
+}
+
+// authenticate: токен важнее сертификата, без токена клиента определяет проверенный сертификат из mTLS
+func (a *Authenticator) authenticate(ctx context.Context, token string) (Principal, error) {
+	if token != "" {
+		if a.Verifier == nil {
+			return Principal{}, fmt.Errorf("%w: jwt auth is not configured", ErrInvalidToken)
+		}
+		return a.Verifier.Verify(token)
+	}
+
+	if id, ok := mtls.IdentityFromContext(ctx); ok {
+		if scopes, ok := a.CertScopes[id.Name()]; ok {
+			return Principal{Subject: id.Name(), Scopes: scopes}, nil
+		}
+	}
+	return Principal{}, ErrNoToken
+}
+
+func authMessage(err error) string {
+	if errors.Is(err, ErrNoToken) {
+		return ErrNoToken.Error()
+	}
+	return ErrInvalidToken.Error()
+}
+
+func isSelf(p Principal, req any) bool {
+	r, ok := req.(idRequest)
+	if !ok {
+		return false
+	}
+	return r.GetId() > 0 && strconv.FormatInt(r.GetId(), 10) == p.Subject
+}
+
+// UnaryInterceptor берёт токен из metadata "authorization: Bearer <jwt>"
+func (a *Authenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := a.Authorize(ctx, info.FullMethod, tokenFromMetadata(ctx), req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor - то же для стримов, запрос на момент открытия стрима ещё не прочитан, поэтому правило Self для стримов не работает
+func (a *Authenticator) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.Authorize(ss.Context(), info.FullMethod, tokenFromMetadata(ss.Context()), nil)
+		if err != nil {
+			return err
+		}
+		return handler(srv, server.WrapServerStream(ss, ctx))
+	}
+}
+
+func tokenFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	vals := md.Get("authorization")
+	if len(vals) == 0 {
+		return ""
+	}
+	return BearerToken(vals[0])
+}
+
+// BearerToken вырезает токен из значения заголовка Authorization, пустая строка - заголовок не Bearer
+func BearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// ParseCertScopes разбирает флаг вида "spiffe://cluster.local/ns/billing/sa/billing=users:read,users:write;ops-cli=users:admin"
+func ParseCertScopes(s string) (map[string][]string, error) {
+	res := map[string][]string{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		i := strings.LastIndex(entry, "=") // в скоупах "=" не бывает, а в имени (URI) - может
+		if i <= 0 || i == len(entry)-1 {
+			return nil, fmt.Errorf("invalid cert scopes entry %q, expected name=scope[,scope]", entry)
+		}
+		name, scopes := entry[:i], strings.Split(entry[i+1:], ",")
+		for j := range scopes {
+			scopes[j] = strings.TrimSpace(scopes[j])
+		}
+		res[name] = scopes
+	}
+	return res, nil
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+)
+
+// KeySet - ключи проверки подписи из JWKS файла (RFC 7517), индексированные по kid
+// Поддерживаются два типа:
+//
+//	{"kty": "oct", "kid": "...", "alg": "HS256", "k": "<base64url секрет>"}
+//	{"kty": "RSA", "kid": "...", "alg": "RS256", "n": "<base64url>", "e": "<base64url>"}
+//
+// Файл локальный (монтируется из секрета), сервис сам JWKS по сети не ходит
+type KeySet struct {
+	keys map[string]Key
+}
+
+// Key - один ключ, Alg определяет, какие токены им можно проверять: HS256 ключом нельзя проверить RS256 токен и наоборот
+type Key struct {
+	ID  string
+	Alg string
+	Key any // []byte для HS256, *rsa.PublicKey для RS256
+}
+
+// minRSAKeyBits - RSA ключи короче этого считаются взламываемыми, такой JWKS не загружается
+const minRSAKeyBits = 2048
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadJWKS читает и разбирает JWKS файл
+func LoadJWKS(path string) (*KeySet, error) {
+	const op = "auth.LoadJWKS"
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ks, err := ParseJWKS(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, path, err)
+	}
+	return ks, nil
+}
+
+// ParseJWKS разбирает JWKS документ, ключи с use отличным от "sig" пропускаются
+func ParseJWKS(b []byte) (*KeySet, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	ks := &KeySet{keys: make(map[string]Key, len(doc.Keys))}
+	for i, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.toKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %d (kid %q): %w", i, k.Kid, err)
+		}
+		if _, dup := ks.keys[key.ID]; dup {
+			return nil, fmt.Errorf("key %d: duplicate kid %q", i, k.Kid)
+		}
+		ks.keys[key.ID] = key
+	}
+
+	if len(ks.keys) == 0 {
+		return nil, errors.New("jwks has no signing keys")
+	}
+	return ks, nil
+}
+
+// Lookup ищет ключ для токена: по kid, а если kid в токене нет - единственный ключ нужного алгоритма
+func (ks *KeySet) Lookup(kid, alg string) (Key, error) {
+	if kid != "" {
+		key, ok := ks.keys[kid]
+		if !ok {
+			return Key{}, fmt.Errorf("unknown kid %q", kid)
+		}
+		if key.Alg != alg {
+			return Key{}, fmt.Errorf("key %q is for %s, token is signed with %s", kid, key.Alg, alg)
+		}
+		return key, nil
+	}
+
+	var found []Key
+	for _, key := range ks.keys {
+		if key.Alg == alg {
+			found = append(found, key)
+		}
+	}
+	if len(found) != 1 {
+		return Key{}, fmt.Errorf("token has no kid and there are %d %s keys", len(found), alg)
+	}
+	return found[0], nil
+}
+
+func (k jwk) toKey() (Key, error) {
+	switch k.Kty {
+	case "oct":
+		if k.Alg != "" && k.Alg != "HS256" {
+			return Key{}, fmt.Errorf("unsupported alg %q for oct key", k.Alg)
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return Key{}, fmt.Errorf("decode k: %w", err)
+		}
+		if len(secret) < 32 {
+			return Key{}, errors.New("HS256 secret must be at least 32 bytes")
+		}
+		return Key{ID: k.Kid, Alg: "HS256", Key: secret}, nil
+
+	case "RSA":
+		if k.Alg != "" && k.Alg != "RS256" {
+			return Key{}, fmt.Errorf("unsupported alg %q for RSA key", k.Alg)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return Key{}, fmt.Errorf("decode n: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return Key{}, fmt.Errorf("decode e: %w", err)
+		}
+		if len(n) == 0 || len(e) == 0 {
+			return Key{}, errors.New("RSA key requires n and e")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n)}
+		if bits := pub.N.BitLen(); bits < minRSAKeyBits {
+			return Key{}, fmt.Errorf("RSA key must be at least %d bits, got %d", minRSAKeyBits, bits)
+		}
+		// e больше int32 crypto/rsa не принимает, а Int64() молча обрезал бы переполнение до мусора
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > math.MaxInt32 || exp.Bit(0) == 0 {
+			return Key{}, errors.New("invalid RSA exponent")
+		}
+		pub.E = int(exp.Int64())
+		return Key{ID: k.Kid, Alg: "RS256", Key: pub}, nil
+
+	default:
+		return Key{}, fmt.Errorf("unsupported kty %q", k.Kty)
+	}
+}
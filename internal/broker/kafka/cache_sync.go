@@ -0,0 +1,120 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/cache"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/sl"
+)
+
+const (
+	// сколько максимум ждём redis при обработке одного события
+	cacheSyncTimeout = 5 * time.Second
+
+	// сколько помним удаление пользователя: с запасом дольше, чем событие может опоздать или прийти повторно после ребаланса
+	cacheSyncTombstoneTTL = 24 * time.Hour
+)
+
+// SyncCache - кеш для cache-sync: кроме пользователей хранит tombstone-ы удалённых, реализует cache.RedisCache
+type SyncCache interface {
+	cache.Cache
+	SetUserTombstone(ctx context.Context, id int64, version time.Time, ttl time.Duration) error
+	UserTombstone(ctx context.Context, id int64) (time.Time, error) // нулевое время - tombstone-а нет
+}
+
+// NewCacheSyncHandler возвращает хендлер, который поддерживает кеш в актуальном состоянии по событиям из user-events
+// Это нужно, потому что пользователей меняют и другие реплики, и внешние writer-ы, которые не трогают наш кеш:
+//   - user.created / user.updated / user.snapshot кладут пользователя из события в кеш (SetUser)
+//   - user.deleted удаляет пользователя из кеша (DeleteUser) и оставляет tombstone (время события - только для отладки)
+//
+// Событие, которое старше версии пользователя в кеше (сравниваем UpdatedAt), игнорируется,
+// иначе переигровка старых событий перезаписала бы свежие данные.
+// Любое создание или изменение пользователя с tombstone-ом игнорируется без сравнения времени: id берутся из последовательности
+// и после удаления не переиспользуются, поэтому законного изменения после удаления нет. А время удаления - часы приложения,
+// UpdatedAt - часы базы, и при расхождении часов опоздавшее событие выглядело бы "новее" удаления и вернуло бы пользователя в кеш
+//
+// Хендлер работает в контексте консьюмера: при остановке консьюмера запросы в redis отменяются, а не доживают свои cacheSyncTimeout
+func NewCacheSyncHandler(c SyncCache, ttl time.Duration, log *slog.Logger) MessageHandler {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return func(ctx context.Context, msg EventMessage) error {
+		const op = "kafka.CacheSyncHandler"
+
+		ctx, cancel := context.WithTimeout(ctx, cacheSyncTimeout)
+		defer cancel()
+
+		event := msg.Event
+		log := log.With(slog.String("op", op), slog.Int("partition", msg.Partition), slog.Int64("offset", msg.Offset))
+
+		u := event.Payload
+		if u.ID <= 0 {
+			log.Warn("event without user id, skip", slog.String("event_id", event.ID))
+			return nil
+		}
+
+		switch event.Type {
+		case domain.UserCreated, domain.UserUpdated, domain.UserSnapshot:
+			deletedAt, err := c.UserTombstone(ctx, u.ID)
+			if err != nil {
+				log.Error("cache tombstone get failed", slog.Int64("user_id", u.ID), sl.Err(err))
+				return err
+			}
+
+			if !deletedAt.IsZero() {
+				log.Info("event for deleted user ignored", slog.String("event_id", event.ID), slog.Int64("user_id", u.ID), slog.Time("deleted_at", deletedAt))
+				return nil
+			}
+
+			cached, err := c.GetUser(ctx, u.ID)
+			if err != nil {
+				log.Error("cache get failed", slog.Int64("user_id", u.ID), sl.Err(err))
+				return err
+			}
+
+			if cached != nil && userVersion(*cached).After(userVersion(u)) {
+				log.Info("stale event ignored", slog.String("event_id", event.ID), slog.Int64("user_id", u.ID))
+				return nil
+			}
+
+			if err := c.SetUser(ctx, &u, ttl); err != nil {
+				log.Error("cache set failed", slog.Int64("user_id", u.ID), sl.Err(err))
+				return err
+			}
+		case domain.UserDeleted:
+			// у события удаления в Payload только id, в tombstone кладём время события, для проверки оно не используется
+			deletedAt := event.CreatedAt
+			if deletedAt.IsZero() {
+				deletedAt = time.Now()
+			}
+
+			// сначала tombstone, потом удаление: если упадём между ними, событие придёт снова и удалит пользователя
+			if err := c.SetUserTombstone(ctx, u.ID, deletedAt, cacheSyncTombstoneTTL); err != nil {
+				log.Error("cache tombstone set failed", slog.Int64("user_id", u.ID), sl.Err(err))
+				return err
+			}
+
+			if err := c.DeleteUser(ctx, u.ID); err != nil {
+				log.Error("cache delete failed", slog.Int64("user_id", u.ID), sl.Err(err))
+				return err
+			}
+		default:
+			// события других типов кеш не меняют
+			return nil
+		}
+
+		return nil
+	}
+}
+
+// версия пользователя - время последнего изменения, у записей без UpdatedAt (старые данные в кеше) берём время создания
+func userVersion(u domain.User) time.Time {
+	if !u.UpdatedAt.IsZero() {
+		return u.UpdatedAt
+	}
+	return u.CreatedAt
+}
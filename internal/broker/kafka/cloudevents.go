@@ -0,0 +1,234 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/segmentio/kafka-go"
+)
+
+// Режим, в котором продюсер кладёт событие в kafka.Message
+// EventModeLegacy - старый формат: в Value лежит сам domain.UserEvent (JSON или protobuf, см. PayloadEncoding)
+// EventModeCloudEventsStructured - весь CloudEvent (атрибуты + data) лежит в Value как application/cloudevents+json
+// EventModeCloudEventsBinary - атрибуты CloudEvent лежат в заголовках ce_*, а в Value только data (domain.User)
+// спецификация привязки к kafka: https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/kafka-protocol-binding.md
+type EventMode string
+
+const (
+	EventModeLegacy                EventMode = "legacy"
+	EventModeCloudEventsStructured EventMode = "cloudevents-structured"
+	EventModeCloudEventsBinary     EventMode = "cloudevents-binary"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+
+	// source по умолчанию, если в продюсер не передали свой
+	DefaultCloudEventsSource = "/user-service"
+
+	contentTypeHeader          = "content-type"
+	contentTypeJSON            = "application/json"
+	contentTypeCloudEventsJSON = "application/cloudevents+json"
+
+	// в binary режиме каждый атрибут CloudEvent - отдельный заголовок с префиксом ce_
+	ceHeaderPrefix      = "ce_"
+	ceHeaderSpecVersion = ceHeaderPrefix + "specversion"
+	ceHeaderID          = ceHeaderPrefix + "id"
+	ceHeaderSource      = ceHeaderPrefix + "source"
+	ceHeaderType        = ceHeaderPrefix + "type"
+	ceHeaderTime        = ceHeaderPrefix + "time"
+	ceHeaderSubject     = ceHeaderPrefix + "subject"
+)
+
+var ErrUnknownEventMode = errors.New("unknown event mode")
+
+// ParseEventMode нужен для конфига, что бы режим можно было передать строкой
+func ParseEventMode(s string) (EventMode, error) {
+	switch EventMode(s) {
+	case "", EventModeLegacy:
+		return EventModeLegacy, nil
+	case EventModeCloudEventsStructured:
+		return EventModeCloudEventsStructured, nil
+	case EventModeCloudEventsBinary:
+		return EventModeCloudEventsBinary, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownEventMode, s)
+	}
+}
+
+// structured представление CloudEvent, поля названы так, как требует спецификация
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            time.Time       `json:"time"`
+	Subject         string          `json:"subject,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// subject CloudEvent-а - это id пользователя, к которому относится событие
+func cloudEventSubject(event domain.UserEvent) string {
+	return strconv.FormatInt(event.Payload.ID, 10)
+}
+
+func encodeCloudEventStructured(event domain.UserEvent, source string) ([]byte, []kafka.Header, error) {
+	data, err := json.Marshal(event.Payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshall data: %w", err)
+	}
+
+	b, err := json.Marshal(cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              event.ID,
+		Source:          source,
+		Type:            event.Type,
+		Time:            event.CreatedAt,
+		Subject:         cloudEventSubject(event),
+		DataContentType: contentTypeJSON,
+		Data:            data,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshall cloudevent: %w", err)
+	}
+
+	return b, []kafka.Header{{Key: contentTypeHeader, Value: []byte(contentTypeCloudEventsJSON)}}, nil
+}
+
+func encodeCloudEventBinary(event domain.UserEvent, source string, encoding PayloadEncoding) ([]byte, []kafka.Header, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if encoding == EncodingProtobuf {
+		data, err = marshalUserProto(event.Payload)
+	} else {
+		data, err = json.Marshal(event.Payload)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshall data: %w", err)
+	}
+
+	headers := []kafka.Header{
+		{Key: ceHeaderSpecVersion, Value: []byte(cloudEventsSpecVersion)},
+		{Key: ceHeaderID, Value: []byte(event.ID)},
+		{Key: ceHeaderSource, Value: []byte(source)},
+		{Key: ceHeaderType, Value: []byte(event.Type)},
+		{Key: ceHeaderTime, Value: []byte(event.CreatedAt.Format(time.RFC3339Nano))},
+		{Key: ceHeaderSubject, Value: []byte(cloudEventSubject(event))},
+		{Key: contentTypeHeader, Value: []byte(encoding.contentType())},
+	}
+
+	return data, headers, nil
+}
+
+// headerValue ищет заголовок без учёта регистра, как того требует привязка CloudEvents к kafka
+func headerValue(headers []kafka.Header, key string) (string, bool) {
+	for _, h := range headers {
+		if strings.EqualFold(h.Key, key) {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
+
+// DecodeUserEvent понимает legacy событие (JSON или protobuf), CloudEvents structured и CloudEvents binary
+// режим и кодировка определяются по заголовкам, а если заголовков нет (например ProcessRawMessage) - по содержимому JSON
+func DecodeUserEvent(m kafka.Message) (domain.UserEvent, error) {
+	if _, ok := headerValue(m.Headers, ceHeaderSpecVersion); ok {
+		return decodeCloudEventBinary(m)
+	}
+
+	ct, _ := headerValue(m.Headers, contentTypeHeader)
+	switch {
+	case strings.HasPrefix(ct, contentTypeCloudEventsJSON):
+		return decodeCloudEventStructured(m.Value)
+	case isProtobufContentType(ct):
+		return unmarshalUserEventProto(m.Value)
+	}
+
+	// заголовков нет: смотрим, есть ли в JSON поле specversion, legacy событие его никогда не содержит
+	var probe struct {
+		SpecVersion string `json:"specversion"`
+	}
+	if err := json.Unmarshal(m.Value, &probe); err != nil {
+		return domain.UserEvent{}, err
+	}
+	if probe.SpecVersion != "" {
+		return decodeCloudEventStructured(m.Value)
+	}
+
+	var event domain.UserEvent
+	if err := json.Unmarshal(m.Value, &event); err != nil {
+		return domain.UserEvent{}, err
+	}
+	return event, nil
+}
+
+func decodeCloudEventStructured(value []byte) (domain.UserEvent, error) {
+	var ce cloudEvent
+	if err := json.Unmarshal(value, &ce); err != nil {
+		return domain.UserEvent{}, err
+	}
+	if ce.SpecVersion != cloudEventsSpecVersion {
+		return domain.UserEvent{}, fmt.Errorf("unsupported cloudevents specversion %q", ce.SpecVersion)
+	}
+
+	event := domain.UserEvent{
+		ID:        ce.ID,
+		Type:      ce.Type,
+		CreatedAt: ce.Time,
+	}
+
+	if len(ce.Data) > 0 {
+		if err := json.Unmarshal(ce.Data, &event.Payload); err != nil {
+			return domain.UserEvent{}, fmt.Errorf("unmarshall cloudevent data: %w", err)
+		}
+	}
+
+	return event, nil
+}
+
+func decodeCloudEventBinary(m kafka.Message) (domain.UserEvent, error) {
+	specVersion, _ := headerValue(m.Headers, ceHeaderSpecVersion)
+	if specVersion != cloudEventsSpecVersion {
+		return domain.UserEvent{}, fmt.Errorf("unsupported cloudevents specversion %q", specVersion)
+	}
+
+	var event domain.UserEvent
+	event.ID, _ = headerValue(m.Headers, ceHeaderID)
+	event.Type, _ = headerValue(m.Headers, ceHeaderType)
+
+	if t, ok := headerValue(m.Headers, ceHeaderTime); ok {
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			return domain.UserEvent{}, fmt.Errorf("parse ce_time: %w", err)
+		}
+		event.CreatedAt = parsed
+	}
+
+	if len(m.Value) == 0 {
+		return event, nil
+	}
+
+	if ct, _ := headerValue(m.Headers, contentTypeHeader); isProtobufContentType(ct) {
+		payload, err := unmarshalUserProto(m.Value)
+		if err != nil {
+			return domain.UserEvent{}, err
+		}
+		event.Payload = payload
+		return event, nil
+	}
+
+	if err := json.Unmarshal(m.Value, &event.Payload); err != nil {
+		return domain.UserEvent{}, fmt.Errorf("unmarshall cloudevent data: %w", err)
+	}
+
+	return event, nil
+}
@@ -2,10 +2,14 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/metrics"
+	"github.com/Derbik-Git/user-service/internal/tracing"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -15,18 +19,59 @@ import (
 // Функция(тип для структуры consumer), которая берёт сообщения из консьюмера и отправляет его на проверку в тесты
 type HendlerAddEvent func(event domain.UserEvent) error // этот тип нужен исключительно для того, что бы добавить поле в Consumer с таким же типом как в этой строке(16), что бы потом за счёт NewConsumer передать в структуру Consumer метод, отвечающий за взятие ивента и передачи его тестам для проверки, что бы мы могли проверить, что именно это сообщение дошло до консьюмера и было обработано, а не какое то другое сообщение, которое может прийти в консьюмер от другого микросервиса, который тоже пишет в этот топик, но мы не хотим его обрабатывать, а хотим проверить именно наше сообщение от нашего продюсера, который мы отправляем в тестах сервисатип метода и метод должны совпасть для успешной передачи и небыло конфиликта из за разных типов данных- func(ctx context.Context, event domain.UserEvent) error
 
+// так же как massageWriter у продюсера, интерфейс нужен что бы в тестах можно было подставить свой ридер вместо *kafka.Reader
+type massageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
 type Consumer struct {
-	reader  *kafka.Reader
-	Log     *slog.Logger
-	Handler HendlerAddEvent // сюда будем передавать логику обработки
+	KafkaReader massageReader
+	Log         *slog.Logger
+	Handler     HendlerAddEvent // сюда будем передавать логику обработки, старый вариант без контекста, см. MessageHandler
 	//(Якобы это другой сервис) сюда можно вставить добавить сервис, что бы потом добавить в StartKafkaConsumer функцию из сервиса для проверки идемпотентности
+
+	// хендлер с контекстом и метаданными сообщения, если задан - используется вместо Handler
+	MessageHandler MessageHandler
+
+	// Concurrency - сколько воркеров параллельно обрабатывают сообщения, 0 или 1 = старый последовательный режим
+	// сообщения с одинаковым ключом (user ID) всегда попадают в один и тот же воркер, поэтому порядок событий одного пользователя сохраняется
+	Concurrency int
+
+	// пакетный режим (см. BatchHandler), включается через WithBatchHandler
+	BatchHandler BatchHandler
+	BatchSize    int           // максимальный размер пачки
+	BatchWait    time.Duration // сколько максимум ждать добора пачки после первого сообщения
+
+	// через сколько без успешного чтения консьюмер считается зависшим (см. Health), 0 - проверка выключена
+	HealthInterval time.Duration
+
+	lastFetch atomic.Int64 // unix nano последнего успешного FetchMessage
+	lag       atomic.Int64 // последний лаг из статистики ридера
+	lagKnown  atomic.Bool  // ридер умеет отдавать статистику и лаг хотя бы раз был получен
+
+	lifeMu sync.Mutex
+	life   lifecycle // запуск через Run и остановка через Shutdown
+}
+
+// ConsumerOption - необязательная настройка консьюмера, передаётся в NewConsumer
+type ConsumerOption func(c *Consumer)
+
+// WithConcurrency включает пул из n воркеров (см. Consumer.Concurrency)
+func WithConcurrency(n int) ConsumerOption {
+	return func(c *Consumer) {
+		c.Concurrency = n
+	}
 }
 
-func NewConsumer(brokers []string, topic string, groupID string, log *slog.Logger, handlerForTests HendlerAddEvent) *Consumer {
-	return &Consumer{
-		Log:     log,
-		Handler: handlerForTests,
-		reader: kafka.NewReader(kafka.ReaderConfig{
+// handlerForTests может быть nil, если хендлер передаётся через WithMessageHandler
+func NewConsumer(brokers []string, topic string, groupID string, log *slog.Logger, handlerForTests HendlerAddEvent, opts ...ConsumerOption) *Consumer {
+	c := &Consumer{
+		Log:            log,
+		Handler:        handlerForTests,
+		HealthInterval: defaultHealthInterval,
+		KafkaReader: kafka.NewReader(kafka.ReaderConfig{
 			Brokers: brokers,
 			GroupID: groupID, // Невыносимо важно запомнить! !!!!! это как раз нужно для насущного вопроса. А что если вдруг мы отмасштабируем наш сервис и множество его копий будут пытаться читать из одного консьюмера сообщение, то будет онка данных, а при добавлении GroupID Если ты запустишь 3 экземпляра своего приложения (например, 3 контейнера в Docker) и дашь им одинаковый GroupID = "user-service-group", Kafka поймет, что это одна команда работников. Она отдаст первому приложению Партицию 1, второму — Партицию 2, третьему — Партицию 3. Они будут читать данные параллельно, разделяя нагрузку.
 			Topic:   topic,   // Указываем название топика, из которого будет читать консьюмер, передаём константу из domain, которую мы указывали для продюсера
@@ -35,16 +80,47 @@ func NewConsumer(brokers []string, topic string, groupID string, log *slog.Logge
 			MaxBytes: 10e6, // MinBytes наоборот, максимальный размер сообщения, который консьюмер может принять
 		}),
 	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
 // Касательно логики для тестов. Создаётся переменная с типом сообщения(ивента) - это структура, туда за счёт ридера, котрый прочитал сообщение передаётся само сообщение и передаётся в функцию HendlerEventForTest для взятия и пердачи ивента тестам для дальнейшей проверки целостности и правильности сообщения
+// StartKafkaConsumer блокируется до отмены ctx, отмена прерывает и чтение, и текущий хендлер
+// для остановки, которая дожидается текущих сообщений, см. Run и Shutdown
 func (c *Consumer) StartKafkaConsumer(ctx context.Context) {
+	c.run(ctx, ctx)
+}
+
+// run - основной цикл консьюмера во всех режимах:
+// fetchCtx останавливает чтение новых сообщений, workCtx передаётся хендлерам и используется для коммитов
+// пока workCtx жив, уже прочитанные сообщения дообрабатываются и коммитятся даже после отмены fetchCtx
+func (c *Consumer) run(fetchCtx, workCtx context.Context) {
+	// отсчёт HealthInterval начинается с запуска, а не с первого сообщения
+	c.lastFetch.CompareAndSwap(0, time.Now().UnixNano())
+
+	statsCtx, stopStats := context.WithCancel(fetchCtx)
+	defer stopStats()
+	go c.watchStats(statsCtx)
+
+	if c.BatchHandler != nil {
+		c.runBatches(fetchCtx, workCtx)
+		return
+	}
+
+	if c.Concurrency > 1 {
+		c.runWorkers(fetchCtx, workCtx)
+		return
+	}
 
 	// беконечный цикл, что бы консьюмер постоянно слушал топик, это базовая настройка для любого консьюмера
 	for {
-		m, err := c.reader.FetchMessage(ctx) // Метод читает, но не подтверждает выполнение сразу, что бы можно было за счёт continue в случае возникновениея ошибки можно было вернуться к повтрной поытке прочитать это сообщение 1. мы оставляем закладку, что работаем с этим сообщением
+		m, err := c.fetchMessage(fetchCtx) // Метод читает, но не подтверждает выполнение сразу, что бы можно было за счёт continue в случае возникновениея ошибки можно было вернуться к повтрной поытке прочитать это сообщение 1. мы оставляем закладку, что работаем с этим сообщением
 		if err != nil {
-			if ctx.Err() != nil {
+			if fetchCtx.Err() != nil {
 				c.Log.Info("kafka consumer stopping due to context cancellation")
 				return
 			}
@@ -52,7 +128,7 @@ func (c *Consumer) StartKafkaConsumer(ctx context.Context) {
 			continue
 		}
 
-		if err := c.ProcessRawMessage(ctx, m.Value); err != nil {
+		if err := c.ProcessMessage(workCtx, m); err != nil {
 			// Если обработка сломалась (например, БД упала), делаем continue
 			// и не вызываем CommitMessages, чтобы сообщение не потерялось
 			continue
@@ -63,23 +139,52 @@ func (c *Consumer) StartKafkaConsumer(ctx context.Context) {
 		// !!!!! в этой логике, когда что то не получается и мы обрабатваем ошибку, например база данных не доступна, мы делаем continue(и продолжаем пытаться достать это сообщение, потому что FetchMessage извлекает, но не даёт сигнал о доставке сообщения, и при возникновении ошибки мы пишем continue и каждый раз продолжаем работать над этим сообщением), то есть не доходим до подтверждения выполнения операции, а возвращаемся заного к этой закладке_1._(сообщению), за счёт того что мы использовали FetchMessage, таким образом оставив закладку и сказав, что мы работаем над этим сообщением, и пока его не обработаем, от него не отойдём. Короче мы в начачале за счёт FetchMessage, говорим что работаем именно над этим сообщением и при ошибке пишем continue и возвращаемся его получить целостно заного, не следующее, а из за того, что мы сказали за счёт FetchMessage что начали работу над ним и работаем над ним и в случае возникновения ошибки будем дальше пробовать его извлечь из брокера.
 
 		// подтверждение выполнения операции
-		if err := c.reader.CommitMessages(ctx, m); err != nil {
+		if err := c.commitMessages(workCtx, m); err != nil {
 			c.Log.Error("failed to commit message", slog.Any("error", err))
 		}
 	}
 }
 
-func (c *Consumer) ProcessRawMessage(ctx context.Context, value []byte) error {
-	var event domain.UserEvent
-	if err := json.Unmarshal(value, &event); err != nil {
+// ProcessMessage декодирует сообщение с учётом заголовков (CloudEvents binary/structured или legacy JSON) и передаёт событие в Handler
+func (c *Consumer) ProcessMessage(ctx context.Context, m kafka.Message) (err error) {
+	ctx, span := startConsumeSpan(ctx, m)
+	defer func() { tracing.End(span, err) }()
+
+	event, err := DecodeUserEvent(m)
+	if err != nil {
 		c.Log.Error("failed to unmarshall event", slog.Any("error", err))
+		metrics.KafkaMessageProcessed(m.Topic, eventTypeUnknown, statusDecodeError)
 		return err
 	}
 
-	c.Log.Info("processing event", slog.String("type", event.Type), slog.Int64("user_id", event.Payload.ID))
+	start := time.Now()
+	err = c.handleEvent(ctx, newEventMessage(m, event))
+	metrics.ObserveKafkaHandler(m.Topic, eventTypeLabel(event.Type), time.Since(start))
+
+	status := statusSuccess
+	if err != nil {
+		status = statusError
+	}
+	metrics.KafkaMessageProcessed(m.Topic, eventTypeLabel(event.Type), status)
+
+	return err
+}
 
-	if c.Handler != nil {
-		err := c.Handler(event)
+// ProcessRawMessage работает только с Value сообщения, поэтому понимает legacy JSON и CloudEvents structured, но не binary (его атрибуты лежат в заголовках)
+func (c *Consumer) ProcessRawMessage(ctx context.Context, value []byte) error {
+	return c.ProcessMessage(ctx, kafka.Message{Value: value})
+}
+
+func (c *Consumer) handleEvent(ctx context.Context, msg EventMessage) error {
+	c.Log.Info("processing event", slog.String("type", msg.Event.Type), slog.Int64("user_id", msg.Event.Payload.ID), slog.Int("partition", msg.Partition), slog.Int64("offset", msg.Offset))
+
+	handler := c.MessageHandler
+	if handler == nil {
+		handler = AdaptHandler(c.Handler)
+	}
+
+	if handler != nil {
+		err := handler(ctx, msg)
 		if err != nil {
 			c.Log.Error("handler failed to process message", slog.Any("error", err))
 			return err
@@ -90,6 +195,24 @@ func (c *Consumer) ProcessRawMessage(ctx context.Context, value []byte) error {
 }
 
 // используется при выключении сервиса, что бы закрыть соединение с брокером kafka
+// Close не ждёт обработку текущих сообщений, если консьюмер запущен через Run - используйте Shutdown
 func (c *Consumer) Close() error {
-	return c.reader.Close()
+	return c.KafkaReader.Close()
+}
+
+// commitTimeout - сколько ждём коммита offset-ов уже обработанных сообщений
+const commitTimeout = 5 * time.Second
+
+// commitMessages коммитит offset-ы обработанных сообщений и считает неудачные коммиты в метриках, логирование остаётся на вызывающем
+// отмена ctx (остановка консьюмера) коммит не прерывает: сообщения уже обработаны, и если не закоммитить их offset-ы,
+// после рестарта kafka отдаст их снова
+func (c *Consumer) commitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), commitTimeout)
+	defer cancel()
+
+	err := c.KafkaReader.CommitMessages(ctx, msgs...)
+	if err != nil && len(msgs) > 0 {
+		metrics.KafkaCommitFailed(msgs[0].Topic)
+	}
+	return err
 }
@@ -0,0 +1,177 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/metrics"
+	"github.com/Derbik-Git/user-service/internal/tracing"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	defaultBatchSize = 100
+	defaultBatchWait = time.Second
+)
+
+// BatchHandler получает пачку событий вместо одного, после успешной обработки пачки offset-ы коммитятся одним вызовом CommitMessages
+//
+// Семантика ошибок:
+//   - nil - обработана вся пачка, коммитятся все сообщения пачки
+//   - *BatchError - обработаны только первые Processed событий, коммитятся сообщения до них включительно, остальные - нет
+//   - любая другая ошибка - не обработано ничего, ничего и не коммитится
+//
+// Незакоммиченные сообщения, как и в последовательном режиме, не читаются повторно сразу, kafka отдаст их заново после
+// перезапуска или ребалансировки группы, только если после них не был закоммичен offset этой же партиции,
+// поэтому хендлер должен быть идемпотентным и сам решать, что делать с событиями, которые не смог обработать
+type BatchHandler func(ctx context.Context, events []domain.UserEvent) error
+
+// BatchError - ошибка частичной обработки пачки
+type BatchError struct {
+	Processed int // сколько событий с начала пачки обработано успешно
+	Err       error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch processed %d events: %v", e.Processed, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// WithBatchHandler включает пакетный режим: хендлер получает до size событий, но ждёт добора пачки не дольше wait
+// пакетный режим имеет приоритет над Concurrency и Handler
+func WithBatchHandler(handler BatchHandler, size int, wait time.Duration) ConsumerOption {
+	return func(c *Consumer) {
+		c.BatchHandler = handler
+		c.BatchSize = size
+		c.BatchWait = wait
+	}
+}
+
+func (c *Consumer) runBatches(fetchCtx, workCtx context.Context) {
+	for {
+		batch := c.fetchBatch(fetchCtx)
+
+		if fetchCtx.Err() != nil {
+			// недобранную пачку не обрабатываем: offset-ы не закоммичены, kafka отдаст эти сообщения снова
+			c.Log.Info("kafka consumer stopping due to context cancellation")
+			return
+		}
+
+		c.processBatch(workCtx, batch)
+	}
+}
+
+// fetchBatch ждёт первое сообщение сколько угодно, а после него добирает пачку не дольше BatchWait
+func (c *Consumer) fetchBatch(ctx context.Context) []kafka.Message {
+	size := c.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	wait := c.BatchWait
+	if wait <= 0 {
+		wait = defaultBatchWait
+	}
+
+	batch := make([]kafka.Message, 0, size)
+	var deadline time.Time
+
+	for len(batch) < size {
+		fetchCtx, cancel := ctx, context.CancelFunc(func() {})
+		if len(batch) > 0 {
+			fetchCtx, cancel = context.WithDeadline(ctx, deadline)
+		}
+
+		m, err := c.fetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil || fetchCtx.Err() != nil { // остановка консьюмера или вышло время ожидания пачки
+				return batch
+			}
+			c.Log.Error("failed to fetch message", slog.Any("error", err))
+			continue
+		}
+
+		if len(batch) == 0 {
+			deadline = time.Now().Add(wait)
+		}
+		batch = append(batch, m)
+	}
+
+	return batch
+}
+
+func (c *Consumer) processBatch(ctx context.Context, batch []kafka.Message) {
+	if len(batch) == 0 {
+		return
+	}
+
+	events := make([]domain.UserEvent, 0, len(batch))
+	eventMsgIdx := make([]int, 0, len(batch)) // индекс сообщения в batch для каждого события
+
+	for i, m := range batch {
+		event, err := DecodeUserEvent(m)
+		if err != nil {
+			// битое сообщение обработать не получится никогда, поэтому пропускаем его и коммитим вместе с пачкой
+			c.Log.Error("failed to unmarshall event", slog.Any("error", err), slog.Int64("offset", m.Offset))
+			metrics.KafkaMessageProcessed(m.Topic, eventTypeUnknown, statusDecodeError)
+			continue
+		}
+		events = append(events, event)
+		eventMsgIdx = append(eventMsgIdx, i)
+	}
+
+	toCommit := batch
+	if len(events) > 0 {
+		topic := batch[0].Topic
+
+		spanCtx, span := startBatchSpan(ctx, batch)
+		start := time.Now()
+		err := c.BatchHandler(spanCtx, events)
+		metrics.ObserveKafkaHandler(topic, eventTypeBatch, time.Since(start))
+		tracing.End(span, err)
+
+		processed := len(events) // сколько событий с начала пачки обработано, для метрик
+
+		var batchErr *BatchError
+		switch {
+		case err == nil:
+		case errors.As(err, &batchErr):
+			processed = min(max(batchErr.Processed, 0), len(events))
+			c.Log.Error("batch handler partially failed", slog.Int("processed", batchErr.Processed), slog.Int("batch_size", len(events)), slog.Any("error", batchErr.Err))
+
+			switch {
+			case batchErr.Processed <= 0:
+				toCommit = nil
+			case batchErr.Processed < len(events):
+				toCommit = batch[:eventMsgIdx[batchErr.Processed]] // всё до первого необработанного события
+			}
+		default:
+			c.Log.Error("batch handler failed", slog.Int("batch_size", len(events)), slog.Any("error", err))
+			processed = 0
+			toCommit = nil
+		}
+
+		for i, event := range events {
+			status := statusSuccess
+			if i >= processed {
+				status = statusError
+			}
+			metrics.KafkaMessageProcessed(topic, eventTypeLabel(event.Type), status)
+		}
+	}
+
+	if len(toCommit) == 0 {
+		return
+	}
+
+	if err := c.commitMessages(ctx, toCommit...); err != nil {
+		c.Log.Error("failed to commit batch", slog.Int("messages", len(toCommit)), slog.Any("error", err))
+	}
+}
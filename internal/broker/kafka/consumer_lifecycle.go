@@ -0,0 +1,88 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+var ErrConsumerClosed = errors.New("kafka consumer is closed")
+
+// lifecycle - состояние запуска консьюмера через Run, нужно Shutdown-у, что бы остановить чтение и дождаться хендлеров
+type lifecycle struct {
+	stopFetch context.CancelFunc // останавливает чтение новых сообщений
+	abortWork context.CancelFunc // отменяет контекст хендлеров, когда вышел срок Shutdown
+	done      chan struct{}      // закрывается, когда Run вернулся
+	shutdown  bool
+}
+
+// Run запускает консьюмер и блокируется, пока он не остановится
+// В отличие от StartKafkaConsumer, остановка не обрывает обработку на середине:
+// отмена ctx или Shutdown только прекращают чтение, а уже прочитанные сообщения дообрабатываются хендлером и коммитятся.
+// Контекст хендлеров отменяется только когда истекает срок, переданный в Shutdown
+func (c *Consumer) Run(ctx context.Context) error {
+	fetchCtx, stopFetch := context.WithCancel(ctx)
+	workCtx, abortWork := context.WithCancel(context.WithoutCancel(ctx)) // значения (логгер, трейсинг) из ctx остаются, отмена - нет
+	defer stopFetch()
+	defer abortWork()
+
+	c.lifeMu.Lock()
+	if c.life.shutdown {
+		c.lifeMu.Unlock()
+		return ErrConsumerClosed
+	}
+	if c.life.done != nil {
+		c.lifeMu.Unlock()
+		return errors.New("kafka consumer has already been started")
+	}
+	done := make(chan struct{})
+	c.life = lifecycle{stopFetch: stopFetch, abortWork: abortWork, done: done}
+	c.lifeMu.Unlock()
+
+	defer close(done)
+
+	c.run(fetchCtx, workCtx)
+
+	return nil
+}
+
+// Shutdown останавливает консьюмер, запущенный через Run:
+//  1. прекращает чтение новых сообщений
+//  2. ждёт, пока хендлер дообработает уже прочитанные сообщения и их offset-ы закоммитятся, но не дольше срока ctx
+//  3. если срок вышел - отменяет контекст хендлеров (их незакоммиченные сообщения kafka отдаст заново) и дожидается выхода Run
+//  4. закрывает ридер
+//
+// Если консьюмер не запускался, Shutdown просто закрывает ридер. Повторный вызов безопасен
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	const op = "kafka.Consumer.Shutdown"
+
+	c.lifeMu.Lock()
+	if c.life.shutdown {
+		c.lifeMu.Unlock()
+		return nil
+	}
+	c.life.shutdown = true
+	life := c.life
+	c.lifeMu.Unlock()
+
+	var err error
+	if life.done != nil {
+		life.stopFetch()
+
+		select {
+		case <-life.done:
+		case <-ctx.Done():
+			c.Log.Warn("kafka consumer shutdown deadline exceeded, aborting in-flight messages", slog.String("op", op))
+			life.abortWork()
+			<-life.done
+			err = fmt.Errorf("%s: %w", op, ctx.Err())
+		}
+	}
+
+	if closeErr := c.KafkaReader.Close(); closeErr != nil {
+		err = errors.Join(err, fmt.Errorf("%s: %w", op, closeErr))
+	}
+
+	return err
+}
@@ -0,0 +1,121 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/metrics"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	defaultHealthInterval = 5 * time.Minute
+	statsInterval         = 10 * time.Second // как часто снимаем лаг со статистики ридера и проверяем здоровье
+
+	statusSuccess     = "success"
+	statusError       = "error"
+	statusDecodeError = "decode_error"
+	eventTypeUnknown  = "unknown"
+	eventTypeBatch    = "batch"
+)
+
+var (
+	ErrConsumerNotStarted = errors.New("kafka consumer is not started")
+	ErrConsumerStuck      = errors.New("kafka consumer has not fetched messages for too long")
+)
+
+// eventTypeLabel - значение лейбла event_type: только известные типы событий, всё остальное - "unknown",
+// иначе любой продюсер с произвольным type в сообщении раздувает число серий метрик
+func eventTypeLabel(eventType string) string {
+	switch eventType {
+	case domain.UserCreated, domain.UserUpdated, domain.UserDeleted, domain.UserSnapshot:
+		return eventType
+	default:
+		return eventTypeUnknown
+	}
+}
+
+// statsReader - *kafka.Reader умеет отдавать статистику (в том числе лаг), моки и memory брокер - нет, поэтому проверяем через type assertion
+type statsReader interface {
+	Stats() kafka.ReaderStats
+}
+
+// WithHealthInterval задаёт, через сколько без единого успешного FetchMessage консьюмер считается зависшим (см. Consumer.Health), 0 - проверка выключена
+func WithHealthInterval(d time.Duration) ConsumerOption {
+	return func(c *Consumer) {
+		c.HealthInterval = d
+	}
+}
+
+// Health возвращает ошибку, если консьюмер не запущен или не получал сообщений дольше HealthInterval при ненулевом лаге
+// Пустой топик - не проблема: если ридер знает лаг и он равен 0, консьюмеру просто нечего читать
+func (c *Consumer) Health() error {
+	if c.HealthInterval <= 0 {
+		return nil
+	}
+
+	last := c.lastFetch.Load()
+	if last == 0 {
+		return ErrConsumerNotStarted
+	}
+
+	since := time.Since(time.Unix(0, last))
+	if since <= c.HealthInterval {
+		return nil
+	}
+
+	if c.lagKnown.Load() && c.lag.Load() == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: last fetch %s ago", ErrConsumerStuck, since.Round(time.Second))
+}
+
+// fetchMessage - FetchMessage с учётом времени последнего успешного чтения для Health и метрик
+func (c *Consumer) fetchMessage(ctx context.Context) (kafka.Message, error) {
+	m, err := c.KafkaReader.FetchMessage(ctx)
+	if err != nil {
+		return m, err
+	}
+
+	now := time.Now()
+	c.lastFetch.Store(now.UnixNano())
+	metrics.SetKafkaLastFetch(m.Topic, now)
+
+	return m, nil
+}
+
+// watchStats работает, пока запущен консьюмер: раз в statsInterval снимает лаг с ридера и пишет в лог, если консьюмер завис
+func (c *Consumer) watchStats(ctx context.Context) {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	wasHealthy := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if sr, ok := c.KafkaReader.(statsReader); ok {
+			stats := sr.Stats()
+			c.lag.Store(stats.Lag)
+			c.lagKnown.Store(true)
+			metrics.SetKafkaConsumerLag(stats.Topic, stats.Lag)
+		}
+
+		err := c.Health()
+		switch {
+		case err != nil && wasHealthy:
+			c.Log.Warn("kafka consumer is unhealthy", slog.Any("error", err), slog.Int64("lag", c.lag.Load()))
+		case err == nil && !wasHealthy:
+			c.Log.Info("kafka consumer is healthy again")
+		}
+		wasHealthy = err == nil
+	}
+}
@@ -0,0 +1,166 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// сколько сообщений может ждать своей очереди у одного воркера, когда очередь заполнена, чтение из kafka останавливается (backpressure)
+const workerQueueSize = 16
+
+// runWorkers - параллельная версия StartKafkaConsumer
+// Как это работает:
+//  1. основной цикл читает сообщения и раскладывает их по воркерам по хэшу ключа (ключ = user ID, см. Producer.PublishUserEvent),
+//     поэтому события одного пользователя всегда обрабатываются одним воркером и строго по порядку
+//  2. воркер после обработки отдаёт сообщение коммиттеру
+//  3. коммиттер коммитит offset только тогда, когда обработаны ВСЕ сообщения партиции до него,
+//     иначе при падении сервиса мы бы потеряли сообщения, которые ещё висят у медленного воркера
+//
+// Если хендлер вернул ошибку, сообщение считается завершённым так же, как в последовательном режиме:
+// оно не коммитится само по себе, но следующий коммит этой партиции его перекроет
+func (c *Consumer) runWorkers(fetchCtx, workCtx context.Context) {
+	n := c.Concurrency
+
+	tracker := newOffsetTracker()
+	completed := make(chan kafka.Message, n)
+
+	var wg sync.WaitGroup
+	queues := make([]chan kafka.Message, n)
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, workerQueueSize)
+
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			for m := range queue {
+				_ = c.ProcessMessage(workCtx, m) // ошибка уже залогирована внутри ProcessMessage
+				completed <- m
+			}
+		}(queues[i])
+	}
+
+	committerDone := make(chan struct{})
+	go func() {
+		defer close(committerDone)
+		for m := range completed {
+			toCommit, ok := tracker.complete(m)
+			if !ok {
+				continue
+			}
+			if err := c.commitMessages(workCtx, toCommit); err != nil {
+				c.Log.Error("failed to commit message", slog.Any("error", err), slog.Int("partition", toCommit.Partition), slog.Int64("offset", toCommit.Offset))
+			}
+		}
+	}()
+
+	c.dispatch(fetchCtx, tracker, queues)
+
+	// сначала даём воркерам доработать то, что уже лежит в очередях, потом останавливаем коммиттер
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+	close(completed)
+	<-committerDone
+}
+
+func (c *Consumer) dispatch(ctx context.Context, tracker *offsetTracker, queues []chan kafka.Message) {
+	for {
+		m, err := c.fetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				c.Log.Info("kafka consumer stopping due to context cancellation")
+				return
+			}
+			c.Log.Error("failed to fetch message", slog.Any("error", err))
+			continue
+		}
+
+		tracker.add(m)
+
+		select {
+		case queues[workerIndex(m, len(queues))] <- m:
+		case <-ctx.Done():
+			// сообщение прочитано, но не обработано: оно остаётся в трекере незавершённым, поэтому его offset не закоммитится и kafka отдаст его снова
+			c.Log.Info("kafka consumer stopping due to context cancellation")
+			return
+		}
+	}
+}
+
+// workerIndex выбирает воркера по ключу сообщения, сообщения без ключа распределяются по номеру партиции
+func workerIndex(m kafka.Message, n int) int {
+	if len(m.Key) == 0 {
+		return m.Partition % n
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write(m.Key)
+	return int(h.Sum32() % uint32(n))
+}
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// offsetTracker помнит, в каком порядке сообщения каждой партиции были прочитаны, и какие из них уже обработаны
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[topicPartition]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	inFlight []int64                 // offset-ы в порядке чтения, которые ещё нельзя закоммитить
+	done     map[int64]kafka.Message // обработанные сообщения, которые ждут, пока завершатся сообщения перед ними
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[topicPartition]*partitionOffsets)}
+}
+
+func (t *offsetTracker) add(m kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := topicPartition{topic: m.Topic, partition: m.Partition}
+	p, ok := t.partitions[key]
+	if !ok {
+		p = &partitionOffsets{done: make(map[int64]kafka.Message)}
+		t.partitions[key] = p
+	}
+	p.inFlight = append(p.inFlight, m.Offset)
+}
+
+// complete отмечает сообщение обработанным и возвращает последнее сообщение непрерывного обработанного префикса партиции,
+// именно его offset и можно коммитить. false - коммитить пока нечего
+func (t *offsetTracker) complete(m kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[topicPartition{topic: m.Topic, partition: m.Partition}]
+	if !ok {
+		return kafka.Message{}, false
+	}
+	p.done[m.Offset] = m
+
+	var (
+		last  kafka.Message
+		found bool
+	)
+	for len(p.inFlight) > 0 {
+		dm, ok := p.done[p.inFlight[0]]
+		if !ok {
+			break
+		}
+		delete(p.done, p.inFlight[0])
+		p.inFlight = p.inFlight[1:]
+		last, found = dm, true
+	}
+
+	return last, found
+}
@@ -0,0 +1,248 @@
+// Схема protobuf для событий пользователя, которые kafka.Producer публикует в топик user-events.
+// Сообщение с такой схемой идёт с заголовком content-type: application/x-protobuf,
+// по этому файлу сервисы на других языках генерируют себе код и декодируют события строго по схеме.
+//
+// Go код в этой папке сгенерирован из этого файла через protoc-gen-go:
+//   protoc --go_out=. --go_opt=paths=source_relative internal/broker/kafka/eventpb/user_event.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: internal/broker/kafka/eventpb/user_event.proto
+
+package eventpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type User struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Email         string                 `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	Name          string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *User) Reset() {
+	*x = User{}
+	mi := &file_internal_broker_kafka_eventpb_user_event_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *User) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*User) ProtoMessage() {}
+
+func (x *User) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_broker_kafka_eventpb_user_event_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use User.ProtoReflect.Descriptor instead.
+func (*User) Descriptor() ([]byte, []int) {
+	return file_internal_broker_kafka_eventpb_user_event_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *User) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *User) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *User) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *User) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *User) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type UserEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`     // уникальный id события, по нему консьюмер проверяет идемпотентность
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"` // user.created, user.updated, user.deleted
+	Payload       *User                  `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserEvent) Reset() {
+	*x = UserEvent{}
+	mi := &file_internal_broker_kafka_eventpb_user_event_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserEvent) ProtoMessage() {}
+
+func (x *UserEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_broker_kafka_eventpb_user_event_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserEvent.ProtoReflect.Descriptor instead.
+func (*UserEvent) Descriptor() ([]byte, []int) {
+	return file_internal_broker_kafka_eventpb_user_event_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UserEvent) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *UserEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *UserEvent) GetPayload() *User {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *UserEvent) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+var File_internal_broker_kafka_eventpb_user_event_proto protoreflect.FileDescriptor
+
+const file_internal_broker_kafka_eventpb_user_event_proto_rawDesc = "" +
+	"\n" +
+	".internal/broker/kafka/eventpb/user_event.proto\x12\x0euser.events.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xb6\x01\n" +
+	"\x04User\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x14\n" +
+	"\x05email\x18\x02 \x01(\tR\x05email\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x129\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"\x9a\x01\n" +
+	"\tUserEvent\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12.\n" +
+	"\apayload\x18\x03 \x01(\v2\x14.user.events.v1.UserR\apayload\x129\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAtBJZHgithub.com/Derbik-Git/user-service/internal/broker/kafka/eventpb;eventpbb\x06proto3"
+
+var (
+	file_internal_broker_kafka_eventpb_user_event_proto_rawDescOnce sync.Once
+	file_internal_broker_kafka_eventpb_user_event_proto_rawDescData []byte
+)
+
+func file_internal_broker_kafka_eventpb_user_event_proto_rawDescGZIP() []byte {
+	file_internal_broker_kafka_eventpb_user_event_proto_rawDescOnce.Do(func() {
+		file_internal_broker_kafka_eventpb_user_event_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_internal_broker_kafka_eventpb_user_event_proto_rawDesc), len(file_internal_broker_kafka_eventpb_user_event_proto_rawDesc)))
+	})
+	return file_internal_broker_kafka_eventpb_user_event_proto_rawDescData
+}
+
+var file_internal_broker_kafka_eventpb_user_event_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_internal_broker_kafka_eventpb_user_event_proto_goTypes = []any{
+	(*User)(nil),                  // 0: user.events.v1.User
+	(*UserEvent)(nil),             // 1: user.events.v1.UserEvent
+	(*timestamppb.Timestamp)(nil), // 2: google.protobuf.Timestamp
+}
+var file_internal_broker_kafka_eventpb_user_event_proto_depIdxs = []int32{
+	2, // 0: user.events.v1.User.created_at:type_name -> google.protobuf.Timestamp
+	2, // 1: user.events.v1.User.updated_at:type_name -> google.protobuf.Timestamp
+	0, // 2: user.events.v1.UserEvent.payload:type_name -> user.events.v1.User
+	2, // 3: user.events.v1.UserEvent.created_at:type_name -> google.protobuf.Timestamp
+	4, // [4:4] is the sub-list for method output_type
+	4, // [4:4] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_internal_broker_kafka_eventpb_user_event_proto_init() }
+func file_internal_broker_kafka_eventpb_user_event_proto_init() {
+	if File_internal_broker_kafka_eventpb_user_event_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_broker_kafka_eventpb_user_event_proto_rawDesc), len(file_internal_broker_kafka_eventpb_user_event_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_internal_broker_kafka_eventpb_user_event_proto_goTypes,
+		DependencyIndexes: file_internal_broker_kafka_eventpb_user_event_proto_depIdxs,
+		MessageInfos:      file_internal_broker_kafka_eventpb_user_event_proto_msgTypes,
+	}.Build()
+	File_internal_broker_kafka_eventpb_user_event_proto = out.File
+	file_internal_broker_kafka_eventpb_user_event_proto_goTypes = nil
+	file_internal_broker_kafka_eventpb_user_event_proto_depIdxs = nil
+}
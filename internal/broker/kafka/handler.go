@@ -0,0 +1,55 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/segmentio/kafka-go"
+)
+
+// EventMessage - декодированное событие вместе с метаданными сообщения, из которого оно пришло
+// метаданные нужны хендлерам для логов и дедупликации (партиция + offset однозначно определяют сообщение), а заголовки - для трассировки
+type EventMessage struct {
+	Event domain.UserEvent
+
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Headers   []kafka.Header
+	Time      time.Time // время записи сообщения в kafka, а не время события (оно в Event.CreatedAt)
+}
+
+// MessageHandler - хендлер консьюмера, который получает контекст консьюмера и метаданные сообщения
+// ctx отменяется при остановке консьюмера, долгие операции хендлера должны его учитывать
+type MessageHandler func(ctx context.Context, msg EventMessage) error
+
+// AdaptHandler оборачивает старый HendlerAddEvent в MessageHandler: контекст и метаданные просто не передаются дальше
+func AdaptHandler(h HendlerAddEvent) MessageHandler {
+	if h == nil {
+		return nil
+	}
+	return func(_ context.Context, msg EventMessage) error {
+		return h(msg.Event)
+	}
+}
+
+// WithMessageHandler задаёт хендлер с контекстом и метаданными, он имеет приоритет над Consumer.Handler
+func WithMessageHandler(h MessageHandler) ConsumerOption {
+	return func(c *Consumer) {
+		c.MessageHandler = h
+	}
+}
+
+func newEventMessage(m kafka.Message, event domain.UserEvent) EventMessage {
+	return EventMessage{
+		Event:     event,
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       m.Key,
+		Headers:   m.Headers,
+		Time:      m.Time,
+	}
+}
@@ -0,0 +1,42 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// PingBrokers проверяет, что кластер kafka доступен: подключается к первому ответившему брокеру и запрашивает метаданные (список брокеров)
+// используется health проверкой, сообщения при этом не пишутся и не читаются
+func PingBrokers(ctx context.Context, brokers []string) error {
+	const op = "kafka.PingBrokers"
+
+	if len(brokers) == 0 {
+		return fmt.Errorf("%s: brokers are required", op)
+	}
+
+	var errs []error
+	for _, addr := range brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		_, err = conn.Brokers()
+		conn.Close()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%s: %w", op, errors.Join(errs...))
+}
@@ -0,0 +1,71 @@
+package mockKafka
+
+import (
+	"context"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MockKafkaReader подставляется в kafka.Consumer вместо настоящего *kafka.Reader
+// FetchMessage отдаёт сообщения из Messages по порядку, а когда они закончились - ждёт отмены контекста, как и настоящий ридер
+type MockKafkaReader struct {
+	mu          sync.Mutex
+	Messages    []kafka.Message
+	Committed   []kafka.Message // все сообщения, которые консьюмер закоммитил, в порядке вызова CommitMessages
+	CommitCalls int             // сколько раз был вызван CommitMessages
+	closed      bool
+}
+
+func (m *MockKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	m.mu.Lock()
+	if len(m.Messages) > 0 {
+		msg := m.Messages[0]
+		m.Messages = m.Messages[1:]
+		m.mu.Unlock()
+		return msg, nil
+	}
+	m.mu.Unlock()
+
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+// как и настоящий ридер, с отменённым контекстом ничего не коммитит
+func (m *MockKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Committed = append(m.Committed, msgs...)
+	m.CommitCalls++
+	return nil
+}
+
+// CommittedMessages возвращает копию закоммиченных сообщений, что бы тесты могли читать их без гонки данных
+func (m *MockKafkaReader) CommittedMessages() []kafka.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]kafka.Message(nil), m.Committed...)
+}
+
+func (m *MockKafkaReader) CommitCallsCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.CommitCalls
+}
+
+func (m *MockKafkaReader) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+func (m *MockKafkaReader) IsClosed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
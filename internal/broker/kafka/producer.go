@@ -20,20 +20,50 @@ type massageWriter interface {
 }
 
 type Producer struct {
-	KafkaWriter massageWriter // !!!!!!! поле kafkaWriter требует что бы туда положили объекты(структуру) типа massageWriter(интерфейс), который должен реализовать WriteMessage(), Close(), то есть структура, которая кладётся в структуру Producer, должна реализовывать методы WriteMessage(), Close(). Далее в функции NewProducer мы кладём в kafkaWriter струткуру Writer из библиотеки kafka(&kafka.Writer), go заглядывает в эту библиотеку и видит что такие методы эта структура реализует, таким образом проверка проходит, иоже использовать эти методы, а в тесатх подставлять свой мок
+	Mode     EventMode       // формат, в котором событие кладётся в сообщение, пустое значение = EventModeLegacy
+	Source   string          // атрибут source для CloudEvents, если пустой используется DefaultCloudEventsSource
+	Encoding PayloadEncoding // JSON или protobuf, пустое значение = EncodingJSON
+
+	DeliveryReport DeliveryReport // отчёт о доставке, задаётся через WithAsync, вызывается и для синхронной отправки
+	KafkaWriter    massageWriter  // !!!!!!! поле kafkaWriter требует что бы туда положили объекты(структуру) типа massageWriter(интерфейс), который должен реализовать WriteMessage(), Close(), то есть структура, которая кладётся в структуру Producer, должна реализовывать методы WriteMessage(), Close(). Далее в функции NewProducer мы кладём в kafkaWriter струткуру Writer из библиотеки kafka(&kafka.Writer), go заглядывает в эту библиотеку и видит что такие методы эта структура реализует, таким образом проверка проходит, иоже использовать эти методы, а в тесатх подставлять свой мок
 }
 
 // Это функция настройки продюсера, она вызывается один раз при запуске го приложения, передаются адреса kafka черверов, функция устанавливает с ними постоянное сетевое соединение(трубу) и возвращает готовый producer, который мы используем для отправки сообщений p.kafkaWriter.WriteMessages(ctx, kafka.Message{ в функции PublishUserEvent
 // передаётся: kafka.NewProducer([]string{"localhost:9091", "localhost:9092", ...}), это позволяетс продюсеру установить начальное соединение с кластером
-func NewProducer(brokers []string) *Producer {
-	return &Producer{
-		KafkaWriter: &kafka.Writer{
-			Addr:         kafka.TCP(brokers...), // принимает список адресов, по типу локалхоста, для установки начального соединения с кластером. Троеточие распаковывает элементы слайса на отдельные аргументы функции в данном случае это функция TCP
-			Balancer:     &kafka.Hash{},         // балансировщик определяет в какую партицию отправлять сообщение. !!! Если у сообщения есть ключ (Key), Kafka вычисляет хэш от этого ключа и отправляет сообщение в партицию с номером hash % N, где N — общее число партиций в топике.
-			Async:        false,                 // Этот параметр асинхронности отвечает за то, будет ли producer ждать подтверждения от брокера о том, что сообщение было сохранено и реплецированно на все оставшиеся брокеры, но в этот учёт не идёт ожидание получения сообщения об успешном получении данных со стороны другого микросервиса
-			RequiredAcks: kafka.RequireAll,      // Ждем, пока ВСЕ 3 копии (реплики) запишутся на диски
-			WriteTimeout: 10 * time.Second,      // Если за 10 сек брокер не ответил — выдаем ошибку
-		},
+// по умолчанию продюсер строго синхронный (ждём все реплики, без сжатия), для high-throughput режима см. WithAsync, WithBatch, WithCompression, WithRequiredAcks
+func NewProducer(brokers []string, opts ...ProducerOption) *Producer {
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...), // принимает список адресов, по типу локалхоста, для установки начального соединения с кластером. Троеточие распаковывает элементы слайса на отдельные аргументы функции в данном случае это функция TCP
+		Balancer:     &kafka.Hash{},         // балансировщик определяет в какую партицию отправлять сообщение. !!! Если у сообщения есть ключ (Key), Kafka вычисляет хэш от этого ключа и отправляет сообщение в партицию с номером hash % N, где N — общее число партиций в топике.
+		Async:        false,                 // Этот параметр асинхронности отвечает за то, будет ли producer ждать подтверждения от брокера о том, что сообщение было сохранено и реплецированно на все оставшиеся брокеры, но в этот учёт не идёт ожидание получения сообщения об успешном получении данных со стороны другого микросервиса
+		RequiredAcks: kafka.RequireAll,      // Ждем, пока ВСЕ 3 копии (реплики) запишутся на диски
+		WriteTimeout: 10 * time.Second,      // Если за 10 сек брокер не ответил — выдаем ошибку
+	}
+	p := &Producer{KafkaWriter: w}
+	w.Completion = p.completion // метрики доставки считаются в обоих режимах, в async режиме это единственное место, где видна ошибка
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// ProducerOption - необязательная настройка продюсера, передаётся в NewProducer
+type ProducerOption func(p *Producer)
+
+// WithCloudEvents включает отправку событий в формате CloudEvents (structured или binary) вместо legacy JSON
+func WithCloudEvents(mode EventMode, source string) ProducerOption {
+	return func(p *Producer) {
+		p.Mode = mode
+		p.Source = source
+	}
+}
+
+// WithEncoding выбирает кодировку данных события, protobuf несовместим с EventModeCloudEventsStructured
+func WithEncoding(encoding PayloadEncoding) ProducerOption {
+	return func(p *Producer) {
+		p.Encoding = encoding
 	}
 }
 
@@ -46,18 +76,60 @@ func (p *Producer) PublishUserEvent(ctx context.Context, topic string, eventType
 		CreatedAt: time.Now(),
 	}
 
-	b, err := json.Marshal(event) // в kafka все данные передаются в байтах, поэтому на стороне producer мы серелизуем структуру в JSON, а на стороне consumer мы десерелизуем эти байты обратно в структуру что бы продолжать работать с ней в го коде
+	b, headers, err := p.encode(event)
 	if err != nil {
-		return fmt.Errorf("marshall event: %w", err)
+		return err
 	}
 
-	return p.KafkaWriter.WriteMessages(ctx, kafka.Message{
-		Topic: topic,
-		Key:   []byte(strconv.FormatInt(user.ID, 10)), //(что бы операции над одним пользователем по user.ID попадали в одну партицию) таким образом переводим user.ID, который является ключом для kafka, в строку а затем в байты, потому что kafka принимает только байты
-		Value: b,
+	return p.write(ctx, kafka.Message{
+		Topic:   topic,
+		Key:     []byte(strconv.FormatInt(user.ID, 10)), //(что бы операции над одним пользователем по user.ID попадали в одну партицию) таким образом переводим user.ID, который является ключом для kafka, в строку а затем в байты, потому что kafka принимает только байты
+		Value:   b,
+		Headers: headers,
 	})
 }
 
+// encode собирает Value и заголовки сообщения в зависимости от режима продюсера
+func (p *Producer) encode(event domain.UserEvent) ([]byte, []kafka.Header, error) {
+	source := p.Source
+	if source == "" {
+		source = DefaultCloudEventsSource
+	}
+
+	encoding := p.Encoding
+	if encoding == "" {
+		encoding = EncodingJSON
+	}
+	if encoding != EncodingJSON && encoding != EncodingProtobuf {
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownEncoding, encoding)
+	}
+
+	switch p.Mode {
+	case "", EventModeLegacy:
+		headers := []kafka.Header{{Key: contentTypeHeader, Value: []byte(encoding.contentType())}}
+
+		if encoding == EncodingProtobuf {
+			b, err := marshalUserEventProto(event)
+			return b, headers, err
+		}
+
+		b, err := json.Marshal(event) // в kafka все данные передаются в байтах, поэтому на стороне producer мы серелизуем структуру в JSON, а на стороне consumer мы десерелизуем эти байты обратно в структуру что бы продолжать работать с ней в го коде
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshall event: %w", err)
+		}
+		return b, headers, nil
+	case EventModeCloudEventsStructured:
+		if encoding == EncodingProtobuf {
+			return nil, nil, ErrProtobufStructuredCloudEvents
+		}
+		return encodeCloudEventStructured(event, source)
+	case EventModeCloudEventsBinary:
+		return encodeCloudEventBinary(event, source, encoding)
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownEventMode, p.Mode)
+	}
+}
+
 func (p *Producer) Close() error {
 	return p.KafkaWriter.Close()
 }
@@ -0,0 +1,107 @@
+package kafka
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/metrics"
+	"github.com/segmentio/kafka-go"
+)
+
+// DeliveryReport вызывается writer-ом после каждой попытки записать пачку сообщений в партицию, err != nil - пачка не записана
+// вызывается из горутин writer-а, поэтому должен быть быстрым и потокобезопасным, паника в нём роняет процесс
+type DeliveryReport func(messages []kafka.Message, err error)
+
+// Все опции ниже настраивают *kafka.Writer, который создаёт NewProducer.
+// Если в KafkaWriter лежит что-то другое (мок, memory брокер), опции ничего не делают
+
+// WithCompression включает сжатие пачек сообщений, 0 - без сжатия
+func WithCompression(codec kafka.Compression) ProducerOption {
+	return func(p *Producer) {
+		if w := p.writer(); w != nil {
+			w.Compression = codec
+		}
+	}
+}
+
+// WithBatch задаёт размер пачки и сколько writer ждёт её добора, нулевые значения оставляют настройки kafka-go по умолчанию (100 сообщений, 1s)
+// в синхронном режиме каждый PublishUserEvent ждёт добора пачки, поэтому большой timeout там увеличивает время ответа сервиса
+func WithBatch(size int, timeout time.Duration) ProducerOption {
+	return func(p *Producer) {
+		w := p.writer()
+		if w == nil {
+			return
+		}
+		if size > 0 {
+			w.BatchSize = size
+		}
+		if timeout > 0 {
+			w.BatchTimeout = timeout
+		}
+	}
+}
+
+// WithRequiredAcks задаёт, подтверждения скольких реплик ждать: RequireAll (по умолчанию), RequireOne или RequireNone
+func WithRequiredAcks(acks kafka.RequiredAcks) ProducerOption {
+	return func(p *Producer) {
+		if w := p.writer(); w != nil {
+			w.RequiredAcks = acks
+		}
+	}
+}
+
+// WithAsync включает асинхронную отправку: PublishUserEvent возвращается сразу, не дожидаясь брокера,
+// а результат доставки приходит в report (может быть nil, доставка всё равно считается в метриках)
+// Так сервис быстрее отвечает клиенту, но событие может потеряться без ошибки в ответе, это и есть цена high-throughput режима
+func WithAsync(report DeliveryReport) ProducerOption {
+	return func(p *Producer) {
+		if w := p.writer(); w != nil {
+			w.Async = true
+		}
+		p.DeliveryReport = report
+	}
+}
+
+// ParseCompression разбирает имя кодека: none, gzip, snappy, lz4, zstd
+func ParseCompression(s string) (kafka.Compression, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	var c kafka.Compression
+	if err := c.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown compression codec %q: %w", s, err)
+	}
+	return c, nil
+}
+
+// ParseRequiredAcks разбирает уровень подтверждений: all, one, none
+func ParseRequiredAcks(s string) (kafka.RequiredAcks, error) {
+	if s == "" {
+		return kafka.RequireAll, nil
+	}
+
+	var acks kafka.RequiredAcks
+	if err := acks.UnmarshalText([]byte(s)); err != nil {
+		return 0, err
+	}
+	return acks, nil
+}
+
+// writer возвращает настоящий *kafka.Writer продюсера или nil, если KafkaWriter подменён
+func (p *Producer) writer() *kafka.Writer {
+	w, _ := p.KafkaWriter.(*kafka.Writer)
+	return w
+}
+
+// completion - отчёт о доставке, который writer вызывает и в синхронном, и в асинхронном режиме:
+// считает доставленные и потерянные сообщения в метриках и передаёт отчёт дальше в DeliveryReport
+func (p *Producer) completion(messages []kafka.Message, err error) {
+	if len(messages) > 0 {
+		metrics.ObserveKafkaDelivery(messages[0].Topic, len(messages), err) // все сообщения одного вызова лежат в одной партиции одного топика
+	}
+
+	if p.DeliveryReport != nil {
+		p.DeliveryReport(messages, err)
+	}
+}
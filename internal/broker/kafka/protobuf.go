@@ -0,0 +1,128 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Derbik-Git/user-service/internal/broker/kafka/eventpb"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// PayloadEncoding - в чём сериализуются данные события: JSON (по умолчанию) или protobuf по схеме eventpb/user_event.proto
+// кодировка всегда записывается в заголовок content-type, по нему консьюмер и понимает, как декодировать сообщение
+type PayloadEncoding string
+
+const (
+	EncodingJSON     PayloadEncoding = "json"
+	EncodingProtobuf PayloadEncoding = "protobuf"
+
+	contentTypeProtobuf = "application/x-protobuf"
+)
+
+var (
+	ErrUnknownEncoding = errors.New("unknown payload encoding")
+
+	// structured CloudEvent - это JSON документ, положить туда protobuf нельзя, для protobuf нужен binary режим
+	ErrProtobufStructuredCloudEvents = errors.New("protobuf encoding is not supported in cloudevents structured mode")
+)
+
+func ParsePayloadEncoding(s string) (PayloadEncoding, error) {
+	switch PayloadEncoding(s) {
+	case "", EncodingJSON:
+		return EncodingJSON, nil
+	case EncodingProtobuf:
+		return EncodingProtobuf, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownEncoding, s)
+	}
+}
+
+func (e PayloadEncoding) contentType() string {
+	if e == EncodingProtobuf {
+		return contentTypeProtobuf
+	}
+	return contentTypeJSON
+}
+
+func isProtobufContentType(ct string) bool {
+	return strings.HasPrefix(ct, contentTypeProtobuf)
+}
+
+func userToProto(u domain.User) *eventpb.User {
+	pb := &eventpb.User{
+		Id:    u.ID,
+		Email: u.Email,
+		Name:  u.Name,
+	}
+	if !u.CreatedAt.IsZero() {
+		pb.CreatedAt = timestamppb.New(u.CreatedAt)
+	}
+	if !u.UpdatedAt.IsZero() {
+		pb.UpdatedAt = timestamppb.New(u.UpdatedAt)
+	}
+	return pb
+}
+
+func userFromProto(pb *eventpb.User) domain.User {
+	u := domain.User{
+		ID:    pb.GetId(),
+		Email: pb.GetEmail(),
+		Name:  pb.GetName(),
+	}
+	if pb.GetCreatedAt() != nil {
+		u.CreatedAt = pb.GetCreatedAt().AsTime()
+	}
+	if pb.GetUpdatedAt() != nil {
+		u.UpdatedAt = pb.GetUpdatedAt().AsTime()
+	}
+	return u
+}
+
+func marshalUserEventProto(event domain.UserEvent) ([]byte, error) {
+	b, err := proto.Marshal(&eventpb.UserEvent{
+		Id:        event.ID,
+		Type:      event.Type,
+		Payload:   userToProto(event.Payload),
+		CreatedAt: timestamppb.New(event.CreatedAt),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshall event proto: %w", err)
+	}
+	return b, nil
+}
+
+func unmarshalUserEventProto(b []byte) (domain.UserEvent, error) {
+	var pb eventpb.UserEvent
+	if err := proto.Unmarshal(b, &pb); err != nil {
+		return domain.UserEvent{}, fmt.Errorf("unmarshall event proto: %w", err)
+	}
+
+	event := domain.UserEvent{
+		ID:      pb.GetId(),
+		Type:    pb.GetType(),
+		Payload: userFromProto(pb.GetPayload()),
+	}
+	if pb.GetCreatedAt() != nil {
+		event.CreatedAt = pb.GetCreatedAt().AsTime()
+	}
+	return event, nil
+}
+
+func marshalUserProto(u domain.User) ([]byte, error) {
+	b, err := proto.Marshal(userToProto(u))
+	if err != nil {
+		return nil, fmt.Errorf("marshall user proto: %w", err)
+	}
+	return b, nil
+}
+
+func unmarshalUserProto(b []byte) (domain.User, error) {
+	var pb eventpb.User
+	if err := proto.Unmarshal(b, &pb); err != nil {
+		return domain.User{}, fmt.Errorf("unmarshall user proto: %w", err)
+	}
+	return userFromProto(&pb), nil
+}
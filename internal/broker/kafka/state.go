@@ -0,0 +1,129 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/segmentio/kafka-go"
+)
+
+// Топик user-state - это не лог изменений, а текущее состояние: ключ сообщения = id пользователя, значение = пользователь целиком
+// Топик создаётся с cleanup.policy=compact, поэтому kafka со временем оставляет только последнее сообщение по каждому ключу,
+// а удалённый пользователь - это tombstone (сообщение с пустым Value), которое после delete.retention.ms удаляется совсем.
+// Консьюмеру, которому нужен текущий набор пользователей, достаточно прочитать user-state с начала, а не переигрывать весь user-events
+
+// PublishUserState публикует актуальное состояние пользователя в compacted топик, кодировка Value та же, что и у событий (JSON или protobuf)
+func (p *Producer) PublishUserState(ctx context.Context, topic string, user *domain.User) error {
+	encoding := p.Encoding
+	if encoding == "" {
+		encoding = EncodingJSON
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+	switch encoding {
+	case EncodingJSON:
+		b, err = json.Marshal(user)
+		if err != nil {
+			return fmt.Errorf("marshall user state: %w", err)
+		}
+	case EncodingProtobuf:
+		b, err = marshalUserProto(*user)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownEncoding, encoding)
+	}
+
+	return p.write(ctx, kafka.Message{
+		Topic:   topic,
+		Key:     stateKey(user.ID),
+		Value:   b,
+		Headers: []kafka.Header{{Key: contentTypeHeader, Value: []byte(encoding.contentType())}},
+	})
+}
+
+// DeleteUserState публикует tombstone: сообщение с ключом пользователя и nil в Value, по нему compaction удалит пользователя из топика
+func (p *Producer) DeleteUserState(ctx context.Context, topic string, id int64) error {
+	return p.write(ctx, kafka.Message{
+		Topic: topic,
+		Key:   stateKey(id),
+		Value: nil,
+	})
+}
+
+// DecodeUserState разбирает сообщение из user-state, deleted = true для tombstone (тогда у пользователя заполнен только ID из ключа)
+func DecodeUserState(m kafka.Message) (user domain.User, deleted bool, err error) {
+	if m.Value == nil {
+		id, err := strconv.ParseInt(string(m.Key), 10, 64)
+		if err != nil {
+			return domain.User{}, false, fmt.Errorf("parse tombstone key %q: %w", m.Key, err)
+		}
+		return domain.User{ID: id}, true, nil
+	}
+
+	ct, _ := headerValue(m.Headers, contentTypeHeader)
+	if isProtobufContentType(ct) {
+		user, err = unmarshalUserProto(m.Value)
+		return user, false, err
+	}
+
+	if err := json.Unmarshal(m.Value, &user); err != nil {
+		return domain.User{}, false, fmt.Errorf("unmarshall user state: %w", err)
+	}
+	return user, false, nil
+}
+
+func stateKey(id int64) []byte {
+	return []byte(strconv.FormatInt(id, 10)) // тот же ключ, что и у user-events, иначе compaction не найдёт предыдущее состояние
+}
+
+// EnsureStateTopic создаёт compacted топик для состояния пользователей, если его ещё нет
+// создавать топик на старте удобно локально и в тестах, в проде его обычно заводят заранее вместе с остальной инфраструктурой
+func EnsureStateTopic(ctx context.Context, brokers []string, topic string, partitions, replicationFactor int) error {
+	const op = "kafka.EnsureStateTopic"
+
+	if len(brokers) == 0 {
+		return fmt.Errorf("%s: brokers are required", op)
+	}
+
+	conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	// топики создаёт только контроллер кластера
+	controller, err := conn.Controller()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	ctrlConn, err := kafka.DialContext(ctx, "tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer ctrlConn.Close()
+
+	err = ctrlConn.CreateTopics(kafka.TopicConfig{
+		Topic:             topic,
+		NumPartitions:     partitions,
+		ReplicationFactor: replicationFactor,
+		ConfigEntries: []kafka.ConfigEntry{
+			{ConfigName: "cleanup.policy", ConfigValue: "compact"},
+		},
+	})
+	if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package kafkaTest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/broker/kafka"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/service/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncCacheMock - CacheMock с tombstone-ами удалённых пользователей
+type syncCacheMock struct {
+	*mocks.CacheMock
+
+	tombstone    time.Time  // что вернёт UserTombstone
+	setTombstone *time.Time // что записал SetUserTombstone
+}
+
+func (m *syncCacheMock) SetUserTombstone(_ context.Context, _ int64, version time.Time, _ time.Duration) error {
+	m.setTombstone = &version
+	return nil
+}
+
+func (m *syncCacheMock) UserTombstone(context.Context, int64) (time.Time, error) {
+	return m.tombstone, nil
+}
+
+func TestCacheSyncHandler(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	cachedUser := &domain.User{ID: 1, Email: "cached@email.com", Name: "Cached", UpdatedAt: now}
+
+	tests := []struct {
+		nameTest    string
+		event       domain.UserEvent
+		cached      *domain.User
+		tombstone   time.Time
+		wantSet     bool
+		wantDeleted bool
+	}{
+		{
+			nameTest: "created: user not in cache",
+			event:    domain.UserEvent{Type: domain.UserCreated, Payload: domain.User{ID: 1, Email: "new@email.com", UpdatedAt: now}},
+			cached:   nil,
+			wantSet:  true,
+		},
+		{
+			nameTest: "updated: event newer than cache",
+			event:    domain.UserEvent{Type: domain.UserUpdated, Payload: domain.User{ID: 1, Email: "newer@email.com", UpdatedAt: now.Add(time.Second)}},
+			cached:   cachedUser,
+			wantSet:  true,
+		},
+		{
+			nameTest: "updated: stale event is ignored",
+			event:    domain.UserEvent{Type: domain.UserUpdated, Payload: domain.User{ID: 1, Email: "old@email.com", UpdatedAt: now.Add(-time.Minute)}},
+			cached:   cachedUser,
+			wantSet:  false,
+		},
+		{
+			nameTest:    "deleted",
+			event:       domain.UserEvent{Type: domain.UserDeleted, Payload: domain.User{ID: 1}, CreatedAt: now},
+			cached:      cachedUser,
+			wantDeleted: true,
+		},
+		{
+			nameTest:  "created: late event after delete is ignored",
+			event:     domain.UserEvent{Type: domain.UserCreated, Payload: domain.User{ID: 1, Email: "new@email.com", UpdatedAt: now.Add(-time.Minute)}},
+			cached:    nil,
+			tombstone: now,
+			wantSet:   false,
+		},
+		{
+			nameTest:  "updated: redelivered event after delete is ignored",
+			event:     domain.UserEvent{Type: domain.UserUpdated, Payload: domain.User{ID: 1, Email: "old@email.com", UpdatedAt: now}},
+			cached:    nil,
+			tombstone: now,
+			wantSet:   false,
+		},
+		{
+			// часы базы (UpdatedAt) впереди часов приложения (время удаления): время не сравниваем, id после удаления не переиспользуется
+			nameTest:  "updated: event after tombstone by skewed clock is ignored",
+			event:     domain.UserEvent{Type: domain.UserUpdated, Payload: domain.User{ID: 1, Email: "newer@email.com", UpdatedAt: now.Add(time.Minute)}},
+			cached:    nil,
+			tombstone: now,
+			wantSet:   false,
+		},
+		{
+			nameTest: "unknown event type",
+			event:    domain.UserEvent{Type: "user.something", Payload: domain.User{ID: 1}},
+			cached:   cachedUser,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.nameTest, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				setUser *domain.User
+				deleted bool
+			)
+			cacheMock := &syncCacheMock{tombstone: tt.tombstone, CacheMock: &mocks.CacheMock{
+				GetUserFunc: func(ctx context.Context, id int64) (*domain.User, error) {
+					return tt.cached, nil
+				},
+				SetUserFunc: func(ctx context.Context, u *domain.User, ttl time.Duration) error {
+					setUser = u
+					return nil
+				},
+				DeleteUserFunc: func(ctx context.Context, id int64) error {
+					deleted = true
+					return nil
+				},
+			}}
+
+			handler := kafka.NewCacheSyncHandler(cacheMock, time.Minute, nil)
+			require.NoError(t, handler(context.Background(), kafka.EventMessage{Event: tt.event}))
+
+			if tt.wantSet {
+				require.NotNil(t, setUser, "ожидалось, что пользователь из события попадёт в кеш")
+				assert.Equal(t, tt.event.Payload.Email, setUser.Email)
+			} else {
+				assert.Nil(t, setUser, "кеш не должен был перезаписываться")
+			}
+			assert.Equal(t, tt.wantDeleted, deleted)
+			if tt.wantDeleted {
+				require.NotNil(t, cacheMock.setTombstone, "удаление должно оставлять tombstone")
+				assert.True(t, tt.event.CreatedAt.Equal(*cacheMock.setTombstone), "в tombstone - время события удаления")
+			} else {
+				assert.Nil(t, cacheMock.setTombstone)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package kafkaTest
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/broker/kafka"
+	mockKafka "github.com/Derbik-Git/user-service/internal/broker/kafka/mock"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func headerValue(t *testing.T, m *mockKafka.MockKafkaWriter, key string) string {
+	t.Helper()
+	for _, h := range m.CapturedMessage.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	t.Fatalf("заголовок %s не найден в сообщении", key)
+	return ""
+}
+
+// прогоняем событие через продюсер в каждом из режимов и проверяем, что консьюмер достаёт из него то же самое событие
+func TestCloudEvents_ProducerConsumerRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	modes := []kafka.EventMode{
+		kafka.EventModeLegacy,
+		kafka.EventModeCloudEventsStructured,
+		kafka.EventModeCloudEventsBinary,
+	}
+
+	for _, mode := range modes {
+		mode := mode
+		t.Run(string(mode), func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+
+			mockWriter := &mockKafka.MockKafkaWriter{}
+			producer := &kafka.Producer{
+				Mode:        mode,
+				Source:      "/user-service-test",
+				KafkaWriter: mockWriter,
+			}
+
+			user := &domain.User{ID: 42, Email: "ce@example.com", Name: "CloudEvents"}
+			require.NoError(t, producer.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserUpdated, user))
+
+			mockHandler := &mockKafka.MockConsumerHandler{}
+			consumer := &kafka.Consumer{
+				Log:     slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				Handler: mockHandler.HendlerAddEvent,
+			}
+
+			require.NoError(t, consumer.ProcessMessage(ctx, mockWriter.CapturedMessage))
+			require.True(t, mockHandler.IsCalled)
+
+			assert.NotEmpty(t, mockHandler.ReceivedEvent.ID)
+			assert.Equal(t, domain.UserUpdated, mockHandler.ReceivedEvent.Type)
+			assert.Equal(t, *user, mockHandler.ReceivedEvent.Payload)
+			assert.False(t, mockHandler.ReceivedEvent.CreatedAt.IsZero())
+		})
+	}
+}
+
+func TestCloudEvents_BinaryHeaders(t *testing.T) {
+	t.Parallel()
+
+	mockWriter := &mockKafka.MockKafkaWriter{}
+	producer := kafka.NewProducer(nil, kafka.WithCloudEvents(kafka.EventModeCloudEventsBinary, "/user-service-test"))
+	producer.KafkaWriter = mockWriter
+
+	err := producer.PublishUserEvent(context.Background(), domain.TopicUserEvents, domain.UserCreated, &domain.User{ID: 7})
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.0", headerValue(t, mockWriter, "ce_specversion"))
+	assert.Equal(t, "/user-service-test", headerValue(t, mockWriter, "ce_source"))
+	assert.Equal(t, domain.UserCreated, headerValue(t, mockWriter, "ce_type"))
+	assert.Equal(t, "7", headerValue(t, mockWriter, "ce_subject"))
+	assert.NotEmpty(t, headerValue(t, mockWriter, "ce_id"))
+	assert.NotEmpty(t, headerValue(t, mockWriter, "ce_time"))
+	assert.Equal(t, "application/json", headerValue(t, mockWriter, "content-type"))
+
+	// в binary режиме в Value лежат только данные пользователя
+	var payload domain.User
+	require.NoError(t, json.Unmarshal(mockWriter.CapturedMessage.Value, &payload))
+	assert.Equal(t, int64(7), payload.ID)
+}
+
+// structured событие должно распознаваться даже без заголовков, по одному Value
+func TestCloudEvents_StructuredWithoutHeaders(t *testing.T) {
+	t.Parallel()
+
+	value := []byte(`{"specversion":"1.0","id":"ce-1","source":"/other","type":"user.deleted","time":"2024-01-02T03:04:05Z","subject":"5","datacontenttype":"application/json","data":{"ID":5}}`)
+
+	event, err := kafka.DecodeUserEvent(kafkago.Message{Value: value})
+	require.NoError(t, err)
+
+	assert.Equal(t, "ce-1", event.ID)
+	assert.Equal(t, domain.UserDeleted, event.Type)
+	assert.Equal(t, int64(5), event.Payload.ID)
+	assert.Equal(t, 2024, event.CreatedAt.Year())
+}
+
+// protobuf событие должно декодироваться консьюмером автоматически, по заголовку content-type
+func TestProtobuf_ProducerConsumerRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	modes := []kafka.EventMode{
+		kafka.EventModeLegacy,
+		kafka.EventModeCloudEventsBinary,
+	}
+
+	for _, mode := range modes {
+		mode := mode
+		t.Run(string(mode), func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+
+			mockWriter := &mockKafka.MockKafkaWriter{}
+			producer := &kafka.Producer{
+				Mode:        mode,
+				Encoding:    kafka.EncodingProtobuf,
+				KafkaWriter: mockWriter,
+			}
+
+			user := &domain.User{ID: 11, Email: "pb@example.com", Name: "Protobuf", CreatedAt: time.Now().UTC().Truncate(time.Microsecond)}
+			require.NoError(t, producer.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserCreated, user))
+			assert.Equal(t, "application/x-protobuf", headerValue(t, mockWriter, "content-type"))
+
+			// protobuf это не JSON, значит старый способ декодирования тут не сработает
+			require.False(t, json.Valid(mockWriter.CapturedMessage.Value))
+
+			event, err := kafka.DecodeUserEvent(mockWriter.CapturedMessage)
+			require.NoError(t, err)
+
+			assert.NotEmpty(t, event.ID)
+			assert.Equal(t, domain.UserCreated, event.Type)
+			assert.Equal(t, *user, event.Payload)
+		})
+	}
+}
+
+func TestProtobuf_StructuredCloudEventsNotSupported(t *testing.T) {
+	t.Parallel()
+
+	producer := &kafka.Producer{
+		Mode:        kafka.EventModeCloudEventsStructured,
+		Encoding:    kafka.EncodingProtobuf,
+		KafkaWriter: &mockKafka.MockKafkaWriter{},
+	}
+
+	err := producer.PublishUserEvent(context.Background(), domain.TopicUserEvents, domain.UserCreated, &domain.User{ID: 1})
+	require.ErrorIs(t, err, kafka.ErrProtobufStructuredCloudEvents)
+}
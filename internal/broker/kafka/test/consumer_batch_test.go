@@ -0,0 +1,116 @@
+package kafkaTest
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/broker/kafka"
+	mockKafka "github.com/Derbik-Git/user-service/internal/broker/kafka/mock"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runConsumerUntil(t *testing.T, consumer *kafka.Consumer, done <-chan struct{}) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		consumer.StartKafkaConsumer(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("консьюмер не успел обработать сообщения")
+	}
+	cancel()
+	<-stopped
+}
+
+func TestConsumer_Batch_SizeAndWait(t *testing.T) {
+	t.Parallel()
+
+	msgs := workerTestMessages(t, 2) // 10 сообщений
+	reader := &mockKafka.MockKafkaReader{Messages: msgs}
+
+	var (
+		mu    sync.Mutex
+		sizes []int
+		total int
+	)
+	done := make(chan struct{})
+
+	consumer := &kafka.Consumer{
+		KafkaReader: reader,
+		Log:         slog.New(slog.NewTextHandler(os.Stdout, nil)),
+	}
+	kafka.WithBatchHandler(func(ctx context.Context, events []domain.UserEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sizes = append(sizes, len(events))
+		total += len(events)
+		if total == len(msgs) {
+			close(done)
+		}
+		return nil
+	}, 4, 30*time.Millisecond)(consumer)
+
+	runConsumerUntil(t, consumer, done)
+
+	// последняя пачка неполная: её отдали хендлеру по истечении BatchWait
+	assert.Equal(t, []int{4, 4, 2}, sizes)
+	assert.Equal(t, 3, reader.CommitCallsCount(), "offset-ы должны коммититься один раз на пачку")
+	assert.Len(t, reader.CommittedMessages(), len(msgs))
+}
+
+func TestConsumer_Batch_PartialFailure(t *testing.T) {
+	t.Parallel()
+
+	msgs := workerTestMessages(t, 1)[:5]
+	reader := &mockKafka.MockKafkaReader{Messages: msgs}
+	done := make(chan struct{})
+
+	consumer := &kafka.Consumer{
+		KafkaReader: reader,
+		Log:         slog.New(slog.NewTextHandler(os.Stdout, nil)),
+	}
+	kafka.WithBatchHandler(func(ctx context.Context, events []domain.UserEvent) error {
+		defer close(done)
+		require.Len(t, events, 5)
+		return &kafka.BatchError{Processed: 3, Err: errors.New("db is down")}
+	}, 5, time.Second)(consumer)
+
+	runConsumerUntil(t, consumer, done)
+
+	committed := reader.CommittedMessages()
+	require.Len(t, committed, 3, "коммитятся только обработанные события")
+	assert.Equal(t, msgs[:3], committed)
+}
+
+func TestConsumer_Batch_HandlerErrorCommitsNothing(t *testing.T) {
+	t.Parallel()
+
+	reader := &mockKafka.MockKafkaReader{Messages: workerTestMessages(t, 1)}
+	done := make(chan struct{})
+
+	consumer := &kafka.Consumer{
+		KafkaReader: reader,
+		Log:         slog.New(slog.NewTextHandler(os.Stdout, nil)),
+	}
+	kafka.WithBatchHandler(func(ctx context.Context, events []domain.UserEvent) error {
+		close(done)
+		return errors.New("db is down")
+	}, 5, time.Second)(consumer)
+
+	runConsumerUntil(t, consumer, done)
+
+	assert.Empty(t, reader.CommittedMessages())
+}
@@ -0,0 +1,108 @@
+package kafkaTest
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/broker/kafka"
+	mockKafka "github.com/Derbik-Git/user-service/internal/broker/kafka/mock"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lifecycleTestMessage(t *testing.T) kafkago.Message {
+	t.Helper()
+
+	value, err := json.Marshal(domain.UserEvent{ID: "evt", Type: domain.UserUpdated, Payload: domain.User{ID: 1}})
+	require.NoError(t, err)
+	return kafkago.Message{Topic: domain.TopicUserEvents, Partition: 0, Offset: 3, Value: value}
+}
+
+// Shutdown ждёт, пока хендлер доработает, и коммитит его сообщение, контекст хендлера при этом не отменяется
+func TestConsumer_Shutdown_FinishesInFlightMessage(t *testing.T) {
+	t.Parallel()
+
+	reader := &mockKafka.MockKafkaReader{Messages: []kafkago.Message{lifecycleTestMessage(t)}}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	consumer := &kafka.Consumer{KafkaReader: reader, Log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+	kafka.WithMessageHandler(func(ctx context.Context, msg kafka.EventMessage) error {
+		close(started)
+		<-release
+		return ctx.Err()
+	})(consumer)
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- consumer.Run(context.Background()) }()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr <- consumer.Shutdown(ctx)
+	}()
+
+	select {
+	case <-shutdownErr:
+		t.Fatal("Shutdown не должен возвращаться, пока хендлер работает")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	require.NoError(t, <-shutdownErr)
+	require.NoError(t, <-runErr)
+
+	committed := reader.CommittedMessages()
+	require.Len(t, committed, 1)
+	assert.Equal(t, int64(3), committed[0].Offset)
+	assert.True(t, reader.IsClosed())
+}
+
+// если хендлер не успел до дедлайна, его контекст отменяется, а сообщение не коммитится, что бы kafka отдала его снова
+func TestConsumer_Shutdown_DeadlineAbortsHandler(t *testing.T) {
+	t.Parallel()
+
+	reader := &mockKafka.MockKafkaReader{Messages: []kafkago.Message{lifecycleTestMessage(t)}}
+
+	started := make(chan struct{})
+	consumer := &kafka.Consumer{KafkaReader: reader, Log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+	kafka.WithMessageHandler(func(ctx context.Context, msg kafka.EventMessage) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})(consumer)
+
+	go func() { _ = consumer.Run(context.Background()) }()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := consumer.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.Empty(t, reader.CommittedMessages())
+	assert.True(t, reader.IsClosed())
+}
+
+func TestConsumer_RunAfterShutdown(t *testing.T) {
+	t.Parallel()
+
+	reader := &mockKafka.MockKafkaReader{}
+	consumer := &kafka.Consumer{KafkaReader: reader, Log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+	require.NoError(t, consumer.Shutdown(context.Background()))
+	require.NoError(t, consumer.Shutdown(context.Background()), "повторный Shutdown безопасен")
+
+	assert.ErrorIs(t, consumer.Run(context.Background()), kafka.ErrConsumerClosed)
+	assert.True(t, reader.IsClosed())
+}
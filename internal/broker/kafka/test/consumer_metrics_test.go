@@ -0,0 +1,138 @@
+package kafkaTest
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/broker/kafka"
+	mockKafka "github.com/Derbik-Git/user-service/internal/broker/kafka/mock"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumer_Health(t *testing.T) {
+	t.Parallel()
+
+	event, err := json.Marshal(domain.UserEvent{ID: "1", Type: domain.UserCreated, Payload: domain.User{ID: 1}})
+	require.NoError(t, err)
+
+	reader := &mockKafka.MockKafkaReader{Messages: []kafkago.Message{{Topic: "health-topic", Value: event}}}
+	done := make(chan struct{})
+
+	consumer := &kafka.Consumer{
+		KafkaReader: reader,
+		Log:         slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		Handler: func(event domain.UserEvent) error {
+			close(done)
+			return nil
+		},
+	}
+	kafka.WithHealthInterval(50 * time.Millisecond)(consumer)
+
+	require.ErrorIs(t, consumer.Health(), kafka.ErrConsumerNotStarted)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go consumer.StartKafkaConsumer(ctx)
+
+	<-done
+	assert.NoError(t, consumer.Health())
+
+	// больше сообщений нет, а лаг мок-ридер не отдаёт - через HealthInterval консьюмер считается зависшим
+	require.Eventually(t, func() bool {
+		return consumer.Health() != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.ErrorIs(t, consumer.Health(), kafka.ErrConsumerStuck)
+}
+
+func TestConsumer_Health_DisabledByDefaultInLiteral(t *testing.T) {
+	t.Parallel()
+
+	consumer := &kafka.Consumer{KafkaReader: &mockKafka.MockKafkaReader{}}
+	assert.NoError(t, consumer.Health())
+}
+
+func TestConsumer_ProcessMessage_Metrics(t *testing.T) {
+	t.Parallel()
+
+	const topic = "metrics-topic"
+
+	consumer := &kafka.Consumer{
+		Log:     slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		Handler: func(event domain.UserEvent) error { return nil },
+	}
+
+	event, err := json.Marshal(domain.UserEvent{ID: "1", Type: domain.UserUpdated, Payload: domain.User{ID: 1}})
+	require.NoError(t, err)
+
+	successLabels := map[string]string{"topic": topic, "event_type": domain.UserUpdated, "status": "success"}
+	decodeErrLabels := map[string]string{"topic": topic, "event_type": "unknown", "status": "decode_error"}
+	successBefore := counterValue(t, "kafka_consumer_messages_total", successLabels)
+	decodeErrBefore := counterValue(t, "kafka_consumer_messages_total", decodeErrLabels)
+
+	require.NoError(t, consumer.ProcessMessage(context.Background(), kafkago.Message{Topic: topic, Value: event}))
+	require.Error(t, consumer.ProcessMessage(context.Background(), kafkago.Message{Topic: topic, Value: []byte("{broken")}))
+
+	// счётчики глобальные и переживают -count=N, поэтому сравниваем прирост
+	assert.Equal(t, successBefore+1, counterValue(t, "kafka_consumer_messages_total", successLabels))
+	assert.Equal(t, decodeErrBefore+1, counterValue(t, "kafka_consumer_messages_total", decodeErrLabels))
+
+	n, err := testutil.GatherAndCount(prometheus.DefaultGatherer, "kafka_consumer_handler_duration_seconds")
+	require.NoError(t, err)
+	assert.Positive(t, n)
+}
+
+// тип события приходит из сообщения, в лейбл event_type попадают только известные типы, иначе число серий не ограничено
+func TestConsumer_ProcessMessage_UnknownEventTypeLabel(t *testing.T) {
+	t.Parallel()
+
+	const topic = "metrics-unknown-type-topic"
+
+	consumer := &kafka.Consumer{
+		Log:     slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		Handler: func(event domain.UserEvent) error { return nil },
+	}
+
+	event, err := json.Marshal(domain.UserEvent{ID: "1", Type: "user.whatever-42", Payload: domain.User{ID: 1}})
+	require.NoError(t, err)
+
+	unknownLabels := map[string]string{"topic": topic, "event_type": "unknown", "status": "success"}
+	before := counterValue(t, "kafka_consumer_messages_total", unknownLabels)
+
+	require.NoError(t, consumer.ProcessMessage(context.Background(), kafkago.Message{Topic: topic, Value: event}))
+
+	assert.Equal(t, before+1, counterValue(t, "kafka_consumer_messages_total", unknownLabels))
+	assert.Zero(t, counterValue(t, "kafka_consumer_messages_total", map[string]string{"topic": topic, "event_type": "user.whatever-42"}))
+}
+
+// counterValue достаёт значение счётчика с нужными ярлыками из глобального реестра prometheus
+func counterValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	metricLoop:
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if v, ok := labels[l.GetName()]; ok && v != l.GetValue() {
+					continue metricLoop
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
@@ -0,0 +1,167 @@
+package kafkaTest
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/broker/kafka"
+	mockKafka "github.com/Derbik-Git/user-service/internal/broker/kafka/mock"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// собираем сообщения так, как их бы отдал ридер: 2 партиции, в каждой несколько пользователей вперемешку
+func workerTestMessages(t *testing.T, perUser int) []kafkago.Message {
+	t.Helper()
+
+	users := [][]int64{{1, 3, 5}, {2, 4}} // индекс = партиция, значения = пользователи, которые в неё попадают
+	offsets := map[int]int64{}
+
+	var msgs []kafkago.Message
+	for seq := 0; seq < perUser; seq++ {
+		for partition, ids := range users {
+			for _, id := range ids {
+				b, err := json.Marshal(domain.UserEvent{
+					ID:      strconv.Itoa(seq),
+					Type:    domain.UserUpdated,
+					Payload: domain.User{ID: id},
+				})
+				require.NoError(t, err)
+
+				msgs = append(msgs, kafkago.Message{
+					Topic:     domain.TopicUserEvents,
+					Partition: partition,
+					Offset:    offsets[partition],
+					Key:       []byte(strconv.FormatInt(id, 10)),
+					Value:     b,
+				})
+				offsets[partition]++
+			}
+		}
+	}
+	return msgs
+}
+
+func TestConsumer_Workers_PreservePerUserOrderAndCommitInOrder(t *testing.T) {
+	t.Parallel()
+
+	const perUser = 20
+	msgs := workerTestMessages(t, perUser)
+	reader := &mockKafka.MockKafkaReader{Messages: msgs}
+
+	var (
+		mu       sync.Mutex
+		received = map[int64][]string{} // user ID -> id событий в порядке обработки
+		total    int
+	)
+	allDone := make(chan struct{})
+
+	handler := func(event domain.UserEvent) error {
+		time.Sleep(time.Duration(rand.Intn(300)) * time.Microsecond) // воркеры работают с разной скоростью
+
+		mu.Lock()
+		defer mu.Unlock()
+		received[event.Payload.ID] = append(received[event.Payload.ID], event.ID)
+		total++
+		if total == len(msgs) {
+			close(allDone)
+		}
+		return nil
+	}
+
+	consumer := &kafka.Consumer{
+		KafkaReader: reader,
+		Log:         slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		Handler:     handler,
+	}
+	kafka.WithConcurrency(4)(consumer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		consumer.StartKafkaConsumer(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case <-allDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("консьюмер не обработал все сообщения")
+	}
+	cancel()
+	<-stopped
+
+	// события одного пользователя пришли в хендлер строго в том порядке, в котором лежали в партиции
+	for id, events := range received {
+		require.Len(t, events, perUser, "user %d", id)
+		for seq, eventID := range events {
+			assert.Equal(t, strconv.Itoa(seq), eventID, "user %d", id)
+		}
+	}
+
+	// коммиты внутри партиции только растут, и в конце закоммичено последнее сообщение каждой партиции
+	last := map[int]int64{}
+	for _, m := range reader.CommittedMessages() {
+		if prev, ok := last[m.Partition]; ok {
+			assert.Greater(t, m.Offset, prev)
+		}
+		last[m.Partition] = m.Offset
+	}
+	assert.Equal(t, int64(3*perUser-1), last[0])
+	assert.Equal(t, int64(2*perUser-1), last[1])
+}
+
+// пока медленное сообщение не обработано, offset-ы после него в той же партиции коммитить нельзя
+func TestConsumer_Workers_DoNotCommitPastInFlightMessage(t *testing.T) {
+	t.Parallel()
+
+	msgs := workerTestMessages(t, 1)[:3] // партиция 0: пользователи 1, 3, 5 с offset-ами 0, 1, 2
+	reader := &mockKafka.MockKafkaReader{Messages: msgs}
+
+	release := make(chan struct{})
+	var processed sync.WaitGroup
+	processed.Add(2)
+
+	consumer := &kafka.Consumer{
+		KafkaReader: reader,
+		Log:         slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		Concurrency: 8,
+		Handler: func(event domain.UserEvent) error {
+			if event.Payload.ID == 1 {
+				<-release // первое сообщение партиции зависло
+				return nil
+			}
+			processed.Done()
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		consumer.StartKafkaConsumer(ctx)
+		close(stopped)
+	}()
+
+	processed.Wait()
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, reader.CommittedMessages(), "offset-ы после незавершённого сообщения не должны коммититься")
+
+	close(release)
+	require.Eventually(t, func() bool {
+		committed := reader.CommittedMessages()
+		return len(committed) > 0 && committed[len(committed)-1].Offset == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-stopped
+}
@@ -0,0 +1,85 @@
+package kafkaTest
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/broker/kafka"
+	mockKafka "github.com/Derbik-Git/user-service/internal/broker/kafka/mock"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumer_MessageHandler_ReceivesMetadata(t *testing.T) {
+	t.Parallel()
+
+	value, err := json.Marshal(domain.UserEvent{ID: "evt-1", Type: domain.UserCreated, Payload: domain.User{ID: 5}})
+	require.NoError(t, err)
+
+	written := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	m := kafkago.Message{
+		Topic:     domain.TopicUserEvents,
+		Partition: 2,
+		Offset:    17,
+		Key:       []byte("5"),
+		Value:     value,
+		Headers:   []kafkago.Header{{Key: "traceparent", Value: []byte("00-abc-def-01")}},
+		Time:      written,
+	}
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "consumer-ctx")
+
+	var got kafka.EventMessage
+	consumer := &kafka.Consumer{Log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+	kafka.WithMessageHandler(func(ctx context.Context, msg kafka.EventMessage) error {
+		assert.Equal(t, "consumer-ctx", ctx.Value(ctxKey{}), "хендлер должен получать контекст консьюмера")
+		got = msg
+		return nil
+	})(consumer)
+
+	require.NoError(t, consumer.ProcessMessage(ctx, m))
+
+	assert.Equal(t, "evt-1", got.Event.ID)
+	assert.Equal(t, domain.TopicUserEvents, got.Topic)
+	assert.Equal(t, 2, got.Partition)
+	assert.Equal(t, int64(17), got.Offset)
+	assert.Equal(t, []byte("5"), got.Key)
+	assert.Equal(t, written, got.Time)
+	require.Len(t, got.Headers, 1)
+	assert.Equal(t, "traceparent", got.Headers[0].Key)
+}
+
+// старый HendlerAddEvent продолжает работать, а если заданы оба хендлера - вызывается только MessageHandler
+func TestConsumer_HandlerAdapterAndPriority(t *testing.T) {
+	t.Parallel()
+
+	value, err := json.Marshal(domain.UserEvent{ID: "evt-2", Type: domain.UserUpdated, Payload: domain.User{ID: 6}})
+	require.NoError(t, err)
+
+	legacy := &mockKafka.MockConsumerHandler{}
+	consumer := &kafka.Consumer{Log: slog.New(slog.NewTextHandler(os.Stdout, nil)), Handler: legacy.HendlerAddEvent}
+
+	require.NoError(t, consumer.ProcessMessage(context.Background(), kafkago.Message{Value: value}))
+	assert.True(t, legacy.IsCalled)
+	assert.Equal(t, "evt-2", legacy.ReceivedEvent.ID)
+
+	legacy.IsCalled = false
+	called := false
+	kafka.WithMessageHandler(func(ctx context.Context, msg kafka.EventMessage) error {
+		called = true
+		return nil
+	})(consumer)
+
+	require.NoError(t, consumer.ProcessMessage(context.Background(), kafkago.Message{Value: value}))
+	assert.True(t, called)
+	assert.False(t, legacy.IsCalled)
+
+	assert.Nil(t, kafka.AdaptHandler(nil))
+}
@@ -0,0 +1,103 @@
+package kafkaTest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/broker/kafka"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// по умолчанию продюсер остаётся строго синхронным, как и был до появления опций
+func TestNewProducer_DefaultsAreStrictSync(t *testing.T) {
+	p := kafka.NewProducer([]string{"localhost:9092"})
+	defer p.Close()
+
+	w, ok := p.KafkaWriter.(*kafkago.Writer)
+	require.True(t, ok)
+
+	assert.False(t, w.Async)
+	assert.Equal(t, kafkago.RequireAll, w.RequiredAcks)
+	assert.Equal(t, kafkago.Compression(0), w.Compression)
+	assert.NotNil(t, w.Completion)
+}
+
+func TestNewProducer_TuningOptions(t *testing.T) {
+	var (
+		reported  []kafkago.Message
+		reportErr error
+	)
+
+	p := kafka.NewProducer([]string{"localhost:9092"},
+		kafka.WithCompression(kafkago.Zstd),
+		kafka.WithBatch(500, 20*time.Millisecond),
+		kafka.WithRequiredAcks(kafkago.RequireOne),
+		kafka.WithAsync(func(messages []kafkago.Message, err error) {
+			reported = messages
+			reportErr = err
+		}),
+	)
+	defer p.Close()
+
+	w, ok := p.KafkaWriter.(*kafkago.Writer)
+	require.True(t, ok)
+
+	assert.True(t, w.Async)
+	assert.Equal(t, kafkago.RequireOne, w.RequiredAcks)
+	assert.Equal(t, kafkago.Zstd, w.Compression)
+	assert.Equal(t, 500, w.BatchSize)
+	assert.Equal(t, 20*time.Millisecond, w.BatchTimeout)
+
+	// writer вызывает Completion сам, тут имитируем неудачную доставку пачки и проверяем, что отчёт дошёл до колбэка
+	deliveryErr := errors.New("broker unavailable")
+	msgs := []kafkago.Message{{Topic: "user-events", Key: []byte("1")}, {Topic: "user-events", Key: []byte("1")}}
+	w.Completion(msgs, deliveryErr)
+
+	assert.Len(t, reported, 2)
+	assert.ErrorIs(t, reportErr, deliveryErr)
+}
+
+// нулевые значения WithBatch не затирают значения kafka-go по умолчанию
+func TestWithBatch_ZeroKeepsDefaults(t *testing.T) {
+	p := kafka.NewProducer([]string{"localhost:9092"}, kafka.WithBatch(0, 0))
+	defer p.Close()
+
+	w := p.KafkaWriter.(*kafkago.Writer)
+	assert.Zero(t, w.BatchSize)
+	assert.Zero(t, w.BatchTimeout)
+}
+
+func TestParseCompressionAndAcks(t *testing.T) {
+	for in, want := range map[string]kafkago.Compression{
+		"":       0,
+		"none":   0,
+		"gzip":   kafkago.Gzip,
+		"snappy": kafkago.Snappy,
+		"lz4":    kafkago.Lz4,
+		"zstd":   kafkago.Zstd,
+	} {
+		got, err := kafka.ParseCompression(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	_, err := kafka.ParseCompression("brotli")
+	assert.Error(t, err)
+
+	for in, want := range map[string]kafkago.RequiredAcks{
+		"":     kafkago.RequireAll,
+		"all":  kafkago.RequireAll,
+		"one":  kafkago.RequireOne,
+		"none": kafkago.RequireNone,
+	} {
+		got, err := kafka.ParseRequiredAcks(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	_, err = kafka.ParseRequiredAcks("two")
+	assert.Error(t, err)
+}
@@ -0,0 +1,59 @@
+package kafkaTest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/broker/kafka"
+	mockKafka "github.com/Derbik-Git/user-service/internal/broker/kafka/mock"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProducer_PublishUserState_RoundTrip(t *testing.T) {
+	user := &domain.User{
+		ID:        42,
+		Email:     "state@email.com",
+		Name:      "State",
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		UpdatedAt: time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC),
+	}
+
+	for _, enc := range []kafka.PayloadEncoding{kafka.EncodingJSON, kafka.EncodingProtobuf} {
+		t.Run(string(enc), func(t *testing.T) {
+			writer := &mockKafka.MockKafkaWriter{}
+			p := &kafka.Producer{KafkaWriter: writer, Encoding: enc}
+
+			require.NoError(t, p.PublishUserState(context.Background(), domain.TopicUserState, user))
+
+			m := writer.CapturedMessage
+			assert.Equal(t, domain.TopicUserState, m.Topic)
+			assert.Equal(t, "42", string(m.Key))
+
+			got, deleted, err := kafka.DecodeUserState(m)
+			require.NoError(t, err)
+			assert.False(t, deleted)
+			assert.Equal(t, user.ID, got.ID)
+			assert.Equal(t, user.Email, got.Email)
+			assert.True(t, user.UpdatedAt.Equal(got.UpdatedAt))
+		})
+	}
+}
+
+func TestProducer_DeleteUserState_Tombstone(t *testing.T) {
+	writer := &mockKafka.MockKafkaWriter{}
+	p := &kafka.Producer{KafkaWriter: writer}
+
+	require.NoError(t, p.DeleteUserState(context.Background(), domain.TopicUserState, 7))
+
+	m := writer.CapturedMessage
+	assert.Equal(t, "7", string(m.Key))
+	assert.Nil(t, m.Value, "tombstone - это сообщение с nil в Value")
+
+	got, deleted, err := kafka.DecodeUserState(m)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	assert.Equal(t, int64(7), got.ID)
+}
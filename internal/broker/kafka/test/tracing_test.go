@@ -0,0 +1,63 @@
+package kafkaTest
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/Derbik-Git/user-service/internal/broker/kafka"
+	mockKafka "github.com/Derbik-Git/user-service/internal/broker/kafka/mock"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// trace context запроса, опубликовавшего событие, доходит до хендлера консьюмера через заголовки сообщения
+// без t.Parallel: тест меняет глобальные TracerProvider и propagator
+func TestTracing_PropagatesThroughHeaders(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "grpc request")
+	defer parent.End()
+
+	mockWriter := &mockKafka.MockKafkaWriter{}
+	producer := &kafka.Producer{KafkaWriter: mockWriter}
+	require.NoError(t, producer.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserCreated, &domain.User{ID: 7}))
+
+	var traceparent string
+	for _, h := range mockWriter.CapturedMessage.Headers {
+		if h.Key == "traceparent" {
+			traceparent = string(h.Value)
+		}
+	}
+	require.NotEmpty(t, traceparent, "продюсер должен положить trace context в заголовки")
+
+	var handlerSpan trace.SpanContext
+	consumer := &kafka.Consumer{Log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+	kafka.WithMessageHandler(func(ctx context.Context, _ kafka.EventMessage) error {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		return nil
+	})(consumer)
+
+	// консьюмер работает в другом процессе, поэтому его контекст не знает о трассе продюсера
+	require.NoError(t, consumer.ProcessMessage(context.Background(), mockWriter.CapturedMessage))
+	assert.Equal(t, parent.SpanContext().TraceID(), handlerSpan.TraceID(), "обработка события в той же трассе, что и запрос")
+
+	spans := map[trace.SpanKind]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.SpanKind()] = s
+	}
+	require.Contains(t, spans, trace.SpanKindProducer)
+	require.Contains(t, spans, trace.SpanKindConsumer)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[trace.SpanKindProducer].Parent().SpanID())
+	assert.Equal(t, spans[trace.SpanKindProducer].SpanContext().SpanID(), spans[trace.SpanKindConsumer].Parent().SpanID())
+	assert.Equal(t, handlerSpan.SpanID(), spans[trace.SpanKindConsumer].SpanContext().SpanID())
+}
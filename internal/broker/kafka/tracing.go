@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/Derbik-Git/user-service/internal/tracing"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("github.com/Derbik-Git/user-service/internal/broker/kafka")
+
+// headerCarrier - заголовки сообщения kafka как propagation.TextMapCarrier: через них trace context (traceparent, baggage)
+// передаётся от продюсера консьюмеру, и обработка события попадает в ту же трассу, что и gRPC запрос, который его вызвал
+type headerCarrier struct {
+	headers *[]kafka.Header
+}
+
+var _ propagation.TextMapCarrier = headerCarrier{}
+
+func (c headerCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set заменяет заголовок, если он уже есть: сообщение могло прийти из другой трассы (например, переотправка из DLQ)
+func (c headerCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if h.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, h := range *c.headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
+// write отправляет сообщение в спане продюсера, trace context спана кладётся в заголовки сообщения
+func (p *Producer) write(ctx context.Context, msg kafka.Message) (err error) {
+	ctx, span := tracer.Start(ctx, "kafka.publish "+msg.Topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(messagingAttrs(msg.Topic, "send")...),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{headers: &msg.Headers})
+
+	return p.KafkaWriter.WriteMessages(ctx, msg)
+}
+
+// startConsumeSpan начинает спан обработки сообщения, дочерний к спану продюсера из заголовков сообщения
+func startConsumeSpan(ctx context.Context, m kafka.Message) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, headerCarrier{headers: &m.Headers})
+
+	ctx, span := tracer.Start(ctx, "kafka.process "+m.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messagingAttrs(m.Topic, "process")...),
+	)
+	span.SetAttributes(
+		attribute.Int("messaging.destination.partition.id", m.Partition),
+		attribute.Int64("messaging.kafka.offset", m.Offset),
+	)
+	return ctx, span
+}
+
+// startBatchSpan - один спан на пачку: у сообщений пачки разные трассы, поэтому они не родители спана, а ссылки (links) на него
+func startBatchSpan(ctx context.Context, batch []kafka.Message) (context.Context, trace.Span) {
+	links := make([]trace.Link, 0, len(batch))
+	for _, m := range batch {
+		msgCtx := otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier{headers: &m.Headers})
+		if sc := trace.SpanContextFromContext(msgCtx); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+
+	attrs := append(messagingAttrs(batch[0].Topic, "process"), attribute.Int("messaging.batch.message_count", len(batch)))
+	return tracer.Start(ctx, "kafka.process_batch "+batch[0].Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+func messagingAttrs(topic, operation string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", topic),
+		attribute.String("messaging.operation.type", operation),
+	}
+}
@@ -0,0 +1,290 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	kafkabroker "github.com/Derbik-Git/user-service/internal/broker/kafka"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/segmentio/kafka-go"
+)
+
+// Broker - брокер сообщений, который живёт в памяти процесса
+// Нужен для тестов и локального запуска, когда поднимать kafka не хочется, а моки из internal/broker/kafka/mock не дают проверить весь путь события:
+//   - Broker реализует service.EventProducer (PublishUserEvent, PublishUserState, DeleteUserState), поэтому его можно сразу передать в service.NewUserService
+//   - Broker реализует тот же WriteMessages/Close, что и *kafka.Writer, поэтому его можно подставить в kafka.Producer
+//   - Reader реализует FetchMessage/CommitMessages/Close, как *kafka.Reader, поэтому его можно подставить в kafka.Consumer
+//
+// Как и в kafka, у каждого топика есть партиции (партиция выбирается тем же kafka.Hash по ключу), у сообщений есть offset-ы,
+// а консьюмер-группы помнят закоммиченные offset-ы. Ребалансировки нет: на одну группу рассчитан один Reader
+type Broker struct {
+	mu         sync.Mutex
+	partitions int
+	balancer   kafka.Balancer
+	topics     map[string][][]kafka.Message // топик -> партиции -> лог сообщений
+	committed  map[groupTopic]map[int]int64 // группа+топик -> партиция -> следующий offset для чтения
+	notify     chan struct{}                // закрывается и пересоздаётся при каждой записи, что бы разбудить ждущих читателей
+	closed     bool
+}
+
+type groupTopic struct {
+	group string
+	topic string
+}
+
+var ErrBrokerClosed = errors.New("memory broker is closed")
+
+// NewBroker создаёт брокер, у каждого топика которого будет partitions партиций
+func NewBroker(partitions int) *Broker {
+	if partitions <= 0 {
+		partitions = 1
+	}
+
+	return &Broker{
+		partitions: partitions,
+		balancer:   &kafka.Hash{},
+		topics:     make(map[string][][]kafka.Message),
+		committed:  make(map[groupTopic]map[int]int64),
+		notify:     make(chan struct{}),
+	}
+}
+
+// WriteMessages кладёт сообщения в конец нужных партиций, так же как это сделал бы *kafka.Writer
+func (b *Broker) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBrokerClosed
+	}
+
+	partitionIDs := make([]int, b.partitions)
+	for i := range partitionIDs {
+		partitionIDs[i] = i
+	}
+
+	for _, m := range msgs {
+		if m.Topic == "" {
+			return errors.New("memory broker: message topic is required")
+		}
+
+		log := b.topicLocked(m.Topic)
+		p := b.balancer.Balance(m, partitionIDs...)
+
+		m.Partition = p
+		m.Offset = int64(len(log[p]))
+		if m.Time.IsZero() {
+			m.Time = time.Now()
+		}
+		log[p] = append(log[p], m)
+	}
+
+	close(b.notify)
+	b.notify = make(chan struct{})
+
+	return nil
+}
+
+// Close закрывает брокер: запись больше невозможна, ждущие читатели получают io.EOF
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		close(b.notify)
+	}
+	return nil
+}
+
+// PublishUserEvent - реализация service.EventProducer, событие кодируется настоящим kafka.Producer в формате по умолчанию
+func (b *Broker) PublishUserEvent(ctx context.Context, topic string, eventType string, user *domain.User) error {
+	return b.Producer().PublishUserEvent(ctx, topic, eventType, user)
+}
+
+// PublishUserState - реализация service.EventProducer для compacted топика состояния
+// compaction тут не эмулируется: в топике остаются все версии и tombstone-ы, как в kafka до прохода компактора
+func (b *Broker) PublishUserState(ctx context.Context, topic string, user *domain.User) error {
+	return b.Producer().PublishUserState(ctx, topic, user)
+}
+
+func (b *Broker) DeleteUserState(ctx context.Context, topic string, id int64) error {
+	return b.Producer().DeleteUserState(ctx, topic, id)
+}
+
+// Producer возвращает kafka.Producer, который пишет в этот брокер, с теми же опциями, что и настоящий (CloudEvents, protobuf)
+func (b *Broker) Producer(opts ...kafkabroker.ProducerOption) *kafkabroker.Producer {
+	p := &kafkabroker.Producer{KafkaWriter: b}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// NewReader создаёт читателя топика в составе группы, чтение начинается с закоммиченных группой offset-ов
+func (b *Broker) NewReader(topic, groupID string) *Reader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	next := make(map[int]int64, b.partitions)
+	for p, offset := range b.committed[groupTopic{group: groupID, topic: topic}] {
+		next[p] = offset
+	}
+
+	return &Reader{
+		broker: b,
+		topic:  topic,
+		group:  groupID,
+		next:   next,
+		done:   make(chan struct{}),
+	}
+}
+
+// NewConsumer собирает kafka.Consumer поверх Reader этого брокера, опции те же, что у kafka.NewConsumer
+func (b *Broker) NewConsumer(topic, groupID string, log *slog.Logger, handler kafkabroker.HendlerAddEvent, opts ...kafkabroker.ConsumerOption) *kafkabroker.Consumer {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	c := &kafkabroker.Consumer{
+		KafkaReader: b.NewReader(topic, groupID),
+		Log:         log,
+		Handler:     handler,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Messages возвращает копию всех сообщений топика (по партициям по порядку), удобно для проверок в тестах
+func (b *Broker) Messages(topic string) []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []kafka.Message
+	for _, log := range b.topics[topic] {
+		out = append(out, log...)
+	}
+	return out
+}
+
+// CommittedOffset возвращает следующий offset, который группа прочитает из партиции (как в kafka: последний закоммиченный + 1)
+func (b *Broker) CommittedOffset(groupID, topic string, partition int) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.committed[groupTopic{group: groupID, topic: topic}][partition]
+}
+
+func (b *Broker) topicLocked(topic string) [][]kafka.Message {
+	log, ok := b.topics[topic]
+	if !ok {
+		log = make([][]kafka.Message, b.partitions)
+		b.topics[topic] = log
+	}
+	return log
+}
+
+// Reader - аналог *kafka.Reader с GroupID, читает все партиции топика по кругу
+type Reader struct {
+	broker *Broker
+	topic  string
+	group  string
+
+	mu     sync.Mutex
+	next   map[int]int64 // партиция -> следующий offset для чтения
+	rr     int           // с какой партиции начинать следующий поиск, что бы одна партиция не забирала всё чтение
+	closed bool
+	done   chan struct{} // закрывается в Close, что бы разбудить FetchMessage, который ждёт новых сообщений
+}
+
+// FetchMessage возвращает следующее непрочитанное сообщение, а если их нет - ждёт новое, отмену контекста или Close
+func (r *Reader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return kafka.Message{}, io.EOF
+		}
+
+		r.broker.mu.Lock()
+		m, ok := r.nextLocked()
+		notify, brokerClosed := r.broker.notify, r.broker.closed
+		r.broker.mu.Unlock()
+		r.mu.Unlock()
+
+		if ok {
+			return m, nil
+		}
+		if brokerClosed {
+			return kafka.Message{}, io.EOF
+		}
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-r.done:
+			return kafka.Message{}, io.EOF
+		case <-notify:
+		}
+	}
+}
+
+// nextLocked вызывается под r.mu и r.broker.mu
+func (r *Reader) nextLocked() (kafka.Message, bool) {
+	log := r.broker.topics[r.topic]
+	for i := 0; i < len(log); i++ {
+		p := (r.rr + i) % len(log)
+		if offset := r.next[p]; offset < int64(len(log[p])) {
+			r.next[p] = offset + 1
+			r.rr = p + 1
+			return log[p][offset], true
+		}
+	}
+	return kafka.Message{}, false
+}
+
+// CommitMessages запоминает offset-ы группы, как и в kafka, offset партиции может только расти
+func (r *Reader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	key := groupTopic{group: r.group, topic: r.topic}
+	offsets, ok := r.broker.committed[key]
+	if !ok {
+		offsets = make(map[int]int64)
+		r.broker.committed[key] = offsets
+	}
+
+	for _, m := range msgs {
+		if m.Offset+1 > offsets[m.Partition] {
+			offsets[m.Partition] = m.Offset + 1
+		}
+	}
+	return nil
+}
+
+// Close закрывает читателя, ждущий FetchMessage сразу возвращает io.EOF, как и у *kafka.Reader
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.closed {
+		r.closed = true
+		close(r.done)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	kafkabroker "github.com/Derbik-Git/user-service/internal/broker/kafka"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/service"
+	"github.com/Derbik-Git/user-service/internal/service/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// собираем тот же путь события, что и в проде: service -> producer -> брокер -> consumer -> handler, только без kafka
+func TestBroker_ServiceToConsumerEndToEnd(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	broker := NewBroker(3)
+
+	repo := &mocks.UserRepositoryMock{
+		CreateFunc: func(ctx context.Context, email, name string) (*domain.User, error) {
+			return &domain.User{ID: 10, Email: email, Name: name}, nil
+		},
+		UpdateFunc: func(ctx context.Context, user *domain.User) (*domain.User, error) {
+			return user, nil
+		},
+		DeleteFunc: func(ctx context.Context, id int64) error {
+			return nil
+		},
+	}
+	svc := service.NewUserService(repo, nil, broker, slog.Default(), time.Minute)
+
+	_, err := svc.CreateUser(ctx, "memory@email.com", "Memory")
+	require.NoError(t, err)
+	_, err = svc.UpdateUser(ctx, &domain.User{ID: 10, Email: "memory2@email.com", Name: "Memory"})
+	require.NoError(t, err)
+	require.NoError(t, svc.DeleteUser(ctx, 10))
+
+	// все события одного пользователя лежат в одной партиции подряд
+	msgs := broker.Messages(domain.TopicUserEvents)
+	require.Len(t, msgs, 3)
+	for i, m := range msgs {
+		assert.Equal(t, msgs[0].Partition, m.Partition)
+		assert.Equal(t, int64(i), m.Offset)
+	}
+
+	// рядом с событиями в compacted топике лежат состояния: две версии пользователя и tombstone
+	state := broker.Messages(domain.TopicUserState)
+	require.Len(t, state, 3)
+	for _, m := range state {
+		assert.Equal(t, "10", string(m.Key))
+	}
+	latest, _, err := kafkabroker.DecodeUserState(state[1])
+	require.NoError(t, err)
+	assert.Equal(t, "memory2@email.com", latest.Email)
+	_, deleted, err := kafkabroker.DecodeUserState(state[2])
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	var (
+		mu     sync.Mutex
+		events []domain.UserEvent
+	)
+	done := make(chan struct{})
+
+	consumer := broker.NewConsumer(domain.TopicUserEvents, "test-group", nil, func(event domain.UserEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+		if len(events) == 3 {
+			close(done)
+		}
+		return nil
+	})
+
+	runCtx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		consumer.StartKafkaConsumer(runCtx)
+		close(stopped)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("консьюмер не получил события")
+	}
+	cancel()
+	<-stopped
+
+	require.Len(t, events, 3)
+	assert.Equal(t, domain.UserCreated, events[0].Type)
+	assert.Equal(t, domain.UserUpdated, events[1].Type)
+	assert.Equal(t, "memory2@email.com", events[1].Payload.Email)
+	assert.Equal(t, domain.UserDeleted, events[2].Type)
+
+	assert.Equal(t, int64(3), broker.CommittedOffset("test-group", domain.TopicUserEvents, msgs[0].Partition))
+}
+
+// новый читатель той же группы продолжает с закоммиченного offset-а, а другая группа читает топик с начала
+func TestBroker_GroupResumesFromCommittedOffset(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	broker := NewBroker(1)
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, broker.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserCreated, &domain.User{ID: i}))
+	}
+
+	first := broker.NewReader(domain.TopicUserEvents, "group-a")
+	m, err := first.FetchMessage(ctx)
+	require.NoError(t, err)
+	require.NoError(t, first.CommitMessages(ctx, m))
+	require.NoError(t, first.Close())
+
+	second := broker.NewReader(domain.TopicUserEvents, "group-a")
+	m, err = second.FetchMessage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), m.Offset)
+
+	other := broker.NewReader(domain.TopicUserEvents, "group-b")
+	m, err = other.FetchMessage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), m.Offset)
+
+	// сообщений больше нет - FetchMessage ждёт до отмены контекста
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, _ = second.FetchMessage(ctx)
+	_, err = second.FetchMessage(timeoutCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// Close будит читателя, который ждёт новых сообщений, иначе остановка консьюмера на этом брокере зависает
+func TestReader_CloseWakesBlockedFetch(t *testing.T) {
+	t.Parallel()
+
+	broker := NewBroker(1)
+	reader := broker.NewReader(domain.TopicUserEvents, "group-a")
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := reader.FetchMessage(context.Background())
+		errCh <- err
+	}()
+
+	// даём FetchMessage дойти до ожидания
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, reader.Close())
+	require.NoError(t, reader.Close())
+
+	select {
+	case err := <-errCh:
+		require.ErrorIs(t, err, io.EOF)
+	case <-time.After(time.Second):
+		t.Fatal("FetchMessage was not woken up by Close")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"strconv"
 	"time"
@@ -19,7 +20,7 @@ type RedisCache struct {
 	logger *slog.Logger
 }
 
-// используется только в тестах типа: integartion
+// используется в тестах типа: integartion , для общих между репликами лимитов запросов (ratelimit.NewRedis) и ключей идемпотентности (idempotency.NewRedisStore)
 func (r *RedisCache) Client() redis.Cmdable { // благодаря этому методы мы возвращаем этот интерфейс redis.Cmdable, с помощью которого мы можем дёргать методы кеша, такие как GET, SET, DEL, TTL, FLUSHDB. Это redis client wrapper, который: использует connection pool, управляет reconnect
 	return r.client
 }
@@ -74,6 +75,9 @@ func NewRedisCache(addrs []string, ttl time.Duration, opts *redis.ClusterOptions
 	}
 	*/
 
+	// и redis.Client, и redis.ClusterClient поддерживают хуки, в redis.Cmdable AddHook не входит
+	client.(interface{ AddHook(redis.Hook) }).AddHook(tracingHook{})
+
 	return &RedisCache{
 		client: client,
 		ttl:    ttl,
@@ -142,6 +146,47 @@ func (c *RedisCache) DeleteUser(ctx context.Context, id int64) error {
 	return nil
 }
 
+func userTombstoneKey(id int64) string {
+	return "user-deleted:" + strconv.FormatInt(id, 10)
+}
+
+// SetUserTombstone запоминает, что пользователь удалён (version - время удаления), используется cache-sync (kafka.NewCacheSyncHandler),
+// что бы опоздавшее событие создания или изменения не вернуло удалённого пользователя в кеш
+func (c *RedisCache) SetUserTombstone(ctx context.Context, id int64, version time.Time, ttl time.Duration) error {
+	const op = "cache.redis.SetUserTombstone"
+
+	if err := c.client.Set(ctx, userTombstoneKey(id), version.UnixNano(), ttl).Err(); err != nil {
+		c.logger.Error("redis SET failed", slog.String("op", op), slog.Int64("user_id", id), sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// UserTombstone возвращает время удаления пользователя, нулевое время - tombstone-а нет (пользователь не удалялся или tombstone истёк)
+func (c *RedisCache) UserTombstone(ctx context.Context, id int64) (time.Time, error) {
+	const op = "cache.redis.UserTombstone"
+
+	nanos, err := c.client.Get(ctx, userTombstoneKey(id)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return time.Time{}, nil
+		}
+		c.logger.Error("redis GET failed", slog.String("op", op), slog.Int64("user_id", id), sl.Err(err))
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return time.Unix(0, nanos), nil
+}
+
+// Ping проверяет связь с redis (тот самый PING, который закомментирован в NewRedisCache), используется health проверкой
+func (c *RedisCache) Ping(ctx context.Context) error {
+	const op = "cache.redis.Ping"
+
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
 func (c *RedisCache) Close() error {
 	const op = "cache.redis.Close"
 
@@ -163,3 +163,29 @@ func TestRedis_GetNonKeyRedis(t *testing.T) { // пытаемся достать
 }
 
 // set с nil не делаем, потому что этого не допускает логика слоя cache
+
+func TestRedis_UserTombstone(t *testing.T) {
+	t.Parallel()
+
+	cache := newTestCache(t)
+	ctx := context.Background()
+
+	const id = 5
+
+	version, err := cache.UserTombstone(ctx, id)
+	require.NoError(t, err)
+	require.True(t, version.IsZero(), "пользователь не удалялся")
+
+	deletedAt := time.Unix(1700000000, 123)
+	require.NoError(t, cache.SetUserTombstone(ctx, id, deletedAt, time.Second))
+
+	version, err = cache.UserTombstone(ctx, id)
+	require.NoError(t, err)
+	require.True(t, deletedAt.Equal(version))
+
+	time.Sleep(1500 * time.Millisecond)
+
+	version, err = cache.UserTombstone(ctx, id)
+	require.NoError(t, err)
+	require.True(t, version.IsZero(), "tombstone истекает по ttl")
+}
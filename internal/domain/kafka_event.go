@@ -6,11 +6,15 @@ import "time"
 // нету Get так как если бы мы использовали get топик в kafka, то добьавление redis потеряло бы смысл, ведь redis добавляется для скорости выполнения запроса, а использая kafka на запрос get мы накидываем на этот запрос куча kafka операций, сравнение, ожиданеи прихода целостных данных и так далее и это есть время, что обивает смысл добавления redis
 const (
 	TopicUserEvents = "user-events" // передавая эту константу мы говорим над какими данными проводится операция
+	TopicUserState  = "user-state"  // compacted топик с последним состоянием каждого пользователя (ключ = id, удаление = tombstone)
 
 	// передавая эти константы, мы указываем какой тип операции проводится над определённым видом данных(user-event в нашем случае), так как логика нашего сервиса закреплена над операциями, проводимыми над данными user(gjkmpjdfntkz)
 	UserCreated = "user.created"
 	UserUpdated = "user.updated"
 	UserDeleted = "user.deleted"
+
+	// снимок текущего состояния пользователя, публикуется не при изменении, а командой replayer, когда консьюмерам нужно восстановить своё состояние
+	UserSnapshot = "user.snapshot"
 )
 
 // В топики публикуются события (events) — это сообщения о том, что что-то произошло в системе.
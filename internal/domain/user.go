@@ -7,4 +7,5 @@ type User struct {
 	Email     string
 	Name      string
 	CreatedAt time.Time
+	UpdatedAt time.Time // время последнего изменения строки в БД, служит версией пользователя (например, что бы не перезаписать кеш устаревшим событием)
 }
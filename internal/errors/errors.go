@@ -1,6 +1,7 @@
 package errorsx
 
 import (
+	"context"
 	"errors"
 
 	"google.golang.org/grpc/codes"
@@ -18,6 +19,10 @@ func ToGRPC(err error) error {
 	if err == nil {
 		return nil
 	}
+	// ошибка уже несёт gRPC статус (например Unauthenticated от интерцептора авторизации) - оставляем его как есть
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
 	switch {
 	case errors.Is(err, ErrNotFound):
 		return status.Error(codes.NotFound, err.Error())
@@ -27,6 +32,11 @@ func ToGRPC(err error) error {
 		return status.Error(codes.FailedPrecondition, err.Error())
 	case errors.Is(err, ErrInvalidInput):
 		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		// сработал дедлайн запроса или таймаут слоя в сервисе (service.Timeouts)
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
 	default:
 		return status.Error(codes.Internal, err.Error())
 	}
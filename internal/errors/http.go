@@ -0,0 +1,47 @@
+package errorsx
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ToHTTP возвращает HTTP статус для ошибки сервиса, сначала ошибка проходит через ToGRPC,
+// поэтому gRPC и HTTP клиенты всегда видят одну и ту же классификацию ошибки
+func ToHTTP(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	return HTTPStatus(status.Code(ToGRPC(err)))
+}
+
+// HTTPStatus - соответствие gRPC кодов HTTP статусам, то же, что использует grpc-gateway
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // client closed request, стандартной константы в net/http нет
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
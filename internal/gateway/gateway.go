@@ -0,0 +1,472 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	userv1 "github.com/Derbik-Git/protos-tren-redis/user/v1"
+	"github.com/Derbik-Git/user-service/internal/auth"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	errorsx "github.com/Derbik-Git/user-service/internal/errors"
+	"github.com/Derbik-Git/user-service/internal/mtls"
+	"github.com/Derbik-Git/user-service/internal/ratelimit"
+	"github.com/Derbik-Git/user-service/internal/server"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"github.com/Derbik-Git/user-service/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var tracer = tracing.Tracer("github.com/Derbik-Git/user-service/internal/gateway")
+
+// Gateway - REST/JSON API поверх того же server.UserService, что и gRPC сервер, для клиентов, которые не умеют в gRPC (браузер, curl, скрипты)
+//
+//	POST   /v1/users       {"email": "...", "name": "..."}  -> 201 + пользователь
+//	GET    /v1/users/{id}                                   -> 200 + пользователь
+//	PATCH  /v1/users/{id}  {"email": "...", "name": "..."}  -> 200 + пользователь, поля необязательны, не переданное не меняется
+//	DELETE /v1/users/{id}                                   -> 204
+//
+// Валидация та же, что в gRPC сервере (server.Validate*), ошибки сервиса переводятся в статус через errorsx.ToHTTP,
+// поэтому один и тот же запрос по gRPC и по HTTP отклоняется одинаково. Тело ошибки: {"code": "NotFound", "message": "..."}
+type Gateway struct {
+	log  *slog.Logger
+	srv  *http.Server
+	addr string
+}
+
+// максимальный размер тела запроса, пользователь - это пара коротких строк
+const maxBodySize = 1 << 20
+
+// User - представление пользователя в JSON, поля и формат created_at такие же, как у userv1.User
+type User struct {
+	ID        int64  `json:"id"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+type userRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Authorizer - проверка токена и прав, та же, что у gRPC сервера (auth.Authenticator), ошибки - gRPC статусы
+// шлюз передаёт в неё имя соответствующего gRPC метода и protobuf запрос с id из пути, поэтому правила политики для обоих API общие
+type Authorizer interface {
+	Authorize(ctx context.Context, fullMethod, token string, req any) (context.Context, error)
+}
+
+// RateLimiter - тот же лимит, что у gRPC сервера (ratelimit.Limiter), ошибка - gRPC статус ResourceExhausted
+// бакеты общие: клиент не получит второй лимит, если пойдёт в HTTP вместо gRPC
+type RateLimiter interface {
+	Allow(ctx context.Context, fullMethod, peerAddr string) error
+}
+
+// Options - необязательные части шлюза, nil - выключено
+type Options struct {
+	Authorizer  Authorizer
+	RateLimiter RateLimiter
+	TLSConfig   *tls.Config
+
+	// Deadlines - те же дедлайны по умолчанию, что у gRPC сервера, у HTTP запроса своего дедлайна нет никогда
+	Deadlines server.Deadlines
+}
+
+// New создаёт шлюз на addr (например ":8080")
+func New(log *slog.Logger, addr string, userService server.UserService, opts Options) *Gateway {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &Gateway{
+		log:  log,
+		addr: addr,
+		srv: &http.Server{
+			Addr:              addr,
+			Handler:           Handler(log, userService, opts),
+			ReadHeaderTimeout: 5 * time.Second,
+			TLSConfig:         opts.TLSConfig,
+		},
+	}
+}
+
+// Handler собирает роутер шлюза, вынесен отдельно для тестов
+func Handler(log *slog.Logger, userService server.UserService, opts Options) http.Handler {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	h := &handler{log: log, users: userService, authz: opts.Authorizer, limiter: opts.RateLimiter}
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /v1/users", withDeadline(opts.Deadlines, userv1.UserService_CreateUser_FullMethodName, h.createUser))
+	mux.Handle("GET /v1/users/{id}", withDeadline(opts.Deadlines, userv1.UserService_GetUser_FullMethodName, h.getUser))
+	mux.Handle("PATCH /v1/users/{id}", withDeadline(opts.Deadlines, userv1.UserService_UpdateUser_FullMethodName, h.updateUser))
+	mux.Handle("DELETE /v1/users/{id}", withDeadline(opts.Deadlines, userv1.UserService_DeleteUser_FullMethodName, h.deleteUser))
+
+	return withRequestLog(log, mux)
+}
+
+// withDeadline - то же, что server.DeadlineInterceptor: дедлайн берётся по имени соответствующего gRPC метода
+func withDeadline(d server.Deadlines, fullMethod string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := d.Apply(r.Context(), fullMethod)
+		defer cancel()
+
+		next(w, r.WithContext(ctx))
+	})
+}
+
+// withRequestLog - то же, что server.LoggingInterceptor для gRPC: request_id из заголовка X-Request-Id (или новый),
+// логгер запроса в контексте для Service и Storage и одна строка лога на запрос
+func withRequestLog(log *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := server.NewRequestID(r.Header.Get(server.RequestIDHeader))
+		w.Header().Set(server.RequestIDHeader, requestID)
+
+		// спан запроса, как otelgrpc у gRPC сервера: trace context клиента берётся из заголовков traceparent/baggage
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("http.request.method", r.Method), attribute.String("url.path", r.URL.Path)),
+		)
+		defer span.End()
+
+		reqLog := log.With(slog.String("request_id", requestID), slog.String("method", r.Method+" "+r.URL.Path))
+		if traceID := tracing.TraceID(ctx); traceID != "" {
+			reqLog = reqLog.With(slog.String("trace_id", traceID))
+		}
+		ctx = sl.WithLogger(sl.WithRequestID(ctx, requestID), reqLog)
+		if r.TLS != nil {
+			ctx = mtls.ContextWithState(ctx, r.TLS) // клиентский сертификат, как у gRPC (mtls.UnaryInterceptor)
+		}
+		if addr, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+			ctx = peer.NewContext(ctx, &peer.Peer{Addr: net.TCPAddrFromAddrPort(addr)}) // адрес клиента, как у gRPC, для журнала изменений (audit.Actor)
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		serveRecovered(log, sw, r.WithContext(ctx), next)
+
+		span.SetAttributes(attribute.Int("http.response.status_code", sw.status))
+		level := slog.LevelInfo
+		switch {
+		case sw.status >= http.StatusInternalServerError:
+			span.SetStatus(otelcodes.Error, http.StatusText(sw.status))
+			level = slog.LevelError
+		case sw.status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		sl.FromContext(ctx, reqLog).Log(ctx, level, "http request finished",
+			slog.String("peer", r.RemoteAddr),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int("status", sw.status),
+		)
+	})
+}
+
+// serveRecovered - аналог server.RecoveryInterceptor: net/http и сам не даёт панике уронить процесс,
+// но рвёт соединение без ответа и пишет стек мимо нашего логгера, поэтому панику перехватываем здесь и отвечаем 500
+func serveRecovered(log *slog.Logger, w *statusWriter, r *http.Request, next http.Handler) {
+	defer func() {
+		if p := recover(); p != nil {
+			if p == http.ErrAbortHandler { // штатный способ оборвать ответ, его пробрасываем дальше
+				panic(p)
+			}
+			server.LogPanic(r.Context(), log, routeLabel(r), p)
+			if !w.wroteHeader {
+				writeJSON(w, http.StatusInternalServerError, errorResponse{Code: codes.Internal.String(), Message: "internal error"})
+			}
+		}
+	}()
+
+	next.ServeHTTP(w, r)
+}
+
+// routeLabel - шаблон маршрута ("GET /v1/users/{id}"), а не путь запроса: в метрике паник путь с id давал бы по серии на пользователя
+// Pattern выставляет ServeMux при маршрутизации прямо в этом *http.Request, поэтому к моменту recover он уже заполнен
+func routeLabel(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+	return r.Pattern
+}
+
+// statusWriter запоминает статус ответа для лога
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Run слушает addr и блокируется до Shutdown
+func (g *Gateway) Run() error {
+	const op = "gateway.Run"
+
+	l, err := net.Listen("tcp", g.addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if g.srv.TLSConfig != nil {
+		l = tls.NewListener(l, g.srv.TLSConfig)
+	}
+
+	g.log.Info("http gateway is running", slog.String("op", op), slog.String("addr", l.Addr().String()), slog.Bool("tls", g.srv.TLSConfig != nil))
+
+	if err := g.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Shutdown перестаёт принимать соединения и дожидается текущих запросов, но не дольше ctx
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	const op = "gateway.Shutdown"
+
+	if err := g.srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+type handler struct {
+	log     *slog.Logger
+	users   server.UserService
+	authz   Authorizer
+	limiter RateLimiter
+}
+
+// authorize проверяет заголовок Authorization: Bearer <jwt> так же, как gRPC интерцептор проверяет metadata,
+// и затем лимит запросов - в том же порядке, что в цепочке интерцепторов gRPC, что бы лимит считался по клиенту из токена
+// Вызывается до чтения тела и валидации, как и интерцепторы в gRPC: запрос без токена получает 401, а не 400 за кривое тело,
+// поэтому в req есть только id из пути, его хватает для правила Self
+func (h *handler) authorize(r *http.Request, fullMethod string, req any) (*http.Request, error) {
+	if h.authz != nil {
+		ctx, err := h.authz.Authorize(r.Context(), fullMethod, auth.BearerToken(r.Header.Get("Authorization")), req)
+		if err != nil {
+			return r, err
+		}
+		r = r.WithContext(ctx)
+	}
+
+	if h.limiter != nil {
+		if err := h.limiter.Allow(r.Context(), fullMethod, r.RemoteAddr); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+func (h *handler) getUser(w http.ResponseWriter, r *http.Request) {
+	const op = "gateway.getUser"
+
+	id, idErr := pathID(r)
+
+	r, err := h.authorize(r, userv1.UserService_GetUser_FullMethodName, &userv1.GetUserRequest{Id: id})
+	if err != nil {
+		h.fail(w, r, op, err)
+		return
+	}
+	if idErr != nil {
+		h.fail(w, r, op, idErr)
+		return
+	}
+
+	usr, err := h.users.GetUser(r.Context(), id)
+	if err != nil {
+		h.fail(w, r, op, err)
+		return
+	}
+	if usr == nil {
+		h.fail(w, r, op, server.ErrUserNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toUser(usr))
+}
+
+func (h *handler) createUser(w http.ResponseWriter, r *http.Request) {
+	const op = "gateway.createUser"
+
+	r, err := h.authorize(r, userv1.UserService_CreateUser_FullMethodName, &userv1.CreateUserRequest{})
+	if err != nil {
+		h.fail(w, r, op, err)
+		return
+	}
+
+	var req userRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		h.fail(w, r, op, err)
+		return
+	}
+	if err := server.ValidateCreate(req.Email, req.Name); err != nil {
+		h.fail(w, r, op, err)
+		return
+	}
+
+	usr, err := h.users.CreateUser(r.Context(), req.Email, req.Name)
+	if err != nil {
+		h.fail(w, r, op, err)
+		return
+	}
+
+	w.Header().Set("Location", "/v1/users/"+strconv.FormatInt(usr.ID, 10))
+	writeJSON(w, http.StatusCreated, toUser(usr))
+}
+
+func (h *handler) updateUser(w http.ResponseWriter, r *http.Request) {
+	const op = "gateway.updateUser"
+
+	id, idErr := pathID(r)
+
+	r, err := h.authorize(r, userv1.UserService_UpdateUser_FullMethodName, &userv1.UpdateUserRequest{Id: id})
+	if err != nil {
+		h.fail(w, r, op, err)
+		return
+	}
+	if idErr != nil {
+		h.fail(w, r, op, idErr)
+		return
+	}
+
+	var req userRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		h.fail(w, r, op, err)
+		return
+	}
+	if err := server.ValidateUpdate(id, req.Email, req.Name); err != nil {
+		h.fail(w, r, op, err)
+		return
+	}
+
+	usr, err := h.users.UpdateUser(r.Context(), &domain.User{ID: id, Email: req.Email, Name: req.Name})
+	if err != nil {
+		h.fail(w, r, op, err)
+		return
+	}
+	if usr == nil {
+		h.fail(w, r, op, server.ErrUserNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toUser(usr))
+}
+
+func (h *handler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	const op = "gateway.deleteUser"
+
+	id, idErr := pathID(r)
+
+	r, err := h.authorize(r, userv1.UserService_DeleteUser_FullMethodName, &userv1.DeleteUserRequest{Id: id})
+	if err != nil {
+		h.fail(w, r, op, err)
+		return
+	}
+	if idErr != nil {
+		h.fail(w, r, op, idErr)
+		return
+	}
+
+	if err := h.users.DeleteUser(r.Context(), id); err != nil {
+		h.fail(w, r, op, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fail пишет ошибку в ответ, статус и код выбираются так же, как для gRPC
+// текст внутренних ошибок клиенту не отдаётся, он только в логе
+func (h *handler) fail(w http.ResponseWriter, r *http.Request, op string, err error) {
+	log := sl.FromContext(r.Context(), h.log)
+
+	st := status.Convert(errorsx.ToGRPC(err))
+	code := st.Code()
+	httpStatus := errorsx.HTTPStatus(code)
+
+	msg := st.Message()
+	switch code {
+	case codes.Unauthenticated:
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	case codes.ResourceExhausted:
+		if d, ok := ratelimit.RetryAfter(err); ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+		}
+	}
+	if httpStatus >= http.StatusInternalServerError {
+		log.Error("request failed", slog.String("op", op), sl.Err(err))
+		msg = http.StatusText(httpStatus)
+	} else {
+		log.Warn("request failed", slog.String("op", op), sl.Err(err))
+	}
+
+	writeJSON(w, httpStatus, errorResponse{Code: code.String(), Message: msg})
+}
+
+// pathID достаёт id из пути, нечисловой id - такая же ошибка валидации, как id <= 0
+func pathID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, server.ValidateID(0)
+	}
+	return id, server.ValidateID(id)
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, dst any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return fmt.Errorf("%w: invalid json body: %s", errorsx.ErrInvalidInput, err.Error())
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, httpStatus int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func toUser(u *domain.User) User {
+	return User{
+		ID:        u.ID,
+		Email:     u.Email,
+		Name:      u.Name,
+		CreatedAt: u.CreatedAt.Format(time.RFC3339),
+	}
+}
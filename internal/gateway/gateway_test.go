@@ -0,0 +1,454 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	userv1 "github.com/Derbik-Git/protos-tren-redis/user/v1"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	errorsx "github.com/Derbik-Git/user-service/internal/errors"
+	"github.com/Derbik-Git/user-service/internal/ratelimit"
+	"github.com/Derbik-Git/user-service/internal/repository/postgres/storage"
+	"github.com/Derbik-Git/user-service/internal/server"
+	"github.com/Derbik-Git/user-service/internal/service"
+	"github.com/Derbik-Git/user-service/internal/service/mocks"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeUsers - сервис в памяти для проверки транспорта: nil, nil для несуществующего пользователя при Get, ошибки - те же, что отдаёт репозиторий.
+// Логику сервиса (частичное обновление, маппинг ошибок репозитория) фейк не повторяет, она проверяется через настоящий сервис в TestGateway_RealService
+type fakeUsers struct {
+	users  map[int64]*domain.User
+	nextID int64
+	err    error // если задана, возвращается из всех методов
+}
+
+func newFakeUsers() *fakeUsers {
+	return &fakeUsers{users: map[int64]*domain.User{}}
+}
+
+func (f *fakeUsers) GetUser(ctx context.Context, id int64) (*domain.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.users[id], nil
+}
+
+func (f *fakeUsers) CreateUser(ctx context.Context, email, name string) (*domain.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, u := range f.users {
+		if u.Email == email {
+			return nil, fmt.Errorf("storage.postgres.Create: %w", storage.ErrUserExists)
+		}
+	}
+	f.nextID++
+	u := &domain.User{ID: f.nextID, Email: email, Name: name, CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	f.users[u.ID] = u
+	return u, nil
+}
+
+func (f *fakeUsers) UpdateUser(ctx context.Context, u *domain.User) (*domain.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if _, ok := f.users[u.ID]; !ok {
+		return nil, fmt.Errorf("storage.postgres.Update: %w", storage.ErrNotFound)
+	}
+	f.users[u.ID] = u
+	return u, nil
+}
+
+func (f *fakeUsers) DeleteUser(ctx context.Context, id int64) error {
+	if f.err != nil {
+		return f.err
+	}
+	if _, ok := f.users[id]; !ok {
+		return fmt.Errorf("storage.postgres.Delete: %w", storage.ErrNotFound)
+	}
+	delete(f.users, id)
+	return nil
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string) (int, http.Header, string) {
+	t.Helper()
+
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, r))
+
+	b, err := io.ReadAll(rec.Result().Body)
+	require.NoError(t, err)
+	return rec.Code, rec.Header(), string(b)
+}
+
+func decodeError(t *testing.T, body string) errorResponse {
+	t.Helper()
+
+	var e errorResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &e))
+	return e
+}
+
+func TestGateway_CRUD(t *testing.T) {
+	t.Parallel()
+
+	h := Handler(nil, newFakeUsers(), Options{})
+
+	code, hdr, body := do(t, h, http.MethodPost, "/v1/users", `{"email":"a@b.c","name":"alice"}`)
+	require.Equal(t, http.StatusCreated, code, body)
+	assert.Equal(t, "/v1/users/1", hdr.Get("Location"))
+	assert.Equal(t, "application/json", hdr.Get("Content-Type"))
+
+	var created User
+	require.NoError(t, json.Unmarshal([]byte(body), &created))
+	assert.Equal(t, User{ID: 1, Email: "a@b.c", Name: "alice", CreatedAt: "2024-01-02T03:04:05Z"}, created)
+
+	code, _, body = do(t, h, http.MethodGet, "/v1/users/1", "")
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"id":1,"email":"a@b.c","name":"alice","created_at":"2024-01-02T03:04:05Z"}`, body)
+
+	code, _, body = do(t, h, http.MethodPatch, "/v1/users/1", `{"name":"bob"}`)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"name":"bob"`)
+
+	code, _, body = do(t, h, http.MethodDelete, "/v1/users/1", "")
+	require.Equal(t, http.StatusNoContent, code, body)
+	assert.Empty(t, body)
+
+	code, _, body = do(t, h, http.MethodGet, "/v1/users/1", "")
+	require.Equal(t, http.StatusNotFound, code, body)
+	assert.Equal(t, codes.NotFound.String(), decodeError(t, body).Code)
+}
+
+func TestGateway_Errors(t *testing.T) {
+	t.Parallel()
+
+	users := newFakeUsers()
+	h := Handler(nil, users, Options{})
+
+	_, _, _ = do(t, h, http.MethodPost, "/v1/users", `{"email":"a@b.c","name":"alice"}`)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantCode   codes.Code
+		wantMsg    string
+	}{
+		{"zero id", http.MethodGet, "/v1/users/0", "", http.StatusBadRequest, codes.InvalidArgument, "id must be > 0"},
+		{"not a number", http.MethodDelete, "/v1/users/abc", "", http.StatusBadRequest, codes.InvalidArgument, "id must be > 0"},
+		{"missing email", http.MethodPost, "/v1/users", `{"name":"bob"}`, http.StatusBadRequest, codes.InvalidArgument, "email is required"},
+		{"missing name", http.MethodPost, "/v1/users", `{"email":"x@y.z"}`, http.StatusBadRequest, codes.InvalidArgument, "name is required"},
+		{"nothing to update", http.MethodPatch, "/v1/users/1", `{}`, http.StatusBadRequest, codes.InvalidArgument, "nothing to update"},
+		{"broken json", http.MethodPost, "/v1/users", `{"email":`, http.StatusBadRequest, codes.InvalidArgument, "invalid json body"},
+		{"unknown field", http.MethodPost, "/v1/users", `{"email":"x@y.z","name":"x","admin":true}`, http.StatusBadRequest, codes.InvalidArgument, "admin"},
+		{"duplicate", http.MethodPost, "/v1/users", `{"email":"a@b.c","name":"alice"}`, http.StatusConflict, codes.AlreadyExists, "already exists"},
+		{"update missing", http.MethodPatch, "/v1/users/42", `{"name":"bob"}`, http.StatusNotFound, codes.NotFound, "user not found"},
+		{"delete missing", http.MethodDelete, "/v1/users/42", "", http.StatusNotFound, codes.NotFound, "user not found"},
+	}
+
+	for _, tt := range tests {
+		code, _, body := do(t, h, tt.method, tt.path, tt.body)
+		assert.Equal(t, tt.wantStatus, code, tt.name)
+
+		e := decodeError(t, body)
+		assert.Equal(t, tt.wantCode.String(), e.Code, tt.name)
+		assert.Contains(t, e.Message, tt.wantMsg, tt.name)
+	}
+
+	code, _, _ := do(t, h, http.MethodPut, "/v1/users/1", `{}`)
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+}
+
+// шлюз поверх настоящего service.Service: ошибки репозитория доходят до клиента с правильным статусом, PATCH частичный
+func TestGateway_RealService(t *testing.T) {
+	t.Parallel()
+
+	var updated *domain.User
+	repo := &mocks.UserRepositoryMock{
+		CreateFunc: func(ctx context.Context, email, name string) (*domain.User, error) {
+			return nil, fmt.Errorf("storage.postgres.Create: %w", storage.ErrUserExists)
+		},
+		UpdateFunc: func(ctx context.Context, user *domain.User) (*domain.User, error) {
+			if user.ID != 1 {
+				return nil, fmt.Errorf("storage.postgres.Update: %w", storage.ErrNotFound)
+			}
+			updated = user
+			return &domain.User{ID: 1, Email: "a@b.c", Name: user.Name}, nil
+		},
+		DeleteFunc: func(ctx context.Context, id int64) error {
+			return fmt.Errorf("storage.postgres.Delete: %w", storage.ErrNotFound)
+		},
+	}
+	h := Handler(nil, service.NewUserService(repo, nil, nil, nil, time.Minute), Options{})
+
+	code, _, body := do(t, h, http.MethodPatch, "/v1/users/1", `{"name":"bob"}`)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.JSONEq(t, `{"id":1,"email":"a@b.c","name":"bob","created_at":"0001-01-01T00:00:00Z"}`, body)
+	require.NotNil(t, updated)
+	assert.Equal(t, domain.User{ID: 1, Name: "bob"}, *updated, "сервис передаёт в репозиторий только изменённые поля")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantCode   codes.Code
+	}{
+		{"create duplicate", http.MethodPost, "/v1/users", `{"email":"a@b.c","name":"alice"}`, http.StatusConflict, codes.AlreadyExists},
+		{"update missing", http.MethodPatch, "/v1/users/42", `{"email":"x@y.z"}`, http.StatusNotFound, codes.NotFound},
+		{"delete missing", http.MethodDelete, "/v1/users/42", "", http.StatusNotFound, codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		code, _, body := do(t, h, tt.method, tt.path, tt.body)
+		assert.Equal(t, tt.wantStatus, code, tt.name)
+		assert.Equal(t, tt.wantCode.String(), decodeError(t, body).Code, tt.name)
+	}
+}
+
+func TestGateway_InternalErrorIsHidden(t *testing.T) {
+	t.Parallel()
+
+	users := newFakeUsers()
+	users.err = fmt.Errorf("storage.postgres.GetUserByID: dial tcp 10.0.0.1:5432: connection refused")
+
+	code, _, body := do(t, Handler(nil, users, Options{}), http.MethodGet, "/v1/users/1", "")
+	require.Equal(t, http.StatusInternalServerError, code)
+
+	e := decodeError(t, body)
+	assert.Equal(t, codes.Internal.String(), e.Code)
+	assert.NotContains(t, e.Message, "10.0.0.1", "детали внутренней ошибки не должны уходить клиенту")
+}
+
+// один и тот же кривой запрос отклоняется gRPC сервером и шлюзом с одинаковым кодом и текстом
+func TestGateway_SameValidationAsGRPC(t *testing.T) {
+	t.Parallel()
+
+	users := newFakeUsers()
+	h := Handler(nil, users, Options{})
+	grpcSrv := server.NewServer(users, nil)
+
+	_, err := grpcSrv.UpdateUser(context.Background(), &userv1.UpdateUserRequest{Id: 1})
+	st, _ := status.FromError(err)
+
+	code, _, body := do(t, h, http.MethodPatch, "/v1/users/1", `{}`)
+	e := decodeError(t, body)
+
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, errorsx.HTTPStatus(st.Code()), code)
+	assert.Equal(t, st.Code().String(), e.Code)
+	assert.Equal(t, st.Message(), e.Message)
+
+	_, err = grpcSrv.GetUser(context.Background(), &userv1.GetUserRequest{Id: 7})
+	st, _ = status.FromError(err)
+
+	code, _, body = do(t, h, http.MethodGet, "/v1/users/7", "")
+	e = decodeError(t, body)
+
+	assert.Equal(t, codes.NotFound, st.Code(), "несуществующий пользователь - NotFound, а не паника на nil")
+	assert.Equal(t, errorsx.HTTPStatus(st.Code()), code)
+	assert.Equal(t, st.Message(), e.Message)
+}
+
+func TestToHTTP(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, http.StatusOK, errorsx.ToHTTP(nil))
+	assert.Equal(t, http.StatusNotFound, errorsx.ToHTTP(fmt.Errorf("op: %w", errorsx.ErrNotFound)))
+	assert.Equal(t, http.StatusConflict, errorsx.ToHTTP(errorsx.ErrAlreadyExists))
+	assert.Equal(t, http.StatusBadRequest, errorsx.ToHTTP(errorsx.ErrConflict))
+	assert.Equal(t, http.StatusBadRequest, errorsx.ToHTTP(server.ValidateID(-1)))
+	assert.Equal(t, http.StatusInternalServerError, errorsx.ToHTTP(fmt.Errorf("boom")))
+}
+
+func TestGateway_RequestID(t *testing.T) {
+	t.Parallel()
+
+	h := Handler(nil, newFakeUsers(), Options{})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/1", nil)
+	req.Header.Set("X-Request-Id", "req-42")
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, "req-42", rec.Header().Get("X-Request-Id"))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/1", nil))
+	assert.NotEmpty(t, rec.Header().Get("X-Request-Id"), "без заголовка id генерируется")
+}
+
+// паника в сервисе превращается в 500 с JSON телом, а не в оборванное соединение
+func TestGateway_PanicRecovered(t *testing.T) {
+	t.Parallel()
+
+	h := Handler(nil, nil, Options{}) // nil сервис - вызов любого метода паникует
+
+	code, _, body := do(t, h, http.MethodGet, "/v1/users/1", "")
+	require.Equal(t, http.StatusInternalServerError, code)
+
+	e := decodeError(t, body)
+	assert.Equal(t, codes.Internal.String(), e.Code)
+
+	// в метрику паник попадает шаблон маршрута, а не путь с id
+	before := panicsTotal(t, "GET /v1/users/{id}")
+	code, _, _ = do(t, h, http.MethodGet, "/v1/users/42", "")
+	require.Equal(t, http.StatusInternalServerError, code)
+	assert.Equal(t, before+1, panicsTotal(t, "GET /v1/users/{id}"))
+}
+
+// panicsTotal - значение grpc_panics_total{method} из глобального реестра, метрики глобальные, поэтому сравниваем прирост
+func panicsTotal(t *testing.T, method string) float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() != "grpc_panics_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "method" && l.GetValue() == method {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// stubAuthz пропускает только токен "good" и запоминает, что у него спросили
+type stubAuthz struct {
+	method string
+	req    any
+}
+
+func (a *stubAuthz) Authorize(ctx context.Context, fullMethod, token string, req any) (context.Context, error) {
+	a.method, a.req = fullMethod, req
+	switch token {
+	case "good":
+		return ctx, nil
+	case "":
+		return ctx, status.Error(codes.Unauthenticated, "missing bearer token")
+	default:
+		return ctx, status.Error(codes.PermissionDenied, "one of scopes [users:admin] is required")
+	}
+}
+
+func TestGateway_Auth(t *testing.T) {
+	t.Parallel()
+
+	users := newFakeUsers()
+	authz := &stubAuthz{}
+	h := Handler(nil, users, Options{Authorizer: authz})
+
+	request := func(method, path, body, token string) *httptest.ResponseRecorder {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, path, r)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodPost, "/v1/users", `{"email":"a@b.c","name":"alice"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	assert.Empty(t, users.users, "без токена сервис не вызывается")
+
+	rec = request(http.MethodPost, "/v1/users", `{"email":"a@b.c","name":"alice"}`, "good")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, userv1.UserService_CreateUser_FullMethodName, authz.method)
+
+	rec = request(http.MethodDelete, "/v1/users/1", "", "weak")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, codes.PermissionDenied.String(), decodeError(t, rec.Body.String()).Code)
+	assert.Len(t, users.users, 1)
+
+	// шлюз передаёт тот же protobuf запрос, что пришёл бы по gRPC, поэтому правило "свою запись" работает одинаково
+	rec = request(http.MethodPatch, "/v1/users/1", `{"name":"bob"}`, "good")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, userv1.UserService_UpdateUser_FullMethodName, authz.method)
+	assert.Equal(t, int64(1), authz.req.(*userv1.UpdateUserRequest).GetId())
+
+	// как и в gRPC, токен проверяется раньше тела и валидации: без токена - 401, а не 400
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodPost, "/v1/users", `{broken`},
+		{http.MethodPost, "/v1/users", `{"email":"not-an-email","name":""}`},
+		{http.MethodPatch, "/v1/users/0", `{"name":"bob"}`},
+		{http.MethodPatch, "/v1/users/1", `{"unknown":1}`},
+		{http.MethodGet, "/v1/users/abc", ""},
+		{http.MethodDelete, "/v1/users/-1", ""},
+	} {
+		rec = request(tc.method, tc.path, tc.body, "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "%s %s %s", tc.method, tc.path, tc.body)
+	}
+
+	rec = request(http.MethodPost, "/v1/users", `{broken`, "good")
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "с токеном невалидное тело - 400")
+}
+
+func TestGateway_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	users := newFakeUsers()
+	users.users[1] = &domain.User{ID: 1, Email: "a@b.c", Name: "alice"}
+
+	limiter := ratelimit.New(nil, ratelimit.Config{
+		Methods: map[string]ratelimit.Limit{"GetUser": {Rate: 0.1, Burst: 2}},
+	}, nil)
+	h := Handler(nil, users, Options{RateLimiter: limiter})
+
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/users/1", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for range 2 {
+		require.Equal(t, http.StatusOK, get("10.0.0.1:1111").Code)
+	}
+
+	// другой порт того же адреса - тот же клиент
+	rec := get("10.0.0.1:2222")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, codes.ResourceExhausted.String(), decodeError(t, rec.Body.String()).Code)
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, get("10.0.0.2:1111").Code, "у другого клиента свой лимит")
+
+	// на методы без лимита ограничение не действует
+	for range 5 {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/v1/users/1", strings.NewReader(`{"name":"bob"}`)))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+}
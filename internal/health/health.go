@@ -0,0 +1,227 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/metrics"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Имена сервисов в grpc.health.v1, которые спрашивают пробы kubernetes:
+//
+//	livenessProbe:  grpc: {port: 50051, service: liveness}  - процесс жив и отвечает, от зависимостей не зависит
+//	readinessProbe: grpc: {port: 50051, service: readiness} - можно слать трафик: все критичные зависимости доступны
+//
+// Пустое имя (общий статус сервера) и имена из readinessAliases отдают тот же статус, что и readiness.
+// Каждая зависимость дополнительно видна под своим именем (postgres, redis, kafka), это удобно для отладки через grpc-health-probe
+const (
+	LivenessService  = "liveness"
+	ReadinessService = "readiness"
+
+	defaultInterval = 10 * time.Second
+	defaultTimeout  = 2 * time.Second
+)
+
+var (
+	ErrNotChecked   = errors.New("dependency has not been checked yet")
+	ErrShuttingDown = errors.New("service is shutting down")
+)
+
+// CheckFunc проверяет доступность одной зависимости, например пингует базу
+type CheckFunc func(ctx context.Context) error
+
+// Dependency - зависимость сервиса
+// Critical = false означает, что без зависимости сервис работает в деградированном режиме (как без redis - просто без кеша),
+// поэтому её падение видно в её собственном статусе и метриках, но не снимает сервис с балансировки
+type Dependency struct {
+	Name     string
+	Check    CheckFunc
+	Critical bool
+}
+
+// Monitor периодически проверяет зависимости и выставляет статусы в grpc health сервере
+type Monitor struct {
+	log      *slog.Logger
+	server   *grpchealth.Server
+	deps     []Dependency
+	aliases  []string
+	interval time.Duration
+	timeout  time.Duration
+
+	mu           sync.RWMutex
+	results      map[string]error // имя зависимости -> результат последней проверки
+	shuttingDown bool             // после Shutdown сервис не готов, что бы ни показали проверки
+}
+
+// NewMonitor создаёт монитор, до первой проверки readiness = NOT_SERVING, liveness = SERVING
+// readinessAliases - дополнительные имена сервисов со статусом readiness, обычно имя gRPC сервиса (user.v1.UserService)
+func NewMonitor(log *slog.Logger, interval, timeout time.Duration, deps []Dependency, readinessAliases ...string) *Monitor {
+	if log == nil {
+		log = slog.Default()
+	}
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	m := &Monitor{
+		log:      log,
+		server:   grpchealth.NewServer(),
+		deps:     deps,
+		aliases:  append([]string{"", ReadinessService}, readinessAliases...),
+		interval: interval,
+		timeout:  timeout,
+		results:  make(map[string]error, len(deps)),
+	}
+
+	m.server.SetServingStatus(LivenessService, healthpb.HealthCheckResponse_SERVING)
+	for _, d := range deps {
+		m.results[d.Name] = ErrNotChecked
+		m.server.SetServingStatus(d.Name, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+	m.setReadiness(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return m
+}
+
+// Register регистрирует grpc.health.v1 в gRPC сервере
+func (m *Monitor) Register(s *grpc.Server) {
+	healthpb.RegisterHealthServer(s, m.server)
+}
+
+// Run проверяет зависимости сразу и затем раз в interval, пока не отменён ctx
+func (m *Monitor) Run(ctx context.Context) {
+	m.CheckNow(ctx)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.CheckNow(ctx)
+		}
+	}
+}
+
+// CheckNow проверяет все зависимости параллельно и обновляет статусы
+func (m *Monitor) CheckNow(ctx context.Context) {
+	const op = "health.CheckNow"
+
+	results := make([]error, len(m.deps))
+
+	var wg sync.WaitGroup
+	for i, d := range m.deps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, m.timeout)
+			defer cancel()
+			results[i] = d.Check(checkCtx)
+		}()
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	for i, d := range m.deps {
+		err := results[i]
+		prev := m.results[d.Name]
+		m.results[d.Name] = err
+
+		status := healthpb.HealthCheckResponse_SERVING
+		if err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		m.server.SetServingStatus(d.Name, status)
+		metrics.SetDependencyUp(d.Name, err == nil)
+
+		// в лог пишем только смену состояния, иначе недоступный redis писал бы ошибку каждые interval
+		switch {
+		case err != nil && (prev == nil || errors.Is(prev, ErrNotChecked)):
+			if d.Critical {
+				m.log.Error("dependency is unavailable", slog.String("op", op), slog.String("dependency", d.Name), sl.Err(err))
+			} else {
+				m.log.Warn("dependency is unavailable, service is degraded", slog.String("op", op), slog.String("dependency", d.Name), sl.Err(err))
+			}
+		case err == nil && prev != nil && !errors.Is(prev, ErrNotChecked):
+			m.log.Info("dependency is available again", slog.String("op", op), slog.String("dependency", d.Name))
+		}
+	}
+	readiness := m.readinessLocked()
+	m.mu.Unlock()
+
+	m.setReadiness(readiness)
+}
+
+// Ready возвращает ошибку первой недоступной критичной зависимости или ErrShuttingDown после Shutdown, nil - сервис готов принимать трафик
+func (m *Monitor) Ready() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.shuttingDown {
+		return ErrShuttingDown
+	}
+
+	for _, d := range m.deps {
+		if err := m.results[d.Name]; err != nil && d.Critical {
+			return fmt.Errorf("%s: %w", d.Name, err)
+		}
+	}
+	return nil
+}
+
+// Degraded возвращает имена недоступных некритичных зависимостей
+func (m *Monitor) Degraded() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var names []string
+	for _, d := range m.deps {
+		if m.results[d.Name] != nil && !d.Critical {
+			names = append(names, d.Name)
+		}
+	}
+	return names
+}
+
+// Shutdown переводит все статусы (и liveness тоже) в NOT_SERVING, вызывается в начале остановки сервера,
+// что бы балансировщик перестал слать новые запросы, пока GracefulStop дорабатывает текущие
+// Ready (и /readyz админки) с этого момента тоже отвечает "не готов"
+func (m *Monitor) Shutdown() {
+	m.mu.Lock()
+	m.shuttingDown = true
+	m.mu.Unlock()
+
+	m.server.Shutdown()
+}
+
+func (m *Monitor) readinessLocked() healthpb.HealthCheckResponse_ServingStatus {
+	if m.shuttingDown {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	for _, d := range m.deps {
+		if m.results[d.Name] != nil && d.Critical {
+			return healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+func (m *Monitor) setReadiness(status healthpb.HealthCheckResponse_ServingStatus) {
+	for _, name := range m.aliases {
+		m.server.SetServingStatus(name, status)
+	}
+}
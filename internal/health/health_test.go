@@ -0,0 +1,96 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func status(t *testing.T, m *Monitor, service string) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+
+	resp, err := m.server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	require.NoError(t, err)
+	return resp.GetStatus()
+}
+
+// переключаемая зависимость: возвращает ошибку, пока down = true
+type switchDep struct {
+	down atomic.Bool
+}
+
+func (d *switchDep) check(ctx context.Context) error {
+	if d.down.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestMonitor_ReadinessAndLiveness(t *testing.T) {
+	t.Parallel()
+
+	var postgres, redis switchDep
+
+	m := NewMonitor(nil, 0, 0, []Dependency{
+		{Name: "postgres", Check: postgres.check, Critical: true},
+		{Name: "redis", Check: redis.check, Critical: false},
+	}, "user.v1.UserService")
+
+	// до первой проверки трафик не принимаем, но процесс жив
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, m, ReadinessService))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, m, LivenessService))
+	require.ErrorIs(t, m.Ready(), ErrNotChecked)
+
+	m.CheckNow(context.Background())
+	for _, service := range []string{"", ReadinessService, "user.v1.UserService", "postgres", "redis"} {
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, m, service), service)
+	}
+	require.NoError(t, m.Ready())
+
+	// redis упал - сервис деградировал, но остаётся готовым
+	redis.down.Store(true)
+	m.CheckNow(context.Background())
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, m, ReadinessService))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, m, "redis"))
+	assert.Equal(t, []string{"redis"}, m.Degraded())
+	require.NoError(t, m.Ready())
+
+	// postgres упал - снимаем с балансировки, но liveness не трогаем, перезапуск пода базу не починит
+	postgres.down.Store(true)
+	m.CheckNow(context.Background())
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, m, ReadinessService))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, m, "user.v1.UserService"))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, m, LivenessService))
+	require.Error(t, m.Ready())
+
+	postgres.down.Store(false)
+	redis.down.Store(false)
+	m.CheckNow(context.Background())
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, m, ReadinessService))
+	assert.Empty(t, m.Degraded())
+}
+
+func TestMonitor_Shutdown(t *testing.T) {
+	t.Parallel()
+
+	m := NewMonitor(nil, 0, 0, []Dependency{{Name: "postgres", Check: func(ctx context.Context) error { return nil }, Critical: true}})
+	m.CheckNow(context.Background())
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, m, ReadinessService))
+	require.NoError(t, m.Ready())
+
+	m.Shutdown()
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, m, ReadinessService))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, m, LivenessService))
+	// /readyz админки смотрит в Ready и должен отвечать так же, как gRPC
+	require.ErrorIs(t, m.Ready(), ErrShuttingDown)
+
+	// после Shutdown проверки уже не возвращают SERVING
+	m.CheckNow(context.Background())
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, m, ReadinessService))
+	require.ErrorIs(t, m.Ready(), ErrShuttingDown)
+}
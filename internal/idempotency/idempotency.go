@@ -0,0 +1,257 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	userv1 "github.com/Derbik-Git/protos-tren-redis/user/v1"
+	"github.com/Derbik-Git/user-service/internal/auth"
+	"github.com/Derbik-Git/user-service/internal/metrics"
+	"github.com/Derbik-Git/user-service/internal/mtls"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// KeyHeader - metadata с ключом идемпотентности, клиент генерирует его один раз на операцию и повторяет во всех ретраях
+	KeyHeader = "idempotency-key"
+	// ReplayedHeader = "true" в ответе, если ответ взят из сохранённого, а не получен новым вызовом
+	ReplayedHeader = "idempotent-replayed"
+
+	maxKeyLength = 255
+
+	// сколько живёт резерв ключа, пока первый запрос выполняется: если реплика упала посреди запроса,
+	// ключ освободится через это время, а не через весь TTL
+	pendingTTL = time.Minute
+)
+
+var (
+	ErrKeyInProgress = errors.New("request with this idempotency key is still in progress")
+	ErrKeyMismatch   = errors.New("idempotency key was already used with a different request")
+)
+
+// Record - то, что хранится по ключу
+type Record struct {
+	Fingerprint string `json:"fingerprint"`        // хеш метода и тела запроса
+	Response    []byte `json:"response,omitempty"` // protobuf ответа, nil - первый запрос ещё выполняется
+}
+
+// Store - хранилище ключей: redis с TTL (RedisStore) и postgres (postgres.IdempotencyStore) как запасной вариант
+type Store interface {
+	// Reserve занимает свободный ключ под новый запрос (existing = nil) или возвращает запись, которая уже есть по ключу
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (existing *Record, err error)
+	// Complete сохраняет ответ, теперь повтор с тем же ключом получит его, а не выполнит запрос ещё раз
+	Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error
+	// Release освобождает ключ после ошибки, что бы клиент мог повторить запрос с тем же ключом
+	Release(ctx context.Context, key string) error
+}
+
+// Interceptor повторяет сохранённый ответ для ретраев с тем же ключом идемпотентности
+// Запросы без ключа и методы не из Methods проходят как обычно
+type Interceptor struct {
+	log *slog.Logger
+
+	Store Store
+	TTL   time.Duration // сколько хранится ответ, столько клиент может повторять запрос с тем же ключом
+
+	// Methods - методы с поддержкой ключа: полное имя -> пустой ответ для разбора сохранённого
+	Methods map[string]func() proto.Message
+}
+
+// DefaultMethods - CreateUser: повтор после таймаута не должен создавать второго пользователя или получать AlreadyExists
+func DefaultMethods() map[string]func() proto.Message {
+	return map[string]func() proto.Message{
+		userv1.UserService_CreateUser_FullMethodName: func() proto.Message { return &userv1.CreateUserResponse{} },
+	}
+}
+
+func New(log *slog.Logger, store Store, ttl time.Duration) *Interceptor {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &Interceptor{
+		log:     log,
+		Store:   store,
+		TTL:     ttl,
+		Methods: DefaultMethods(),
+	}
+}
+
+// UnaryInterceptor ставится после авторизации: ключи разных клиентов не пересекаются, у каждого subject своё пространство ключей
+func (i *Interceptor) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		newResponse, ok := i.Methods[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		key, err := keyFromMetadata(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return handler(ctx, req)
+		}
+
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		return i.do(ctx, info.FullMethod, key, msg, newResponse, func(ctx context.Context) (proto.Message, error) {
+			resp, err := handler(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			return resp.(proto.Message), nil
+		})
+	}
+}
+
+func (i *Interceptor) do(
+	ctx context.Context,
+	method, key string,
+	req proto.Message,
+	newResponse func() proto.Message,
+	call func(context.Context) (proto.Message, error),
+) (proto.Message, error) {
+	const op = "idempotency.Interceptor.do"
+
+	log := sl.FromContext(ctx, i.log).With(slog.String("op", op))
+
+	fingerprint, err := Fingerprint(method, req)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	storeKey := StoreKey(scope(ctx), method, key)
+
+	existing, err := i.Store.Reserve(ctx, storeKey, fingerprint, pendingTTL)
+	if err != nil {
+		// без хранилища ключей запрос всё равно выполняется: лучше редкий дубль при ретрае, чем отказ во всех запросах с ключом
+		log.Error("idempotency store is unavailable, request is executed without replay protection", sl.Err(err))
+		metrics.IdempotencyRequest(method, "store_error")
+		return call(ctx)
+	}
+
+	if existing != nil {
+		switch {
+		case existing.Fingerprint != fingerprint:
+			metrics.IdempotencyRequest(method, "mismatch")
+			return nil, status.Error(codes.InvalidArgument, ErrKeyMismatch.Error())
+		case existing.Response == nil:
+			metrics.IdempotencyRequest(method, "in_progress")
+			return nil, status.Error(codes.Aborted, ErrKeyInProgress.Error())
+		}
+
+		resp := newResponse()
+		if err := proto.Unmarshal(existing.Response, resp); err != nil {
+			log.Error("failed to decode stored response", sl.Err(err))
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+
+		metrics.IdempotencyRequest(method, "replayed")
+		log.Info("idempotent request replayed")
+		_ = grpc.SetHeader(ctx, metadata.Pairs(ReplayedHeader, "true"))
+		return resp, nil
+	}
+
+	metrics.IdempotencyRequest(method, "new")
+
+	resp, err := call(ctx)
+	if err != nil {
+		// по дедлайну или отмене неизвестно, записан ли пользователь: дедлайн мог сработать уже после COMMIT
+		// ключ не освобождаем, ретраи получат Aborted, пока резерв не истечёт (pendingTTL), но не создадут дубль
+		if outcomeUnknown(err) {
+			log.Warn("request outcome is unknown, idempotency key stays reserved until it expires", sl.Err(err))
+			return nil, err
+		}
+
+		// ошибку не запоминаем: запрос ничего не изменил, ретрай с тем же ключом должен выполниться заново
+		// ctx клиента к этому моменту может быть отменён, а ключ освободить нужно всё равно
+		if rerr := i.Store.Release(context.WithoutCancel(ctx), storeKey); rerr != nil {
+			log.Warn("failed to release idempotency key", sl.Err(rerr))
+		}
+		return nil, err
+	}
+
+	body, err := proto.Marshal(resp)
+	if err == nil {
+		err = i.Store.Complete(context.WithoutCancel(ctx), storeKey, Record{Fingerprint: fingerprint, Response: body}, i.TTL)
+	}
+	if err != nil {
+		// пользователь уже создан, поэтому ответ отдаём, но повтор с этим ключом выполнится заново
+		log.Error("failed to store idempotent response", sl.Err(err))
+	}
+
+	return resp, nil
+}
+
+// outcomeUnknown - запрос прерван дедлайном или отменой, а не отклонён: изменения в базе могли успеть сохраниться
+func outcomeUnknown(err error) bool {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.Canceled:
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+func keyFromMetadata(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	vals := md.Get(KeyHeader)
+	if len(vals) == 0 {
+		return "", nil
+	}
+
+	key := strings.TrimSpace(vals[0])
+	if len(key) > maxKeyLength {
+		return "", status.Errorf(codes.InvalidArgument, "%s must be at most %d characters", KeyHeader, maxKeyLength)
+	}
+	return key, nil
+}
+
+// scope - чей ключ: одинаковые ключи разных клиентов - это разные операции
+func scope(ctx context.Context) string {
+	if p, ok := auth.PrincipalFromContext(ctx); ok && p.Subject != "" {
+		return "sub:" + p.Subject
+	}
+	if id, ok := mtls.IdentityFromContext(ctx); ok {
+		return "cert:" + id.Name()
+	}
+	return ""
+}
+
+// StoreKey - ключ в хранилище: хеш клиента, метода и ключа, поэтому длина ключа в redis и postgres постоянна
+func StoreKey(scope, method, key string) string {
+	sum := sha256.Sum256([]byte(scope + "\n" + method + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Fingerprint - хеш метода и запроса, protobuf сериализуется детерминированно, поэтому одинаковые запросы дают одинаковый хеш
+func Fingerprint(method string, req proto.Message) (string, error) {
+	const op = "idempotency.Fingerprint"
+
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,247 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	userv1 "github.com/Derbik-Git/protos-tren-redis/user/v1"
+	"github.com/Derbik-Git/user-service/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// memoryStore - Store в памяти, err - ошибка всех методов (недоступное хранилище)
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+	err     error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: map[string]Record{}}
+}
+
+func (s *memoryStore) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	if rec, ok := s.records[key]; ok {
+		return &rec, nil
+	}
+	s.records[key] = Record{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (s *memoryStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.records[key] = rec
+	return nil
+}
+
+func (s *memoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	if s.records[key].Response == nil {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// createHandler создаёт пользователя с новым id на каждый вызов, как сервис
+type createHandler struct {
+	calls int
+	err   error
+}
+
+func (h *createHandler) handle(ctx context.Context, req any) (any, error) {
+	if h.err != nil {
+		return nil, h.err
+	}
+	h.calls++
+	r := req.(*userv1.CreateUserRequest)
+	return &userv1.CreateUserResponse{User: &userv1.User{Id: int64(h.calls), Email: r.GetEmail(), Name: r.GetName()}}, nil
+}
+
+func call(t *testing.T, i *Interceptor, h *createHandler, ctx context.Context, key string, req *userv1.CreateUserRequest) (*userv1.CreateUserResponse, error) {
+	t.Helper()
+
+	if key != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(KeyHeader, key))
+	}
+	resp, err := i.UnaryInterceptor()(ctx, req, &grpc.UnaryServerInfo{FullMethod: userv1.UserService_CreateUser_FullMethodName}, h.handle)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*userv1.CreateUserResponse), nil
+}
+
+func TestInterceptor_ReplaysResponse(t *testing.T) {
+	t.Parallel()
+
+	i := New(nil, newMemoryStore(), time.Hour)
+	h := &createHandler{}
+	ctx := context.Background()
+	req := &userv1.CreateUserRequest{Email: "a@b.c", Name: "alice"}
+
+	first, err := call(t, i, h, ctx, "key-1", req)
+	require.NoError(t, err)
+
+	again, err := call(t, i, h, ctx, "key-1", req)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(first, again), "ретрай получает исходный ответ")
+	assert.Equal(t, 1, h.calls, "пользователь создан один раз")
+
+	// тот же ключ с другим телом - ошибка клиента, а не новый пользователь
+	_, err = call(t, i, h, ctx, "key-1", &userv1.CreateUserRequest{Email: "a@b.c", Name: "bob"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, 1, h.calls)
+
+	_, err = call(t, i, h, ctx, "key-2", req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, h.calls, "новый ключ - новая операция")
+
+	for range 2 {
+		_, err = call(t, i, h, ctx, "", req)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 4, h.calls, "без ключа запрос выполняется каждый раз")
+
+	_, err = call(t, i, h, ctx, strings.Repeat("k", maxKeyLength+1), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestInterceptor_KeysAreScopedByClient(t *testing.T) {
+	t.Parallel()
+
+	i := New(nil, newMemoryStore(), time.Hour)
+	h := &createHandler{}
+	req := &userv1.CreateUserRequest{Email: "a@b.c", Name: "alice"}
+
+	alice := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "alice"})
+	bob := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "bob"})
+
+	_, err := call(t, i, h, alice, "same-key", req)
+	require.NoError(t, err)
+	_, err = call(t, i, h, bob, "same-key", req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, h.calls)
+}
+
+func TestInterceptor_InProgressAndErrors(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore()
+	i := New(nil, store, time.Hour)
+	ctx := context.Background()
+	req := &userv1.CreateUserRequest{Email: "a@b.c", Name: "alice"}
+
+	// первый запрос ещё выполняется, второй с тем же ключом не должен выполниться параллельно
+	fp, err := Fingerprint(userv1.UserService_CreateUser_FullMethodName, req)
+	require.NoError(t, err)
+	_, err = store.Reserve(ctx, StoreKey("", userv1.UserService_CreateUser_FullMethodName, "busy"), fp, time.Minute)
+	require.NoError(t, err)
+
+	h := &createHandler{}
+	_, err = call(t, i, h, ctx, "busy", req)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Zero(t, h.calls)
+
+	// ошибка не запоминается, ключ освобождается и ретрай выполняется заново
+	h.err = status.Error(codes.Unavailable, "db is down")
+	_, err = call(t, i, h, ctx, "retry", req)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	h.err = nil
+	_, err = call(t, i, h, ctx, "retry", req)
+	require.NoError(t, err)
+	assert.Equal(t, 1, h.calls)
+
+	// по дедлайну неизвестно, создан ли пользователь, поэтому ключ остаётся занятым и ретрай не создаст дубль
+	h.err = status.Error(codes.DeadlineExceeded, "context deadline exceeded")
+	_, err = call(t, i, h, ctx, "timeout", req)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	h.err = nil
+	_, err = call(t, i, h, ctx, "timeout", req)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Equal(t, 1, h.calls)
+
+	// без хранилища запросы выполняются, просто без защиты от дублей
+	store.err = errors.New("store is down")
+	_, err = call(t, i, h, ctx, "retry", req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, h.calls)
+}
+
+func TestFallback(t *testing.T) {
+	t.Parallel()
+
+	primary, secondary := newMemoryStore(), newMemoryStore()
+	f := NewFallback(nil, primary, secondary)
+	ctx := context.Background()
+
+	existing, err := f.Reserve(ctx, "k1", "fp", time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, existing)
+	assert.Contains(t, primary.records, "k1")
+	assert.NotContains(t, secondary.records, "k1")
+
+	primary.err = errors.New("redis is down")
+
+	existing, err = f.Reserve(ctx, "k2", "fp", time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, existing)
+	require.NoError(t, f.Complete(ctx, "k2", Record{Fingerprint: "fp", Response: []byte("resp")}, time.Hour))
+	assert.Equal(t, []byte("resp"), secondary.records["k2"].Response)
+
+	existing, err = f.Reserve(ctx, "k2", "fp", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, []byte("resp"), existing.Response)
+
+	secondary.err = errors.New("postgres is down")
+	_, err = f.Reserve(ctx, "k3", "fp", time.Minute)
+	assert.Error(t, err)
+}
+
+// notReservedStore - основное хранилище, в котором ключ уже занят другой записью
+type notReservedStore struct {
+	*memoryStore
+}
+
+func (s notReservedStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	return ErrKeyNotReserved
+}
+
+// "ключ уже чужой" - не отказ основного хранилища, запасное при этом не трогаем
+func TestFallback_CompleteNotReserved(t *testing.T) {
+	t.Parallel()
+
+	secondary := newMemoryStore()
+	f := NewFallback(nil, notReservedStore{newMemoryStore()}, secondary)
+
+	err := f.Complete(context.Background(), "k", Record{Fingerprint: "fp", Response: []byte("resp")}, time.Hour)
+	require.ErrorIs(t, err, ErrKeyNotReserved)
+	assert.NotContains(t, secondary.records, "k")
+}
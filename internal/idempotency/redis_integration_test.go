@@ -0,0 +1,86 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// redis из internal/docker_redis_test/docker-compose.test.yaml
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	t.Cleanup(func() { _ = client.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis is not available: %v", err)
+	}
+	return client
+}
+
+func TestRedisStore(t *testing.T) {
+	t.Parallel()
+
+	client := newTestRedis(t)
+	s := NewRedisStore(client)
+	ctx := context.Background()
+	key := fmt.Sprintf("test-%d", time.Now().UnixNano())
+
+	existing, err := s.Reserve(ctx, key, "fp", time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, existing)
+
+	existing, err = s.Reserve(ctx, key, "fp", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Nil(t, existing.Response, "первый запрос ещё выполняется")
+
+	require.NoError(t, s.Complete(ctx, key, Record{Fingerprint: "fp", Response: []byte{1, 2, 3}}, time.Hour))
+
+	existing, err = s.Reserve(ctx, key, "other", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, "fp", existing.Fingerprint)
+	assert.Equal(t, []byte{1, 2, 3}, existing.Response)
+
+	ttl, err := client.PTTL(ctx, "idempotency:"+key).Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, 59*time.Minute)
+
+	// готовый ответ Release не удаляет, а второй Complete его не перетирает
+	require.NoError(t, s.Release(ctx, key))
+	require.ErrorIs(t, s.Complete(ctx, key, Record{Fingerprint: "fp", Response: []byte{9}}, time.Hour), ErrKeyNotReserved)
+	existing, err = s.Reserve(ctx, key, "fp", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, []byte{1, 2, 3}, existing.Response)
+
+	// резерв без ответа Release освобождает
+	pendingKey := key + "-pending"
+	existing, err = s.Reserve(ctx, pendingKey, "fp", time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, existing)
+	require.NoError(t, s.Release(ctx, pendingKey))
+	existing, err = s.Reserve(ctx, pendingKey, "fp", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// резерв другого запроса (наш истёк, ключ занял ретрай с другим телом) Complete не перетирает
+	require.ErrorIs(t, s.Complete(ctx, pendingKey, Record{Fingerprint: "other", Response: []byte{1}}, time.Hour), ErrKeyNotReserved)
+
+	// ключа нет (резерв истёк) - ответ всё равно сохраняется, как upsert в postgres
+	expiredKey := key + "-expired"
+	require.NoError(t, s.Complete(ctx, expiredKey, Record{Fingerprint: "fp", Response: []byte{4}}, time.Hour))
+	existing, err = s.Reserve(ctx, expiredKey, "fp", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, []byte{4}, existing.Response)
+}
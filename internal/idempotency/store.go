@@ -0,0 +1,186 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrKeyNotReserved - Complete не записал ответ: по ключу уже лежит готовый ответ или резерв другого запроса
+// (наш резерв истёк за pendingTTL, и ключ занял следующий ретрай), чужую запись не перетираем
+var ErrKeyNotReserved = errors.New("idempotency key is not reserved by this request")
+
+// completeScript записывает ответ, только если по ключу наш резерв (тот же fingerprint, ответа ещё нет) или ключа нет вовсе
+// пустой ключ - как upsert в postgres: резерв мог истечь, а ответ всё равно стоит сохранить для следующих ретраев
+// KEYS[1] - ключ, ARGV[1] - запись, ARGV[2] - fingerprint, ARGV[3] - TTL в миллисекундах (0 - без TTL, как Set)
+// ответ: 1 - записано, 0 - ключ занят другой записью
+var completeScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if cur then
+	local rec = cjson.decode(cur)
+	if rec.fingerprint ~= ARGV[2] or (rec.response ~= nil and rec.response ~= cjson.null) then
+		return 0
+	end
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// releaseScript удаляет ключ, только если ответа по нему ещё нет, как DELETE ... AND response IS NULL в postgres
+// готовый ответ должен пережить Release, иначе ретрай выполнит запрос второй раз
+var releaseScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if not cur then
+	return 0
+end
+local rec = cjson.decode(cur)
+if rec.response ~= nil and rec.response ~= cjson.null then
+	return 0
+end
+return redis.call('DEL', KEYS[1])
+`)
+
+// RedisStore - ключи в redis, TTL ставит сам redis
+type RedisStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStore использует клиент кеша (cache.RedisCache.Client)
+func NewRedisStore(client redis.Cmdable) *RedisStore {
+	return &RedisStore{client: client, prefix: "idempotency:"}
+}
+
+func (s *RedisStore) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Record, error) {
+	const op = "idempotency.RedisStore.Reserve"
+
+	pending, err := json.Marshal(Record{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// между SETNX и GET ключ может истечь, тогда пробуем занять его ещё раз
+	for range 2 {
+		ok, err := s.client.SetNX(ctx, s.prefix+key, pending, ttl).Result()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if ok {
+			return nil, nil
+		}
+
+		data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return &rec, nil
+	}
+
+	return nil, fmt.Errorf("%s: key %s keeps expiring", op, key)
+}
+
+func (s *RedisStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	const op = "idempotency.RedisStore.Complete"
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// GET и SET одним скриптом: между ними ключ может занять или дописать другой запрос
+	written, err := completeScript.Run(ctx, s.client, []string{s.prefix + key}, data, rec.Fingerprint, ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if written == 0 {
+		return fmt.Errorf("%s: %w", op, ErrKeyNotReserved)
+	}
+	return nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	const op = "idempotency.RedisStore.Release"
+
+	if err := releaseScript.Run(ctx, s.client, []string{s.prefix + key}).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Fallback - основное хранилище (redis) и запасное (postgres), которое используется, пока основное отвечает ошибками
+// пока redis недоступен, ключи, занятые в нём раньше, не видны, поэтому защита от дублей на это время слабее, но не пропадает совсем
+type Fallback struct {
+	log       *slog.Logger
+	Primary   Store
+	Secondary Store
+}
+
+func NewFallback(log *slog.Logger, primary, secondary Store) *Fallback {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &Fallback{log: log, Primary: primary, Secondary: secondary}
+}
+
+func (f *Fallback) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Record, error) {
+	const op = "idempotency.Fallback.Reserve"
+
+	rec, err := f.Primary.Reserve(ctx, key, fingerprint, ttl)
+	if err == nil {
+		return rec, nil
+	}
+	f.warn(ctx, op, err)
+
+	return f.Secondary.Reserve(ctx, key, fingerprint, ttl)
+}
+
+// Complete пишет в основное хранилище, а при его ошибке - в запасное: ключ мог быть занят в любом из них
+// ErrKeyNotReserved - не отказ хранилища, а ответ "ключ уже чужой", его в запасное хранилище не переносим
+func (f *Fallback) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	const op = "idempotency.Fallback.Complete"
+
+	err := f.Primary.Complete(ctx, key, rec, ttl)
+	if err == nil || errors.Is(err, ErrKeyNotReserved) {
+		return err
+	}
+	f.warn(ctx, op, err)
+
+	return f.Secondary.Complete(ctx, key, rec, ttl)
+}
+
+// Release освобождает ключ в обоих хранилищах, ошибка - только если не удалось ни в одном
+func (f *Fallback) Release(ctx context.Context, key string) error {
+	const op = "idempotency.Fallback.Release"
+
+	perr := f.Primary.Release(ctx, key)
+	if perr != nil {
+		f.warn(ctx, op, perr)
+	}
+	serr := f.Secondary.Release(ctx, key)
+	if perr != nil && serr != nil {
+		return serr
+	}
+	return nil
+}
+
+func (f *Fallback) warn(ctx context.Context, op string, err error) {
+	sl.FromContext(ctx, f.log).Warn("primary idempotency store failed, using fallback", slog.String("op", op), sl.Err(err))
+}
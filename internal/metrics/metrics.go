@@ -2,10 +2,14 @@ package metrics
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // это логика нашего перехватчика(прометеуса), UnaryInterceptor - это перехватчик ивентов, в него поступает ивент, он увеличивает счётчик
@@ -20,6 +24,7 @@ gRPCServer := grpc.NewServer(
 // рещаеться слудующим образом:
 // gRPC-сервер (порт :50051) принимает запросы и обновляет метрики в оперативке.
 // Вспомогательный HTTP-сервер (порт :2112), который мы открыли читает их из оперативки и отдает Прометеусу на /metrics.
+// Этот сервер - internal/admin, его запускает и останавливает app.App вместе с gRPC сервером (флаг -admin-port), пример ниже оставлен для понимания
 // в app_main.go:
 //mux := http.NewServeMux()
 //mux.Handle("/metrics", promhttp.Handler())
@@ -89,14 +94,228 @@ func UnaryInterceptor() grpc.UnaryServerInterceptor {
 
 		resp, err := handler(ctx, req)
 
-		status := "success"
-		if err != nil {
-			status = "error"
-		}
-
 		// сколько запросов пришло в систему всего, помечаем, какой запрос успешно прошёл, а какой с ошибкой
-		requestsTotal.WithLabelValues(info.FullMethod, status).Inc()
+		countRequest(info.FullMethod, err)
 
 		return resp, err
 	}
 }
+
+// StreamInterceptor - те же метрики для стримов, длительность - время жизни стрима
+func StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		inFlightRequests.WithLabelValues(info.FullMethod).Inc()
+		defer inFlightRequests.WithLabelValues(info.FullMethod).Dec()
+
+		timer := prometheus.NewTimer(requestDuration.WithLabelValues(info.FullMethod))
+		defer timer.ObserveDuration()
+
+		err := handler(srv, ss)
+
+		countRequest(info.FullMethod, err)
+
+		return err
+	}
+}
+
+// запросы, закончившиеся по дедлайну, - отдельный счётчик, что бы медленные запросы было видно, не разбирая логи
+// в grpc_requests_total они остаются со status="error", как и раньше, поэтому дашборды и алерты на него не меняются
+var requestsDeadlineExceeded = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "grpc_requests_deadline_exceeded_total",
+		Help: "Total number of gRPC requests that failed because their deadline expired",
+	},
+	[]string{"method"},
+)
+
+// countRequest считает завершённый запрос: grpc_requests_total{status=success|error} и дедлайны отдельно
+func countRequest(method string, err error) {
+	if err == nil {
+		requestsTotal.WithLabelValues(method, "success").Inc()
+		return
+	}
+
+	requestsTotal.WithLabelValues(method, "error").Inc()
+	if status.Code(err) == codes.DeadlineExceeded || errors.Is(err, context.DeadlineExceeded) {
+		requestsDeadlineExceeded.WithLabelValues(method).Inc()
+	}
+}
+
+// счётчик сообщений, которые продюсер kafka доставил или не смог доставить
+// в async режиме ошибка записи не возвращается в сервис, поэтому этот счётчик - единственный способ увидеть потерянные события
+var kafkaProducedMessages = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "kafka_producer_messages_total",
+		Help: "Total number of messages delivered (or failed to deliver) by the kafka producer",
+	},
+	[]string{"topic", "status"},
+)
+
+// ObserveKafkaDelivery вызывается из отчёта о доставке продюсера, err != nil означает, что все сообщения пачки не доставлены
+func ObserveKafkaDelivery(topic string, messages int, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+
+	kafkaProducedMessages.WithLabelValues(topic, status).Add(float64(messages))
+}
+
+// метрики консьюмера kafka: без них про зависший консьюмер можно узнать только по логам
+var (
+	kafkaConsumedMessages = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_consumer_messages_total",
+			Help: "Total number of messages processed by the kafka consumer",
+		},
+		[]string{"topic", "event_type", "status"}, // status: success | error | decode_error
+	)
+
+	kafkaHandlerDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "kafka_consumer_handler_duration_seconds",
+			Help: "Duration of the kafka consumer handler",
+		},
+		[]string{"topic", "event_type"},
+	)
+
+	kafkaCommitFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_consumer_commit_failures_total",
+			Help: "Total number of failed offset commits",
+		},
+		[]string{"topic"},
+	)
+
+	// лаг - сколько сообщений в партиции ещё не прочитано, растущий лаг = консьюмер не успевает или стоит
+	kafkaConsumerLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_lag",
+			Help: "Number of messages the kafka consumer is behind the end of the partition",
+		},
+		[]string{"topic"},
+	)
+
+	// время последнего успешного FetchMessage, алерт: time() - kafka_consumer_last_fetch_timestamp_seconds > N
+	kafkaLastFetch = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_last_fetch_timestamp_seconds",
+			Help: "Unix time of the last successful fetch of the kafka consumer",
+		},
+		[]string{"topic"},
+	)
+)
+
+// KafkaMessageProcessed считает обработанное консьюмером сообщение
+func KafkaMessageProcessed(topic, eventType, status string) {
+	kafkaConsumedMessages.WithLabelValues(topic, eventType, status).Inc()
+}
+
+// ObserveKafkaHandler записывает время работы хендлера, в пакетном режиме eventType = "batch", а время - на всю пачку
+func ObserveKafkaHandler(topic, eventType string, d time.Duration) {
+	kafkaHandlerDuration.WithLabelValues(topic, eventType).Observe(d.Seconds())
+}
+
+func KafkaCommitFailed(topic string) {
+	kafkaCommitFailures.WithLabelValues(topic).Inc()
+}
+
+func SetKafkaConsumerLag(topic string, lag int64) {
+	kafkaConsumerLag.WithLabelValues(topic).Set(float64(lag))
+}
+
+func SetKafkaLastFetch(topic string, t time.Time) {
+	kafkaLastFetch.WithLabelValues(topic).Set(float64(t.Unix()))
+}
+
+// доступность зависимостей сервиса по результатам health проверок: 1 - доступна, 0 - нет
+var dependencyUp = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "dependency_up",
+		Help: "Whether a service dependency passed its last health check",
+	},
+	[]string{"dependency"},
+)
+
+func SetDependencyUp(dependency string, up bool) {
+	v := 0.0
+	if up {
+		v = 1
+	}
+	dependencyUp.WithLabelValues(dependency).Set(v)
+}
+
+// паники в обработчиках запросов, перехваченные recovery интерцептором (и middleware HTTP шлюза)
+// любое ненулевое значение - это баг, на него стоит повесить алерт
+var panicsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "grpc_panics_total",
+		Help: "Total number of panics recovered in request handlers",
+	},
+	[]string{"method"},
+)
+
+func PanicRecovered(method string) {
+	panicsTotal.WithLabelValues(method).Inc()
+}
+
+// запросы, отклонённые rate limiter'ом (ResourceExhausted), рост по одному методу - повод поискать клиента в логах по "rate limit exceeded"
+var rateLimitedTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "rate_limited_requests_total",
+		Help: "Total number of requests rejected by the rate limiter",
+	},
+	[]string{"method"},
+)
+
+func RateLimited(method string) {
+	rateLimitedTotal.WithLabelValues(method).Inc()
+}
+
+// запросы с ключом идемпотентности по результату: new | replayed | mismatch | in_progress | store_error
+var idempotencyRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "idempotency_requests_total",
+		Help: "Total number of requests with an idempotency key by outcome",
+	},
+	[]string{"method", "result"},
+)
+
+func IdempotencyRequest(method, result string) {
+	idempotencyRequests.WithLabelValues(method, result).Inc()
+}
+
+// подписчики WatchUsers: сколько сейчас подключено и сколько отключено за то, что не успевали читать
+var (
+	watchSubscribers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "watch_subscribers",
+		Help: "Current number of WatchUsers subscribers",
+	})
+
+	watchDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "watch_subscribers_dropped_total",
+		Help: "Total number of WatchUsers subscribers disconnected for being too slow",
+	})
+)
+
+func SetWatchSubscribers(n int) {
+	watchSubscribers.Set(float64(n))
+}
+
+func WatchSubscriberDropped() {
+	watchDropped.Inc()
+}
+
+// обращения сервиса к зависимостям (layer: cache | db | broker), прерванные по таймауту
+// deadline=layer - не уложились в бюджет слоя (service.Timeouts), deadline=request - закончился дедлайн всего запроса
+var dependencyTimeouts = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "service_dependency_timeouts_total",
+		Help: "Total number of service calls to dependencies that exceeded their deadline",
+	},
+	[]string{"layer", "op", "deadline"},
+)
+
+func DependencyTimeout(layer, op, deadline string) {
+	dependencyTimeouts.WithLabelValues(layer, op, deadline).Inc()
+}
@@ -0,0 +1,112 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+
+	"github.com/Derbik-Git/user-service/internal/server"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Identity - кто подключился по mTLS, берётся только из сертификата, который прошёл проверку по CA клиентов
+type Identity struct {
+	CommonName string
+	URIs       []string // URI SAN, например spiffe://cluster.local/ns/billing/sa/billing
+	DNSNames   []string
+	Serial     string
+}
+
+// Name - имя клиента для авторизации и аудита: первый URI SAN (SPIFFE ID), если его нет - CN
+func (id Identity) Name() string {
+	if len(id.URIs) > 0 {
+		return id.URIs[0]
+	}
+	return id.CommonName
+}
+
+func identityFromCert(c *x509.Certificate) Identity {
+	id := Identity{
+		CommonName: c.Subject.CommonName,
+		DNSNames:   c.DNSNames,
+		Serial:     c.SerialNumber.String(),
+	}
+	for _, u := range c.URIs {
+		id.URIs = append(id.URIs, u.String())
+	}
+	return id
+}
+
+// FromConnectionState достаёт проверенный сертификат клиента, ok = false - клиент пришёл без сертификата
+// PeerCertificates без VerifiedChains не используются: такой сертификат никто не проверял
+func FromConnectionState(st *tls.ConnectionState) (Identity, bool) {
+	if st == nil || len(st.VerifiedChains) == 0 || len(st.VerifiedChains[0]) == 0 {
+		return Identity{}, false
+	}
+	return identityFromCert(st.VerifiedChains[0][0]), true
+}
+
+// FromPeer - то же для gRPC соединения
+func FromPeer(ctx context.Context) (Identity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Identity{}, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return Identity{}, false
+	}
+	return FromConnectionState(&info.State)
+}
+
+type identityKey struct{}
+
+// WithIdentity кладёт личность клиента в контекст
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext возвращает личность клиента, положенную UnaryInterceptor или HTTP шлюзом
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// ContextWithState кладёт личность клиента из TLS соединения в контекст, используется HTTP шлюзом (r.TLS)
+func ContextWithState(ctx context.Context, st *tls.ConnectionState) context.Context {
+	if id, ok := FromConnectionState(st); ok {
+		return withLoggedIdentity(ctx, id)
+	}
+	return ctx
+}
+
+// withLoggedIdentity дополнительно добавляет имя клиента в логгер запроса
+func withLoggedIdentity(ctx context.Context, id Identity) context.Context {
+	ctx = WithIdentity(ctx, id)
+	return sl.WithLogger(ctx, sl.FromContext(ctx, nil).With(slog.String("client_cert", id.Name())))
+}
+
+// UnaryInterceptor переносит личность клиента из сертификата соединения в контекст запроса,
+// откуда её берут авторизация (auth.Authenticator) и аудит
+func UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if id, ok := FromPeer(ctx); ok {
+			ctx = withLoggedIdentity(ctx, id)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor - то же для стримов
+func StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if id, ok := FromPeer(ss.Context()); ok {
+			ss = server.WrapServerStream(ss, withLoggedIdentity(ss.Context(), id))
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,246 @@
+package mtls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCA(t *testing.T) testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue выпускает сертификат, подписанный CA, и возвращает PEM сертификата и ключа
+func (ca testCA) issue(t *testing.T, serial int64, cn string, uri string, server bool) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if server {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.DNSNames = []string{"localhost"}
+		tmpl.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	if uri != "" {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		tmpl.URIs = []*url.URL{u}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile пишет файл и сдвигает mtime вперёд, что бы изменение было видно даже на ФС с секундной точностью времени
+func writeFile(t *testing.T, path string, data []byte, mtime time.Time) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+}
+
+type testServer struct {
+	addr     string
+	identity chan Identity // личность клиента, которую увидел обработчик
+}
+
+func startServer(t *testing.T, r *Reloader) testServer {
+	t.Helper()
+
+	ts := testServer{identity: make(chan Identity, 10)}
+
+	capture := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		id, _ := IdentityFromContext(ctx)
+		ts.identity <- id
+		return handler(ctx, req)
+	}
+
+	srv := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(r.ServerConfig("h2"))),
+		grpc.ChainUnaryInterceptor(UnaryInterceptor(), capture),
+	)
+	healthpb.RegisterHealthServer(srv, grpchealth.NewServer())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+
+	ts.addr = l.Addr().String()
+	return ts
+}
+
+// call делает health check и возвращает CN сертификата, который показал сервер
+func call(t *testing.T, addr string, caPEM []byte, clientCert *tls.Certificate) (string, error) {
+	t.Helper()
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(caPEM))
+
+	cfg := &tls.Config{RootCAs: pool, ServerName: "localhost", MinVersion: tls.VersionTLS12}
+	if clientCert != nil {
+		cfg.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewTLS(cfg)))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var p peer.Peer
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&p))
+	if err != nil {
+		return "", err
+	}
+	return p.AuthInfo.(credentials.TLSInfo).State.PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestMutualTLS_IdentityAndReload(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+
+	ca := newCA(t)
+	now := time.Now()
+	certPEM, keyPEM := ca.issue(t, 10, "server-v1", "", true)
+	writeFile(t, certFile, certPEM, now)
+	writeFile(t, keyFile, keyPEM, now)
+	writeFile(t, caFile, ca.pem, now)
+
+	r, err := NewReloader(nil, certFile, keyFile, caFile, "", 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, ClientAuthRequire, r.ClientAuth, "с CA клиентов по умолчанию требуется сертификат")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	ts := startServer(t, r)
+
+	clientPEM, clientKey := ca.issue(t, 20, "billing", "spiffe://cluster.local/ns/billing/sa/billing", false)
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKey)
+	require.NoError(t, err)
+
+	cn, err := call(t, ts.addr, ca.pem, &clientCert)
+	require.NoError(t, err)
+	assert.Equal(t, "server-v1", cn)
+
+	id := <-ts.identity
+	assert.Equal(t, "spiffe://cluster.local/ns/billing/sa/billing", id.Name())
+	assert.Equal(t, "billing", id.CommonName)
+	assert.Equal(t, "20", id.Serial)
+
+	// без клиентского сертификата соединение не устанавливается
+	_, err = call(t, ts.addr, ca.pem, nil)
+	require.Error(t, err)
+
+	// сертификат от чужого CA тоже
+	other := newCA(t)
+	otherPEM, otherKey := other.issue(t, 30, "intruder", "", false)
+	otherCert, err := tls.X509KeyPair(otherPEM, otherKey)
+	require.NoError(t, err)
+	_, err = call(t, ts.addr, ca.pem, &otherCert)
+	require.Error(t, err)
+
+	// битый файл не заменяет рабочий сертификат
+	writeFile(t, certFile, []byte("garbage"), now.Add(time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	cn, err = call(t, ts.addr, ca.pem, &clientCert)
+	require.NoError(t, err)
+	assert.Equal(t, "server-v1", cn)
+
+	// новый сертификат подхватывается без перезапуска сервера
+	certPEM, keyPEM = ca.issue(t, 11, "server-v2", "", true)
+	writeFile(t, keyFile, keyPEM, now.Add(2*time.Minute))
+	writeFile(t, certFile, certPEM, now.Add(2*time.Minute))
+
+	require.Eventually(t, func() bool {
+		cn, err := call(t, ts.addr, ca.pem, &clientCert)
+		return err == nil && cn == "server-v2"
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestNewReloader_Errors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ca := newCA(t)
+	certPEM, keyPEM := ca.issue(t, 1, "server", "", true)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeFile(t, certFile, certPEM, time.Now())
+	writeFile(t, keyFile, keyPEM, time.Now())
+
+	_, err := NewReloader(nil, certFile, filepath.Join(dir, "missing.key"), "", "", 0)
+	assert.Error(t, err)
+
+	_, err = NewReloader(nil, certFile, keyFile, "", ClientAuthRequire, 0)
+	assert.Error(t, err, "mTLS без CA клиентов невозможно")
+
+	r, err := NewReloader(nil, certFile, keyFile, "", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, ClientAuthNone, r.ClientAuth)
+	assert.Equal(t, "server", r.Certificate().Subject.CommonName)
+}
@@ -0,0 +1,216 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/sl"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+// ClientAuth - что сервер требует от клиента
+type ClientAuth string
+
+const (
+	ClientAuthNone     ClientAuth = "none"     // обычный TLS, сертификат клиента не запрашивается
+	ClientAuthOptional ClientAuth = "optional" // сертификат проверяется, если клиент его прислал (можно прийти и с JWT)
+	ClientAuthRequire  ClientAuth = "require"  // mTLS: без валидного сертификата соединение не устанавливается
+)
+
+func ParseClientAuth(s string) (ClientAuth, error) {
+	switch ClientAuth(s) {
+	case ClientAuthNone, ClientAuthOptional, ClientAuthRequire:
+		return ClientAuth(s), nil
+	default:
+		return "", fmt.Errorf("unknown client auth %q, expected none | optional | require", s)
+	}
+}
+
+// Reloader держит текущие сертификат сервера и CA клиентов и перечитывает их, когда файлы меняются на диске
+// (cert-manager или vault agent обновляют секрет без рестарта пода). Уже установленные соединения продолжают
+// работать со старым сертификатом, новый используется со следующего TLS handshake
+type Reloader struct {
+	log *slog.Logger
+
+	CertFile   string
+	KeyFile    string
+	ClientCA   string // PEM бандл CA для проверки сертификатов клиентов, пустой - сертификаты клиентов не проверяются
+	ClientAuth ClientAuth
+	Interval   time.Duration // как часто проверяется mtime файлов
+
+	current atomic.Pointer[material]
+	mtimes  map[string]time.Time
+}
+
+// material - то, что загружено из файлов за один раз
+type material struct {
+	cert *tls.Certificate
+	cas  *x509.CertPool
+}
+
+// NewReloader загружает файлы сразу, ошибка - если сертификат или CA не читаются (сервис не должен стартовать без TLS, который от него ждут)
+func NewReloader(log *slog.Logger, certFile, keyFile, clientCA string, clientAuth ClientAuth, interval time.Duration) (*Reloader, error) {
+	const op = "mtls.NewReloader"
+
+	if log == nil {
+		log = slog.Default()
+	}
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+	if clientAuth == "" {
+		clientAuth = ClientAuthNone
+		if clientCA != "" {
+			clientAuth = ClientAuthRequire
+		}
+	}
+	if clientAuth != ClientAuthNone && clientCA == "" {
+		return nil, fmt.Errorf("%s: client auth %q requires a client CA bundle", op, clientAuth)
+	}
+
+	r := &Reloader{
+		log:        log,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ClientCA:   clientCA,
+		ClientAuth: clientAuth,
+		Interval:   interval,
+		mtimes:     map[string]time.Time{},
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return r, nil
+}
+
+// ServerConfig - конфиг для TLS сервера, сертификат и CA берутся при каждом handshake из последней успешной загрузки
+// nextProtos - ALPN протоколы сервера: "h2" для gRPC, "h2", "http/1.1" для HTTP шлюза
+func (r *Reloader) ServerConfig(nextProtos ...string) *tls.Config {
+	clientAuth := tls.NoClientCert
+	switch r.ClientAuth {
+	case ClientAuthOptional:
+		clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		ClientAuth: clientAuth,
+	}
+
+	cfg := base.Clone()
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		m := r.current.Load()
+
+		c := base.Clone()
+		c.Certificates = []tls.Certificate{*m.cert}
+		c.ClientCAs = m.cas
+		return c, nil
+	}
+	return cfg
+}
+
+// Certificate - текущий сертификат сервера
+func (r *Reloader) Certificate() *x509.Certificate {
+	return r.current.Load().cert.Leaf
+}
+
+// Run проверяет файлы раз в Interval, пока не отменён ctx
+// битый файл (например записанный наполовину) не заменяет рабочий сертификат: ошибка пишется в лог, попытка повторится на следующем тике
+func (r *Reloader) Run(ctx context.Context) {
+	const op = "mtls.Reloader.Run"
+
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.changed()
+			if err != nil {
+				r.log.Warn("failed to stat tls files", slog.String("op", op), sl.Err(err))
+				continue
+			}
+			if !changed {
+				continue
+			}
+
+			if err := r.reload(); err != nil {
+				r.log.Error("failed to reload tls certificate, keeping the previous one", slog.String("op", op), sl.Err(err))
+				continue
+			}
+			r.log.Info("tls certificate reloaded", slog.String("op", op),
+				slog.String("subject", r.Certificate().Subject.String()),
+				slog.Time("not_after", r.Certificate().NotAfter),
+			)
+		}
+	}
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.CertFile, r.KeyFile}
+	if r.ClientCA != "" {
+		files = append(files, r.ClientCA)
+	}
+	return files
+}
+
+// changed сравнивает mtime файлов с запомненными при последней загрузке
+func (r *Reloader) changed() (bool, error) {
+	for _, f := range r.files() {
+		st, err := os.Stat(f)
+		if err != nil {
+			return false, err
+		}
+		if !st.ModTime().Equal(r.mtimes[f]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *Reloader) reload() error {
+	// mtime запоминаем до чтения: если файл поменяется во время загрузки, следующий тик загрузит его ещё раз
+	mtimes := make(map[string]time.Time, 3)
+	for _, f := range r.files() {
+		st, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		mtimes[f] = st.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %w", err)
+	}
+
+	var cas *x509.CertPool
+	if r.ClientCA != "" {
+		pem, err := os.ReadFile(r.ClientCA)
+		if err != nil {
+			return fmt.Errorf("read client ca: %w", err)
+		}
+		cas = x509.NewCertPool()
+		if !cas.AppendCertsFromPEM(pem) {
+			return errors.New("client ca bundle has no certificates")
+		}
+	}
+
+	r.current.Store(&material{cert: &cert, cas: cas})
+	r.mtimes = mtimes
+	return nil
+}
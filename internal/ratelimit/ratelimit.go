@@ -0,0 +1,266 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/auth"
+	"github.com/Derbik-Git/user-service/internal/metrics"
+	"github.com/Derbik-Git/user-service/internal/mtls"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Limit - токен бакет: в среднем Rate запросов в секунду, до Burst запросов подряд
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Unlimited - лимит не задан, запросы не ограничиваются
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// Config - лимиты по методам, метод без своего лимита получает Default
+// ключ в Methods - полное имя gRPC метода (/user.v1.UserService/GetUser) или короткое (GetUser)
+type Config struct {
+	Default Limit
+	Methods map[string]Limit
+}
+
+func (c Config) For(fullMethod string) Limit {
+	if l, ok := c.Methods[fullMethod]; ok {
+		return l
+	}
+	if l, ok := c.Methods[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]; ok {
+		return l
+	}
+	return c.Default
+}
+
+// Enabled - задан хотя бы один лимит
+func (c Config) Enabled() bool {
+	if !c.Default.Unlimited() {
+		return true
+	}
+	for _, l := range c.Methods {
+		if !l.Unlimited() {
+			return true
+		}
+	}
+	return false
+}
+
+// Store - где живут бакеты: в памяти реплики (Local) или в redis, общий для всех реплик (Redis)
+type Store interface {
+	// Take забирает один токен из бакета key, ok = false - токенов нет, retryAfter - когда появится следующий
+	Take(ctx context.Context, key string, l Limit) (ok bool, retryAfter time.Duration, err error)
+}
+
+// Limiter ограничивает запросы каждого клиента к каждому методу
+type Limiter struct {
+	log *slog.Logger
+
+	Config Config
+
+	// Shared - общий для реплик Store (redis), nil - лимиты считаются в памяти каждой реплики
+	// если Shared недоступен, запрос проверяется по локальному бакету: redis не должен ни ронять сервис, ни снимать лимиты совсем
+	Shared Store
+
+	local *Local
+}
+
+func New(log *slog.Logger, cfg Config, shared Store) *Limiter {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &Limiter{
+		log:    log,
+		Config: cfg,
+		Shared: shared,
+		local:  NewLocal(),
+	}
+}
+
+// health проверки kubelet и балансировщика приходят с одних и тех же адресов и не трогают postgres, их не ограничиваем
+const healthService = "/grpc.health.v1.Health/"
+
+// Allow списывает токен клиента для fullMethod, ошибка - gRPC статус ResourceExhausted с RetryInfo,
+// по которому клиент (или HTTP шлюз в заголовке Retry-After) узнаёт, через сколько можно повторить
+// peerAddr нужен для клиентов без авторизации, ключом для них будет IP
+func (l *Limiter) Allow(ctx context.Context, fullMethod, peerAddr string) error {
+	const op = "ratelimit.Limiter.Allow"
+
+	if strings.HasPrefix(fullMethod, healthService) {
+		return nil
+	}
+
+	limit := l.Config.For(fullMethod)
+	if limit.Unlimited() {
+		return nil
+	}
+
+	client := ClientKey(ctx, peerAddr)
+	key := fullMethod + "|" + client
+
+	ok, retryAfter, err := l.take(ctx, key, limit)
+	if err != nil {
+		// сюда попадаем, только если сломался и локальный бакет, чего быть не должно: лучше пропустить запрос, чем отказать всем
+		sl.FromContext(ctx, l.log).Error("rate limiter failed, request is allowed", slog.String("op", op), sl.Err(err))
+		return nil
+	}
+	if ok {
+		return nil
+	}
+
+	metrics.RateLimited(fullMethod)
+	sl.FromContext(ctx, l.log).Warn("rate limit exceeded",
+		slog.String("op", op),
+		slog.String("client", client),
+		slog.Duration("retry_after", retryAfter),
+	)
+
+	return exhausted(retryAfter)
+}
+
+func (l *Limiter) take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	const op = "ratelimit.Limiter.take"
+
+	if l.Shared != nil {
+		ok, retryAfter, err := l.Shared.Take(ctx, key, limit)
+		if err == nil {
+			return ok, retryAfter, nil
+		}
+		sl.FromContext(ctx, l.log).Warn("shared rate limiter is unavailable, using local limits", slog.String("op", op), sl.Err(err))
+	}
+
+	return l.local.Take(ctx, key, limit)
+}
+
+func exhausted(retryAfter time.Duration) error {
+	st := status.New(codes.ResourceExhausted, "rate limit exceeded")
+	if withInfo, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
+// RetryAfter достаёт задержку из RetryInfo ошибки, которую вернул Allow, ok = false - деталей нет
+func RetryAfter(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return 0, false
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+// ClientKey - по кому считается лимит: subject токена, имя из клиентского сертификата или IP адрес,
+// поэтому клиенты за одним NAT с разными токенами не делят лимит, а без токена - делят
+func ClientKey(ctx context.Context, peerAddr string) string {
+	if p, ok := auth.PrincipalFromContext(ctx); ok && p.Subject != "" {
+		return "sub:" + p.Subject
+	}
+	if id, ok := mtls.IdentityFromContext(ctx); ok {
+		return "cert:" + id.Name()
+	}
+
+	host, _, err := net.SplitHostPort(peerAddr)
+	if err != nil {
+		host = peerAddr
+	}
+	return "ip:" + host
+}
+
+// UnaryInterceptor ставится после авторизации, что бы лимит считался по клиенту из токена, а не по адресу
+func (l *Limiter) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var addr string
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			addr = p.Addr.String()
+		}
+
+		if err := l.Allow(ctx, info.FullMethod, addr); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor списывает токен при открытии стрима, сообщения внутри стрима не ограничиваются
+func (l *Limiter) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		var addr string
+		if p, ok := peer.FromContext(ss.Context()); ok && p.Addr != nil {
+			addr = p.Addr.String()
+		}
+
+		if err := l.Allow(ss.Context(), info.FullMethod, addr); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// ParseLimit разбирает лимит вида "rate[:burst]", например "50" или "50:100", burst по умолчанию равен rate
+// "0" - без ограничений
+func ParseLimit(s string) (Limit, error) {
+	rateStr, burstStr, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || rate < 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		return Limit{}, fmt.Errorf("invalid rate %q, expected rate[:burst]", s)
+	}
+	if rate == 0 {
+		return Limit{}, nil
+	}
+
+	burst := int(math.Ceil(rate))
+	if hasBurst {
+		burst, err = strconv.Atoi(burstStr)
+		if err != nil || burst < 1 {
+			return Limit{}, fmt.Errorf("invalid burst %q, expected rate[:burst] with burst >= 1", s)
+		}
+	}
+
+	return Limit{Rate: rate, Burst: burst}, nil
+}
+
+// ParseMethodLimits разбирает флаг вида "GetUser=50:100;CreateUser=5"
+func ParseMethodLimits(s string) (map[string]Limit, error) {
+	res := map[string]Limit{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		method, limit, ok := strings.Cut(entry, "=")
+		if !ok || method == "" {
+			return nil, fmt.Errorf("invalid method limit %q, expected method=rate[:burst]", entry)
+		}
+		l, err := ParseLimit(limit)
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %w", method, err)
+		}
+		res[strings.TrimSpace(method)] = l
+	}
+	return res, nil
+}
@@ -0,0 +1,190 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	userv1 "github.com/Derbik-Git/protos-tren-redis/user/v1"
+	"github.com/Derbik-Git/user-service/internal/auth"
+	"github.com/Derbik-Git/user-service/internal/mtls"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClock - время, которое двигает тест
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newLocalAt(c *fakeClock) *Local {
+	s := NewLocal()
+	s.now = c.now
+	return s
+}
+
+func take(s Store, key string, l Limit) (bool, time.Duration) {
+	ok, retry, _ := s.Take(context.Background(), key, l)
+	return ok, retry
+}
+
+func TestLocal_TokenBucket(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	s := newLocalAt(clock)
+	l := Limit{Rate: 2, Burst: 3}
+
+	for i := range 3 {
+		ok, _ := take(s, "a", l)
+		require.True(t, ok, "запрос %d в пределах burst", i)
+	}
+
+	ok, retry := take(s, "a", l)
+	require.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retry, "при 2 rps токен появляется через 0.5s")
+
+	ok, _ = take(s, "b", l)
+	assert.True(t, ok, "у другого ключа свой бакет")
+
+	clock.advance(500 * time.Millisecond)
+	ok, _ = take(s, "a", l)
+	assert.True(t, ok)
+	ok, _ = take(s, "a", l)
+	assert.False(t, ok)
+
+	// за долгую паузу бакет наполняется не больше чем до burst
+	clock.advance(time.Hour)
+	for range 3 {
+		ok, _ = take(s, "a", l)
+		require.True(t, ok)
+	}
+	ok, _ = take(s, "a", l)
+	assert.False(t, ok)
+}
+
+func TestLocal_SweepsFullBuckets(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	s := newLocalAt(clock)
+	l := Limit{Rate: 1, Burst: 10}
+
+	take(s, "a", l)
+	clock.advance(2 * time.Second)
+	take(s, "b", l)
+	require.Equal(t, 2, s.Len())
+
+	// через минуту "a" давно наполнился, "b" тоже, новый запрос "c" запускает чистку
+	clock.advance(sweepInterval)
+	take(s, "c", l)
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestParseLimits(t *testing.T) {
+	t.Parallel()
+
+	l, err := ParseLimit("50:100")
+	require.NoError(t, err)
+	assert.Equal(t, Limit{Rate: 50, Burst: 100}, l)
+
+	l, err = ParseLimit("0.5")
+	require.NoError(t, err)
+	assert.Equal(t, Limit{Rate: 0.5, Burst: 1}, l)
+
+	l, err = ParseLimit("0")
+	require.NoError(t, err)
+	assert.True(t, l.Unlimited())
+
+	for _, bad := range []string{"", "abc", "-1", "10:0", "10:x"} {
+		_, err := ParseLimit(bad)
+		assert.Error(t, err, bad)
+	}
+
+	methods, err := ParseMethodLimits("GetUser=50:100; /user.v1.UserService/CreateUser=5")
+	require.NoError(t, err)
+	cfg := Config{Default: Limit{Rate: 1, Burst: 1}, Methods: methods}
+	assert.Equal(t, Limit{Rate: 50, Burst: 100}, cfg.For(userv1.UserService_GetUser_FullMethodName))
+	assert.Equal(t, Limit{Rate: 5, Burst: 5}, cfg.For(userv1.UserService_CreateUser_FullMethodName))
+	assert.Equal(t, Limit{Rate: 1, Burst: 1}, cfg.For(userv1.UserService_DeleteUser_FullMethodName))
+
+	_, err = ParseMethodLimits("GetUser")
+	assert.Error(t, err)
+
+	assert.False(t, Config{}.Enabled())
+	assert.True(t, Config{Methods: map[string]Limit{"GetUser": {Rate: 1, Burst: 1}}}.Enabled())
+}
+
+func TestClientKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	assert.Equal(t, "ip:10.0.0.1", ClientKey(ctx, "10.0.0.1:5000"))
+	assert.Equal(t, "ip:[::1]", ClientKey(ctx, "[::1]"), "адрес без порта используется как есть")
+
+	certCtx := mtls.WithIdentity(ctx, mtls.Identity{CommonName: "billing"})
+	assert.Equal(t, "cert:billing", ClientKey(certCtx, "10.0.0.1:5000"))
+
+	// токен важнее сертификата, как в auth.Authenticator
+	subCtx := auth.WithPrincipal(certCtx, auth.Principal{Subject: "42"})
+	assert.Equal(t, "sub:42", ClientKey(subCtx, "10.0.0.1:5000"))
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	t.Parallel()
+
+	limiter := New(nil, Config{Default: Limit{Rate: 1, Burst: 1}}, nil)
+	interceptor := limiter.UnaryInterceptor()
+
+	calls := 0
+	handler := func(ctx context.Context, req any) (any, error) {
+		calls++
+		return "ok", nil
+	}
+	call := func(ctx context.Context, method string) error {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}})
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "42"})
+	require.NoError(t, call(ctx, userv1.UserService_GetUser_FullMethodName))
+
+	err := call(ctx, userv1.UserService_GetUser_FullMethodName)
+	require.Error(t, err)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	retry, ok := RetryAfter(err)
+	require.True(t, ok, "клиенту нужен RetryInfo")
+	assert.InDelta(t, time.Second, retry, float64(10*time.Millisecond))
+
+	require.NoError(t, call(ctx, userv1.UserService_CreateUser_FullMethodName), "лимит у каждого метода свой")
+	require.NoError(t, call(context.Background(), userv1.UserService_GetUser_FullMethodName), "клиент без токена считается по IP")
+
+	for range 5 {
+		require.NoError(t, call(ctx, "/grpc.health.v1.Health/Check"), "health проверки не ограничиваются")
+	}
+	assert.Equal(t, 8, calls)
+}
+
+func TestLimiter_FallsBackToLocalWhenRedisIsDown(t *testing.T) {
+	t.Parallel()
+
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 100 * time.Millisecond, MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	limiter := New(nil, Config{Default: Limit{Rate: 0.1, Burst: 2}}, NewRedis(client))
+	ctx := context.Background()
+
+	require.NoError(t, limiter.Allow(ctx, userv1.UserService_GetUser_FullMethodName, "10.0.0.1:5000"))
+	require.NoError(t, limiter.Allow(ctx, userv1.UserService_GetUser_FullMethodName, "10.0.0.1:5000"))
+
+	err := limiter.Allow(ctx, userv1.UserService_GetUser_FullMethodName, "10.0.0.1:5000")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "без redis лимиты продолжают действовать в памяти реплики")
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// redis из internal/docker_redis_test/docker-compose.test.yaml
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	t.Cleanup(func() { _ = client.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis is not available: %v", err)
+	}
+	return client
+}
+
+func TestRedis_SharedBucket(t *testing.T) {
+	t.Parallel()
+
+	client := newTestRedis(t)
+	ctx := context.Background()
+	key := fmt.Sprintf("test|%d", time.Now().UnixNano())
+	l := Limit{Rate: 1, Burst: 3}
+
+	// два экземпляра Redis - как две реплики сервиса, бакет у них общий
+	replicas := []*Redis{NewRedis(client), NewRedis(client)}
+	for i := range 3 {
+		ok, _, err := replicas[i%2].Take(ctx, key, l)
+		require.NoError(t, err)
+		require.True(t, ok, "запрос %d в пределах burst", i)
+	}
+
+	ok, retry, err := replicas[1].Take(ctx, key, l)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Greater(t, retry, time.Duration(0))
+	assert.LessOrEqual(t, retry, time.Second)
+
+	ttl, err := client.PTTL(ctx, "ratelimit:"+key).Result()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, ttl, 3*time.Second, "ключ живёт не дольше, чем бакет наполняется")
+
+	time.Sleep(retry)
+	ok, _, err = replicas[0].Take(ctx, key, l)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
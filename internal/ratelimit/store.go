@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// как часто Local выбрасывает бакеты клиентов, которые давно не приходили
+const sweepInterval = time.Minute
+
+// Local - бакеты в памяти реплики, при N репликах клиент фактически получает до N лимитов
+type Local struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	now func() time.Time // подменяется в тестах
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // когда бакет снова наполнится, после этого его можно удалить: новый бакет будет таким же
+}
+
+func NewLocal() *Local {
+	return &Local{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+func (s *Local) Take(_ context.Context, key string, l Limit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	burst := float64(l.Burst)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	var retryAfter time.Duration
+	if allowed {
+		b.tokens--
+	} else {
+		retryAfter = seconds((1 - b.tokens) / l.Rate)
+	}
+	b.full = now.Add(seconds((burst - b.tokens) / l.Rate))
+
+	return allowed, retryAfter, nil
+}
+
+// sweep удаляет наполнившиеся бакеты, иначе карта растёт с каждым новым IP
+func (s *Local) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// Len - сколько бакетов сейчас в памяти
+func (s *Local) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.buckets)
+}
+
+func seconds(f float64) time.Duration {
+	return time.Duration(math.Ceil(f * float64(time.Second)))
+}
+
+// gcraScript - тот же токен бакет в виде GCRA: в redis хранится одно число на ключ - теоретическое время прихода
+// следующего запроса (TAT) в микросекундах. Время берётся из redis, а не из реплик, поэтому расхождение часов между подами не важно
+// ARGV[1] - интервал между запросами в микросекундах (1/rate), ARGV[2] - burst
+// ответ: 0 - запрос разрешён, иначе через сколько микросекунд можно повторить
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+
+local newTat = tat + interval
+local wait = newTat - now - burst * interval
+if wait > 0 then
+	return math.ceil(wait)
+end
+
+redis.call('SET', KEYS[1], string.format('%.0f', newTat), 'PX', math.ceil((newTat - now) / 1000))
+return 0
+`)
+
+// Redis - бакеты в redis, общие для всех реплик сервиса
+type Redis struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedis использует тот же клиент, что и кеш (cache.RedisCache.Client), одиночный redis или кластер
+// каждый ключ обрабатывается одним скриптом на одном узле, поэтому hash tag не нужен
+func NewRedis(client redis.Scripter) *Redis {
+	return &Redis{client: client, prefix: "ratelimit:"}
+}
+
+func (s *Redis) Take(ctx context.Context, key string, l Limit) (bool, time.Duration, error) {
+	const op = "ratelimit.Redis.Take"
+
+	interval := 1e6 / l.Rate
+
+	wait, err := gcraScript.Run(ctx, s.client, []string{s.prefix + key}, interval, l.Burst).Int64()
+	if err != nil {
+		return false, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if wait > 0 {
+		return false, time.Duration(wait) * time.Microsecond, nil
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,224 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/sl"
+)
+
+const defaultBatchSize = 500
+
+// UserLister - keyset чтение пользователей, реализуется postgres.Storage
+type UserLister interface {
+	ListUsersAfterID(ctx context.Context, afterID int64, limit int) ([]domain.User, error)
+}
+
+// EventProducer - то же, что и service.EventProducer, в проде это kafka.Producer
+type EventProducer interface {
+	PublishUserEvent(ctx context.Context, topic string, eventType string, user *domain.User) error
+}
+
+// Replayer проходит по таблице users по возрастанию id и публикует на каждого пользователя событие user.snapshot
+// Нужен, когда консьюмер потерял своё состояние (например кеш или read-модель в другом сервисе) и его надо восстановить с нуля
+//
+// Прогресс сохраняется в файл Checkpoint после каждой страницы, поэтому прерванный прогон продолжается с последнего опубликованного id,
+// а не с начала таблицы. Снимки идемпотентны, поэтому повторная публикация части пользователей после падения ничего не ломает
+type Replayer struct {
+	Users    UserLister
+	Producer EventProducer // может быть nil в DryRun режиме
+	Log      *slog.Logger
+
+	Topic      string  // пустое значение = domain.TopicUserEvents
+	BatchSize  int     // размер страницы чтения из postgres, 0 = defaultBatchSize
+	Rate       float64 // максимум событий в секунду, 0 = без ограничения
+	Checkpoint string  // путь к файлу с последним опубликованным id, пустой = без чекпоинтов
+	DryRun     bool    // только читаем и считаем пользователей, ничего не публикуем и не пишем чекпоинт
+}
+
+// Result - итог прогона
+type Result struct {
+	Published int   // сколько снимков опубликовано (в DryRun - сколько было бы опубликовано)
+	LastID    int64 // id последнего обработанного пользователя, с него продолжится следующий прогон
+}
+
+// Run публикует снимки всех пользователей с id > fromID, если fromID < 0, стартовый id берётся из чекпоинта (или с начала таблицы)
+func (r *Replayer) Run(ctx context.Context, fromID int64) (Result, error) {
+	const op = "replay.Run"
+
+	log := r.Log
+	if log == nil {
+		log = slog.Default()
+	}
+	log = log.With(slog.String("op", op), slog.Bool("dry_run", r.DryRun))
+
+	if r.Producer == nil && !r.DryRun {
+		return Result{}, fmt.Errorf("%s: producer is required", op)
+	}
+
+	topic := r.Topic
+	if topic == "" {
+		topic = domain.TopicUserEvents
+	}
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	if fromID < 0 {
+		id, err := ReadCheckpoint(r.Checkpoint)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: %w", op, err)
+		}
+		fromID = id
+	}
+
+	res := Result{LastID: fromID}
+	log.Info("replay started", slog.Int64("from_id", fromID), slog.String("topic", topic))
+
+	limiter := newLimiter(r.Rate)
+
+	for {
+		users, err := r.Users.ListUsersAfterID(ctx, res.LastID, batchSize)
+		if err != nil {
+			return res, fmt.Errorf("%s: %w", op, err)
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		for i := range users {
+			u := &users[i]
+
+			if !r.DryRun {
+				if err := limiter.wait(ctx); err != nil {
+					return res, fmt.Errorf("%s: %w", op, err)
+				}
+
+				if err := r.Producer.PublishUserEvent(ctx, topic, domain.UserSnapshot, u); err != nil {
+					log.Error("failed to publish snapshot", slog.Int64("user_id", u.ID), sl.Err(err))
+					r.saveCheckpoint(log, res.LastID) // всё до этого пользователя уже опубликовано
+					return res, fmt.Errorf("%s: publish user %d: %w", op, u.ID, err)
+				}
+			}
+
+			res.Published++
+			res.LastID = u.ID
+		}
+
+		r.saveCheckpoint(log, res.LastID)
+		log.Info("replay progress", slog.Int("published", res.Published), slog.Int64("last_id", res.LastID))
+
+		if len(users) < batchSize {
+			break
+		}
+	}
+
+	log.Info("replay finished", slog.Int("published", res.Published), slog.Int64("last_id", res.LastID))
+
+	return res, nil
+}
+
+func (r *Replayer) saveCheckpoint(log *slog.Logger, id int64) {
+	if r.DryRun || r.Checkpoint == "" {
+		return
+	}
+
+	// ошибка записи чекпоинта не останавливает прогон: в худшем случае следующий запуск переопубликует часть пользователей
+	if err := WriteCheckpoint(r.Checkpoint, id); err != nil {
+		log.Warn("failed to save checkpoint", slog.Int64("last_id", id), sl.Err(err))
+	}
+}
+
+// ReadCheckpoint читает последний опубликованный id, отсутствующий файл (или пустой путь) означает старт с начала таблицы
+func ReadCheckpoint(path string) (int64, error) {
+	if path == "" {
+		return 0, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read checkpoint: %w", err)
+	}
+
+	id, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse checkpoint %s: %w", path, err)
+	}
+	return id, nil
+}
+
+// WriteCheckpoint пишет id во временный файл и переименовывает его, что бы при падении посреди записи не остался обрезанный чекпоинт
+func WriteCheckpoint(path string, id int64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // после успешного rename файла уже нет, ошибка игнорируется
+
+	if _, err := tmp.WriteString(strconv.FormatInt(id, 10) + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// limiter - простой ограничитель частоты: события идут не чаще одного за interval, первое - сразу
+// replayer однопоточный, поэтому token bucket с burst-ом тут не нужен
+type limiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(perSecond float64) *limiter {
+	if perSecond <= 0 {
+		return &limiter{}
+	}
+	return &limiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if l.interval == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	if d := l.next.Sub(now); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	l.next = l.next.Add(l.interval)
+	return nil
+}
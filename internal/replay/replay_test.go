@@ -0,0 +1,129 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/service/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUsers - таблица users в памяти с той же keyset семантикой, что и postgres.Storage.ListUsersAfterID
+type fakeUsers struct {
+	users []domain.User // отсортированы по id
+	calls int
+}
+
+func (f *fakeUsers) ListUsersAfterID(ctx context.Context, afterID int64, limit int) ([]domain.User, error) {
+	f.calls++
+	var out []domain.User
+	for _, u := range f.users {
+		if u.ID > afterID && len(out) < limit {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+func newFakeUsers(ids ...int64) *fakeUsers {
+	f := &fakeUsers{}
+	for _, id := range ids {
+		f.users = append(f.users, domain.User{ID: id, Email: "u@email.com", Name: "User"})
+	}
+	return f
+}
+
+func TestReplayer_PublishesSnapshotPerUserAndCheckpoints(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "replay.checkpoint")
+
+	var published []int64
+	producer := &mocks.EventProducerMock{
+		PublishUserEventFunc: func(ctx context.Context, topic string, eventType string, user *domain.User) error {
+			assert.Equal(t, domain.TopicUserEvents, topic)
+			assert.Equal(t, domain.UserSnapshot, eventType)
+			published = append(published, user.ID)
+			return nil
+		},
+	}
+
+	r := &Replayer{Users: newFakeUsers(1, 2, 5, 7, 9), Producer: producer, BatchSize: 2, Checkpoint: checkpoint}
+
+	res, err := r.Run(context.Background(), -1)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int64{1, 2, 5, 7, 9}, published)
+	assert.Equal(t, Result{Published: 5, LastID: 9}, res)
+
+	id, err := ReadCheckpoint(checkpoint)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), id)
+}
+
+// после ошибки публикации чекпоинт указывает на последнего опубликованного пользователя, и следующий прогон продолжает с него
+func TestReplayer_ResumesFromCheckpointAfterFailure(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "replay.checkpoint")
+	users := newFakeUsers(1, 2, 3, 4)
+
+	var published []int64
+	failOn := int64(3)
+	producer := &mocks.EventProducerMock{
+		PublishUserEventFunc: func(ctx context.Context, topic string, eventType string, user *domain.User) error {
+			if user.ID == failOn {
+				return errors.New("kafka unavailable")
+			}
+			published = append(published, user.ID)
+			return nil
+		},
+	}
+
+	r := &Replayer{Users: users, Producer: producer, BatchSize: 10, Checkpoint: checkpoint}
+
+	res, err := r.Run(context.Background(), -1)
+	require.Error(t, err)
+	assert.Equal(t, int64(2), res.LastID)
+
+	id, err := ReadCheckpoint(checkpoint)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), id)
+
+	failOn = 0
+	res, err = r.Run(context.Background(), -1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Published)
+	assert.Equal(t, []int64{1, 2, 3, 4}, published)
+}
+
+func TestReplayer_DryRunPublishesNothing(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "replay.checkpoint")
+
+	r := &Replayer{Users: newFakeUsers(1, 2, 3), DryRun: true, Checkpoint: checkpoint}
+
+	res, err := r.Run(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Published: 2, LastID: 3}, res)
+
+	id, err := ReadCheckpoint(checkpoint)
+	require.NoError(t, err)
+	assert.Zero(t, id, "dry-run не должен писать чекпоинт")
+}
+
+func TestReplayer_RateLimitStopsOnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	producer := &mocks.EventProducerMock{
+		PublishUserEventFunc: func(ctx context.Context, topic string, eventType string, user *domain.User) error {
+			cancel() // после первого события отменяем прогон, следующее ждёт тика лимитера и должно выйти по ctx
+			return nil
+		},
+	}
+
+	r := &Replayer{Users: newFakeUsers(1, 2, 3), Producer: producer, Rate: 0.1}
+
+	res, err := r.Run(ctx, 0)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, res.Published)
+}
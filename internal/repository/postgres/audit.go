@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Derbik-Git/user-service/internal/audit"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/sl"
+)
+
+// withTx выполняет fn в транзакции: изменение пользователя и запись в журнал (user_audit) сохраняются вместе или не сохраняются вовсе
+func (s *Storage) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertAudit пишет изменение пользователя в журнал, кто и в каком запросе его сделал, берётся из контекста
+func insertAudit(ctx context.Context, tx *sql.Tx, operation string, userID int64, before, after *domain.User) error {
+	const op = "storage.postgres.insertAudit"
+
+	query := `
+	INSERT INTO user_audit (user_id, operation, actor, request_id, before, after)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	qctx, q := startQuery(ctx, op)
+	_, err := tx.ExecContext(qctx, query, userID, operation, audit.Actor(ctx), sl.RequestID(ctx), jsonParam(audit.Snapshot(before)), jsonParam(audit.Snapshot(after)))
+	q.end(err)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// jsonParam - JSON для колонки JSONB: lib/pq передаёт []byte как bytea, поэтому JSON уходит строкой, а пустой - NULL
+func jsonParam(b json.RawMessage) any {
+	if b == nil {
+		return nil
+	}
+	return string(b)
+}
+
+// UserAuditTrail возвращает до limit записей журнала пользователя с id < beforeID от новых к старым, beforeID = 0 - с самой новой
+// keyset пагинация, как в ListUsersAfterID: страница - короткий проход по индексу (user_id, id)
+func (s *Storage) UserAuditTrail(ctx context.Context, userID, beforeID int64, limit int) ([]audit.Entry, error) {
+	const op = "storage.postgres.UserAuditTrail"
+
+	query := `
+	SELECT id, user_id, operation, actor, request_id, before, after, created_at
+	FROM user_audit
+	WHERE user_id = $1 AND ($2::BIGINT = 0 OR id < $2)
+	ORDER BY id DESC
+	LIMIT $3
+	`
+
+	qctx, q := startQuery(ctx, op)
+	rows, err := s.db.QueryContext(qctx, query, userID, beforeID, limit)
+	if err != nil {
+		q.end(err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	entries := make([]audit.Entry, 0, limit)
+	for rows.Next() {
+		var (
+			e             audit.Entry
+			before, after []byte
+		)
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Operation, &e.Actor, &e.RequestID, &before, &after, &e.CreatedAt); err != nil {
+			q.end(err)
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if before != nil {
+			e.Before = json.RawMessage(before)
+		}
+		if after != nil {
+			e.After = json.RawMessage(after)
+		}
+		entries = append(entries, e)
+	}
+
+	err = rows.Err()
+	q.end(err) // как и в ListUsersAfterID, спан закрывается после чтения строк
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, nil
+}
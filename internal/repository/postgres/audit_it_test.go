@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/audit"
+	"github.com/Derbik-Git/user-service/internal/auth"
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgres_UserAudit_Integration(t *testing.T) {
+	t.Parallel()
+
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Fatal("POSTGRES_DSN is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	store, err := NewStorage(dsn)
+	require.NoError(t, err)
+	defer store.Close()
+
+	// другие тесты чистят users с RESTART IDENTITY, поэтому id пользователя может повториться, свои записи журнала ищем по request_id
+	requestID := fmt.Sprintf("it-audit-%d", time.Now().UnixNano())
+	ctx = sl.WithRequestID(auth.WithPrincipal(ctx, auth.Principal{Subject: "auditor-test"}), requestID)
+
+	user, err := store.Create(ctx, fmt.Sprintf("%s@example.com", requestID), "before")
+	require.NoError(t, err)
+
+	_, err = store.Update(ctx, &domain.User{ID: user.ID, Email: user.Email, Name: "after"})
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(ctx, user.ID))
+
+	ownEntries := func() []audit.Entry {
+		trail, err := store.UserAuditTrail(ctx, user.ID, 0, 100)
+		require.NoError(t, err)
+
+		var own []audit.Entry
+		for _, e := range trail {
+			if e.RequestID == requestID {
+				own = append(own, e)
+			}
+		}
+		return own
+	}
+
+	own := ownEntries()
+	require.Len(t, own, 3)
+
+	del, upd, crt := own[0], own[1], own[2] // от новых к старым
+	require.Equal(t, audit.OpDelete, del.Operation)
+	require.Equal(t, audit.OpUpdate, upd.Operation)
+	require.Equal(t, audit.OpCreate, crt.Operation)
+	require.Equal(t, "sub:auditor-test", crt.Actor)
+
+	require.Nil(t, crt.Before)
+	require.Nil(t, del.After)
+
+	name := func(raw json.RawMessage) string {
+		var u struct {
+			Name string `json:"name"`
+		}
+		require.NoError(t, json.Unmarshal(raw, &u))
+		return u.Name
+	}
+	require.Equal(t, "before", name(crt.After))
+	require.Equal(t, "before", name(upd.Before))
+	require.Equal(t, "after", name(upd.After))
+	require.Equal(t, "after", name(del.Before))
+
+	// пагинация: страница после записи удаления начинается с изменения
+	page, err := store.UserAuditTrail(ctx, user.ID, del.ID, 1)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	require.Less(t, page[0].ID, del.ID)
+
+	// журнал только дописывается
+	_, err = store.db.ExecContext(ctx, "UPDATE user_audit SET actor = 'someone else' WHERE id = $1", crt.ID)
+	require.Error(t, err)
+	_, err = store.db.ExecContext(ctx, "DELETE FROM user_audit WHERE id = $1", crt.ID)
+	require.Error(t, err)
+
+	// изменение, которое не удалось, не оставляет записи
+	require.Error(t, store.Delete(ctx, user.ID))
+	require.Len(t, ownEntries(), 3)
+}
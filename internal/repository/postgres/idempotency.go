@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/idempotency"
+)
+
+// как часто IdempotencyStore удаляет истёкшие ключи
+const idempotencyPurgeInterval = time.Minute
+
+// IdempotencyStore - ключи идемпотентности в таблице idempotency_keys, запасное хранилище на случай недоступного redis
+// redis удаляет ключи сам по TTL, здесь истёкшие ключи удаляются попутно, не чаще раза в idempotencyPurgeInterval
+type IdempotencyStore struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+func NewIdempotencyStore(s *Storage) *IdempotencyStore {
+	return &IdempotencyStore{db: s.db}
+}
+
+func (s *IdempotencyStore) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*idempotency.Record, error) {
+	const op = "storage.postgres.IdempotencyStore.Reserve"
+
+	s.purgeExpired(ctx)
+
+	// истёкший ключ занимается заново так же, как свободный
+	query := `
+	INSERT INTO idempotency_keys (key, fingerprint, expires_at) VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+	ON CONFLICT (key) DO UPDATE
+	SET fingerprint = EXCLUDED.fingerprint, response = NULL, created_at = now(), expires_at = EXCLUDED.expires_at
+	WHERE idempotency_keys.expires_at <= now()
+	RETURNING key
+	`
+
+	var reserved string
+	qctx, q := startQuery(ctx, op)
+	err := s.db.QueryRowContext(qctx, query, key, fingerprint, ttl.Milliseconds()).Scan(&reserved)
+	q.end(err)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// ключ занят и не истёк
+	var rec idempotency.Record
+	qctx, q = startQuery(ctx, op)
+	err = s.db.QueryRowContext(qctx, `SELECT fingerprint, response FROM idempotency_keys WHERE key = $1`, key).Scan(&rec.Fingerprint, &rec.Response)
+	q.end(err)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &rec, nil
+}
+
+func (s *IdempotencyStore) Complete(ctx context.Context, key string, rec idempotency.Record, ttl time.Duration) error {
+	const op = "storage.postgres.IdempotencyStore.Complete"
+
+	// upsert, а не UPDATE: ключ мог быть занят в redis, который отказал между Reserve и Complete
+	query := `
+	INSERT INTO idempotency_keys (key, fingerprint, response, expires_at) VALUES ($1, $2, $3, now() + $4 * interval '1 millisecond')
+	ON CONFLICT (key) DO UPDATE
+	SET fingerprint = EXCLUDED.fingerprint, response = EXCLUDED.response, expires_at = EXCLUDED.expires_at
+	`
+
+	qctx, q := startQuery(ctx, op)
+	_, err := s.db.ExecContext(qctx, query, key, rec.Fingerprint, rec.Response, ttl.Milliseconds())
+	q.end(err)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Release удаляет только незавершённый резерв, сохранённый ответ остаётся
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	const op = "storage.postgres.IdempotencyStore.Release"
+
+	qctx, q := startQuery(ctx, op)
+	_, err := s.db.ExecContext(qctx, `DELETE FROM idempotency_keys WHERE key = $1 AND response IS NULL`, key)
+	q.end(err)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// purgeExpired удаляет истёкшие ключи, ошибка только пишется в лог: на резерв ключа она не влияет
+func (s *IdempotencyStore) purgeExpired(ctx context.Context) {
+	const op = "storage.postgres.IdempotencyStore.purgeExpired"
+
+	s.mu.Lock()
+	if time.Since(s.lastPurge) < idempotencyPurgeInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPurge = time.Now()
+	s.mu.Unlock()
+
+	qctx, q := startQuery(ctx, op)
+	_, err := s.db.ExecContext(qctx, `DELETE FROM idempotency_keys WHERE expires_at <= now()`)
+	q.end(err)
+}
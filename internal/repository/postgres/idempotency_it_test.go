@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/idempotency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgres_IdempotencyStore_Integration(t *testing.T) {
+	t.Parallel()
+
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Fatal("POSTGRES_DSN is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	storage, err := NewStorage(dsn)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	s := NewIdempotencyStore(storage)
+	key := fmt.Sprintf("it-%d", time.Now().UnixNano())
+
+	existing, err := s.Reserve(ctx, key, "fp", time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, existing) // ключ свободен и теперь занят нами
+
+	existing, err = s.Reserve(ctx, key, "fp", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	require.Nil(t, existing.Response) // первый запрос ещё выполняется
+
+	require.NoError(t, s.Complete(ctx, key, idempotency.Record{Fingerprint: "fp", Response: []byte("resp")}, time.Hour))
+
+	existing, err = s.Reserve(ctx, key, "other", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	require.Equal(t, "fp", existing.Fingerprint)
+	require.Equal(t, []byte("resp"), existing.Response)
+
+	require.NoError(t, s.Release(ctx, key)) // сохранённый ответ Release не удаляет
+	existing, err = s.Reserve(ctx, key, "fp", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+
+	// истёкший ключ занимается заново
+	expired := key + "-expired"
+	_, err = s.Reserve(ctx, expired, "fp", time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	existing, err = s.Reserve(ctx, expired, "fp", time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, existing)
+}
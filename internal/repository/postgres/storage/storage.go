@@ -1,8 +1,13 @@
 package storage
 
-import "errors"
+import (
+	"fmt"
 
+	errorsx "github.com/Derbik-Git/user-service/internal/errors"
+)
+
+// ошибки оборачивают общие ошибки сервиса, поэтому errorsx.ToGRPC/ToHTTP отдают по ним NotFound/404 и AlreadyExists/409, а не Internal
 var (
-	ErrNotFound   = errors.New("user not found")
-	ErrUserExists = errors.New("user already exists")
+	ErrNotFound   = fmt.Errorf("user %w", errorsx.ErrNotFound)
+	ErrUserExists = fmt.Errorf("user %w", errorsx.ErrAlreadyExists)
 )
@@ -5,13 +5,21 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
+	"github.com/Derbik-Git/user-service/internal/audit"
 	"github.com/Derbik-Git/user-service/internal/domain"
 	"github.com/Derbik-Git/user-service/internal/repository/postgres/storage"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"github.com/Derbik-Git/user-service/internal/tracing"
 	"github.com/jackc/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = tracing.Tracer("github.com/Derbik-Git/user-service/internal/repository/postgres")
+
 type Storage struct {
 	db *sql.DB
 }
@@ -44,7 +52,7 @@ func (s *Storage) Create(ctx context.Context, email, name string) (*domain.User,
 
 	query := `
 	INSERT INTO users (email, name) VALUES ($1, $2) 
-	RETURNING id, created_at 
+	RETURNING id, created_at, updated_at
 	`
 	// (Строка результата) "RETURNING" - возвращает значения, с которыми в будущем можно работать в коде (что мы и делаем в QueryRowContext)
 
@@ -52,14 +60,22 @@ func (s *Storage) Create(ctx context.Context, email, name string) (*domain.User,
 	u.Email = email
 	u.Name = name
 
-	err := s.db.QueryRowContext(ctx, query, email, name).Scan(&u.ID, &u.CreatedAt) // при помощи помощи Scan достаём переменные из строки результата SQL запроса и записываем в указанные пееменные.
-	if err != nil {
-		//В INSERT / UPDATE мы проверяем PgError, потому что это ошибки бизнес-ограничений БД(например нарушение NOT NULL или нарушение уникальности). Обычно проверка типа: if errors.Is(err, sql.ErrNoRows) тут нету замысловатой логики в самом запросе и ошибка будет наипростейшая, пользователя просто нет, поэтому и такая простая обработка, нежели в сложных запросов, где могут произойти грубые ошибки, требующие более глубокой обработки как при INSERT / UPDATE
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // «Если ошибка, произошедшая при выполнении запроса, является ошибкой PostgreSQL и её SQLSTATE-код равен 23505 (нарушение уникальности) то обработай её специальным образом»
-			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		qctx, q := startQuery(ctx, op)
+		err := tx.QueryRowContext(qctx, query, email, name).Scan(&u.ID, &u.CreatedAt, &u.UpdatedAt) // при помощи помощи Scan достаём переменные из строки результата SQL запроса и записываем в указанные пееменные.
+		q.end(err)
+		if err != nil {
+			//В INSERT / UPDATE мы проверяем PgError, потому что это ошибки бизнес-ограничений БД(например нарушение NOT NULL или нарушение уникальности). Обычно проверка типа: if errors.Is(err, sql.ErrNoRows) тут нету замысловатой логики в самом запросе и ошибка будет наипростейшая, пользователя просто нет, поэтому и такая простая обработка, нежели в сложных запросов, где могут произойти грубые ошибки, требующие более глубокой обработки как при INSERT / UPDATE
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" { // «Если ошибка, произошедшая при выполнении запроса, является ошибкой PostgreSQL и её SQLSTATE-код равен 23505 (нарушение уникальности) то обработай её специальным образом»
+				return storage.ErrUserExists
+			}
+			return err
 		}
 
+		return insertAudit(ctx, tx, audit.OpCreate, u.ID, nil, &u)
+	})
+	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -70,7 +86,7 @@ func (s *Storage) GetUserByID(ctx context.Context, id int64) (*domain.User, erro
 	const op = "storage.postgres.GetUserByID"
 
 	query := `
-	SELECT id, email, name, created_at
+	SELECT id, email, name, created_at, updated_at
 	FROM users
 	WHERE id = $1
 	`
@@ -78,7 +94,9 @@ func (s *Storage) GetUserByID(ctx context.Context, id int64) (*domain.User, erro
 
 	var u domain.User
 
-	err := s.db.QueryRowContext(ctx, query, id).Scan(&u.ID, &u.Email, &u.Name, &u.CreatedAt)
+	qctx, q := startQuery(ctx, op)
+	err := s.db.QueryRowContext(qctx, query, id).Scan(&u.ID, &u.Email, &u.Name, &u.CreatedAt, &u.UpdatedAt)
+	q.end(err)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) { // Это не PgError потому что бд не считает это ошибкой (не ошибка PostgreSQL)
 			return nil, nil // нету пользователя ≠ ошибка, поэтому nil, nil (ни пользователя, ни ошибки)
@@ -90,29 +108,57 @@ func (s *Storage) GetUserByID(ctx context.Context, id int64) (*domain.User, erro
 	return &u, nil
 }
 
+// Update частично обновляет пользователя: пустые Email/Name не меняются (PATCH в HTTP шлюзе)
 func (s *Storage) Update(ctx context.Context, user *domain.User) (*domain.User, error) {
 	const op = "storage.postgres.Update"
 
 	query := `
 	UPDATE users 
-	SET email = $1, name = $2
+	SET email = $1, name = $2, updated_at = now()
 	WHERE id = $3
-	RETURNING id, email, name, created_at
+	RETURNING id, email, name, created_at, updated_at
 	`
 
 	var update domain.User // Входные данные ≠ результат операции + Без указателя потому что нужна пустая струтура для записи результата SQL запроса
 
-	err := s.db.QueryRowContext(ctx, query, user.Email, user.Name, user.ID).Scan(&update.ID, &update.Email, &update.Name, &update.CreatedAt) // Входные данные ≠ результат операции (ЭТО ВАЖНО, это я говорю к тому что если мы начали бы передавать в Scan входящие значения функции как в прошлых методах репозитория, Postgres начал бы добавлять результат sql запроса в не пустые поля структуры, а с какими то значениями, так как для метода Update передавалась заполненнная структура, а для корректного заполнения нам нужна пустая структура, что бы структура не заполнилась некорректными данными входящие параметры для запуска SQL запроса + его результат, это не корректно!!!! И выведет не тот результат SQL запроса, которйм мы ожидали получить, а будут некорректные данные и путаница!!!! Поэтому нужно создавать пустую структуру для записис SQL результата)
-	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserExists) // Пользователь уже существует
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// пользователь до изменения для журнала, строка блокируется до конца транзакции, что бы между чтением и UPDATE её никто не поменял
+		before, err := selectForUpdate(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return storage.ErrNotFound
 		}
 
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("%s: %w", op, storage.ErrNotFound) // Пользователь не найден
+		// не переданное поле оставляем как было, строка заблокирована, поэтому before актуален до конца транзакции
+		email, name := user.Email, user.Name
+		if email == "" {
+			email = before.Email
+		}
+		if name == "" {
+			name = before.Name
+		}
+
+		qctx, q := startQuery(ctx, op)
+		err = tx.QueryRowContext(qctx, query, email, name, user.ID).Scan(&update.ID, &update.Email, &update.Name, &update.CreatedAt, &update.UpdatedAt) // Входные данные ≠ результат операции (ЭТО ВАЖНО, это я говорю к тому что если мы начали бы передавать в Scan входящие значения функции как в прошлых методах репозитория, Postgres начал бы добавлять результат sql запроса в не пустые поля структуры, а с какими то значениями, так как для метода Update передавалась заполненнная структура, а для корректного заполнения нам нужна пустая структура, что бы структура не заполнилась некорректными данными входящие параметры для запуска SQL запроса + его результат, это не корректно!!!! И выведет не тот результат SQL запроса, которйм мы ожидали получить, а будут некорректные данные и путаница!!!! Поэтому нужно создавать пустую структуру для записис SQL результата)
+		q.end(err)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				return storage.ErrUserExists // Пользователь уже существует
+			}
+
+			if errors.Is(err, sql.ErrNoRows) {
+				return storage.ErrNotFound // Пользователь не найден
+			}
+
+			return err
 		}
 
+		return insertAudit(ctx, tx, audit.OpUpdate, update.ID, before, &update)
+	})
+	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -122,25 +168,154 @@ func (s *Storage) Update(ctx context.Context, user *domain.User) (*domain.User,
 func (s *Storage) Delete(ctx context.Context, id int64) error {
 	const op = "storage.postgres.Delete"
 
+	// RETURNING отдаёт удалённого пользователя для журнала, нет строки - пользователь не найден
 	query := `
 	DELETE FROM users
 	WHERE id = $1
+	RETURNING id, email, name, created_at, updated_at
 	`
 
-	res, err := s.db.ExecContext(ctx, query, id) // Почему Exec, а не QueryRow/Scan: DELETE обычно не возвращает строки | нам не нужно читать данные пользователя | нам важно узнать: удалилось или нет
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var before domain.User
+
+		qctx, q := startQuery(ctx, op)
+		err := tx.QueryRowContext(qctx, query, id).Scan(&before.ID, &before.Email, &before.Name, &before.CreatedAt, &before.UpdatedAt)
+		q.end(err)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return storage.ErrNotFound // Пользователь не найден
+			}
+			return err
+		}
+
+		return insertAudit(ctx, tx, audit.OpDelete, id, &before, nil)
+	})
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	affected, err := res.RowsAffected() // Показывает количество строк, которые были затронуты SQL запросом
+	return nil
+}
+
+// selectForUpdate читает пользователя в транзакции и блокирует строку до её конца, nil - пользователя нет
+func selectForUpdate(ctx context.Context, tx *sql.Tx, id int64) (*domain.User, error) {
+	const op = "storage.postgres.selectForUpdate"
+
+	query := `
+	SELECT id, email, name, created_at, updated_at
+	FROM users
+	WHERE id = $1
+	FOR UPDATE
+	`
+
+	var u domain.User
+
+	qctx, q := startQuery(ctx, op)
+	err := tx.QueryRowContext(qctx, query, id).Scan(&u.ID, &u.Email, &u.Name, &u.CreatedAt, &u.UpdatedAt)
+	q.end(err)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if affected == 0 { // если затронуто 0 строк, это значит что удалено 0 строк, это обозначает что пользователь не найден
-		return fmt.Errorf("%s: %w", op, storage.ErrNotFound) // Пользователь не найден
+	return &u, nil
+}
+
+// ListUsersAfterID возвращает до limit пользователей с id > afterID по возрастанию id
+// keyset пагинация вместо OFFSET: каждая страница - это короткий проход по первичному ключу, сколько бы пользователей ни было пройдено до неё
+func (s *Storage) ListUsersAfterID(ctx context.Context, afterID int64, limit int) ([]domain.User, error) {
+	const op = "storage.postgres.ListUsersAfterID"
+
+	query := `
+	SELECT id, email, name, created_at, updated_at
+	FROM users
+	WHERE id > $1
+	ORDER BY id
+	LIMIT $2
+	`
+
+	// спан запроса закрывается после чтения всех строк: строки приходят из базы по мере Next, это тоже время запроса
+	qctx, q := startQuery(ctx, op)
+	rows, err := s.db.QueryContext(qctx, query, afterID, limit)
+	if err != nil {
+		q.end(err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	users := make([]domain.User, 0, limit)
+	for rows.Next() {
+		var u domain.User
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			q.end(err)
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, u)
+	}
+
+	err = rows.Err()
+	q.end(err)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	return users, nil
+}
+
+// запрос дольше этого порога пишется в лог как Warn, остальные - Debug
+const slowQueryThreshold = 500 * time.Millisecond
+
+// querySpan - один запрос в базу: спан открывается до запроса, end закрывает его и пишет запрос в логгер запроса из контекста (с request_id),
+// так запросы в базу видны в трассе и рядом с логами gRPC вызова
+type querySpan struct {
+	ctx   context.Context
+	op    string
+	start time.Time
+	span  trace.Span
+}
+
+// startQuery открывает спан запроса, запрос выполняется с возвращённым контекстом, что бы его спан был дочерним
+func startQuery(ctx context.Context, op string) (context.Context, *querySpan) {
+	ctx, span := tracer.Start(ctx, op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system.name", "postgresql")),
+	)
+	return ctx, &querySpan{ctx: ctx, op: op, start: time.Now(), span: span}
+}
+
+// end вызывается, когда запрос полностью выполнен: для SELECT со строками - после чтения строк и rows.Err()
+// sql.ErrNoRows не ошибка: так postgres отвечает "пользователя нет"
+func (q *querySpan) end(err error) {
+	elapsed := time.Since(q.start)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		tracing.End(q.span, nil)
+	} else {
+		tracing.End(q.span, err)
+	}
+
+	log := sl.FromContext(q.ctx, nil)
+	attrs := []any{slog.String("op", q.op), slog.Duration("duration", elapsed)}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		attrs = append(attrs, sl.Err(err))
+	}
+
+	if elapsed >= slowQueryThreshold {
+		log.Warn("slow query", attrs...)
+		return
+	}
+	log.Debug("query executed", attrs...)
+}
+
+// Ping проверяет, что база доступна, используется health проверкой
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.postgres.Ping"
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 	return nil
 }
 
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/Derbik-Git/user-service/internal/domain"
+	errorsx "github.com/Derbik-Git/user-service/internal/errors"
 	"github.com/Derbik-Git/user-service/internal/repository/postgres/storage"
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/stretchr/testify/require"
@@ -92,6 +93,24 @@ func TestPostgres_UserRepository_Integration(t *testing.T) {
 		require.Equal(t, user.Name, update.Name)
 	})
 
+	t.Run("UpdatePartial", func(t *testing.T) {
+		user, err := createRandomUser(ctx, store)
+		require.NoError(t, err)
+
+		name := gofakeit.Name()
+		update, err := store.Update(ctx, &domain.User{ID: user.ID, Name: name}) // email не передан - должен остаться прежним
+		require.NoError(t, err)
+
+		require.Equal(t, user.Email, update.Email)
+		require.Equal(t, name, update.Name)
+	})
+
+	t.Run("UpdateNotFound", func(t *testing.T) {
+		_, err := store.Update(ctx, &domain.User{ID: 999999999, Name: gofakeit.Name()})
+		require.ErrorIs(t, err, storage.ErrNotFound)
+		require.ErrorIs(t, err, errorsx.ErrNotFound) // по ней ToGRPC/ToHTTP отдают NotFound, а не Internal
+	})
+
 	t.Run("UpdateDuplicateEmail", func(t *testing.T) {
 		u1, err := createRandomUser(ctx, store)
 		require.NoError(t, err)
@@ -115,4 +134,35 @@ func TestPostgres_UserRepository_Integration(t *testing.T) {
 		err = store.Delete(ctx, user.ID)
 		require.ErrorIs(t, err, storage.ErrNotFound)
 	})
+
+	t.Run("ListUsersAfterID", func(t *testing.T) {
+		var created []int64
+		for i := 0; i < 3; i++ {
+			user, err := createRandomUser(ctx, store)
+			require.NoError(t, err)
+			created = append(created, user.ID)
+		}
+
+		// курсор строго больше afterID, id по возрастанию, не больше limit строк
+		users, err := store.ListUsersAfterID(ctx, created[0]-1, 2)
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+		require.Equal(t, created[0], users[0].ID)
+		require.Less(t, users[0].ID, users[1].ID)
+		require.NotEmpty(t, users[0].Email)
+		require.False(t, users[0].CreatedAt.IsZero())
+
+		// следующая страница начинается после последнего id предыдущей
+		next, err := store.ListUsersAfterID(ctx, users[1].ID, 2)
+		require.NoError(t, err)
+		for _, u := range next {
+			require.Greater(t, u.ID, users[1].ID)
+		}
+
+		last, err := store.ListUsersAfterID(ctx, created[2], 10)
+		require.NoError(t, err)
+		for _, u := range last {
+			require.Greater(t, u.ID, created[2])
+		}
+	})
 }
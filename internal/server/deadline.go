@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Deadlines - дедлайны по умолчанию для запросов, у которых клиент не задал свой
+// без них запрос клиента без дедлайна может висеть сколько угодно, пока висит postgres
+// ключ в Methods - полное имя gRPC метода (/user.v1.UserService/GetUser) или короткое (GetUser), 0 - без дедлайна
+type Deadlines struct {
+	Default time.Duration
+	Methods map[string]time.Duration
+}
+
+func (d Deadlines) For(fullMethod string) time.Duration {
+	if t, ok := d.Methods[fullMethod]; ok {
+		return t
+	}
+	if t, ok := d.Methods[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]; ok {
+		return t
+	}
+	return d.Default
+}
+
+// Apply ставит дедлайн fullMethod, если у ctx его ещё нет, дедлайн клиента не продлевается и не сокращается
+func (d Deadlines) Apply(ctx context.Context, fullMethod string) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+
+	timeout := d.For(fullMethod)
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// DeadlineInterceptor ставит дедлайн по умолчанию запросам без дедлайна
+// Ставится сразу после LoggingInterceptor, что бы дедлайн ограничивал и авторизацию, и хранилище идемпотентности, а не только сервис
+// Для стримов дедлайн по умолчанию не ставится: WatchUsers живёт, пока клиент не отпишется
+func DeadlineInterceptor(d Deadlines) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, cancel := d.Apply(ctx, info.FullMethod)
+		defer cancel()
+
+		return handler(ctx, req)
+	}
+}
+
+// ParseMethodDeadlines разбирает флаг вида "GetUser=2s;CreateUser=5s"
+func ParseMethodDeadlines(s string) (map[string]time.Duration, error) {
+	res := map[string]time.Duration{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		method, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(method) == "" {
+			return nil, fmt.Errorf("invalid method deadline %q, expected method=duration", entry)
+		}
+		t, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || t < 0 {
+			return nil, fmt.Errorf("invalid deadline for method %s: %q", method, value)
+		}
+		res[strings.TrimSpace(method)] = t
+	}
+	return res, nil
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	userv1 "github.com/Derbik-Git/protos-tren-redis/user/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestDeadlineInterceptor(t *testing.T) {
+	t.Parallel()
+
+	interceptor := DeadlineInterceptor(Deadlines{
+		Default: time.Second,
+		Methods: map[string]time.Duration{"CreateUser": 5 * time.Second, "DeleteUser": 0},
+	})
+
+	// remaining - сколько осталось до дедлайна внутри обработчика, -1 - дедлайна нет
+	remaining := func(ctx context.Context, method string) time.Duration {
+		var left time.Duration = -1
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, _ any) (any, error) {
+			if d, ok := ctx.Deadline(); ok {
+				left = time.Until(d)
+			}
+			return nil, nil
+		})
+		require.NoError(t, err)
+		return left
+	}
+
+	left := remaining(context.Background(), userv1.UserService_GetUser_FullMethodName)
+	assert.InDelta(t, time.Second, left, float64(100*time.Millisecond), "дедлайн по умолчанию")
+
+	left = remaining(context.Background(), userv1.UserService_CreateUser_FullMethodName)
+	assert.InDelta(t, 5*time.Second, left, float64(100*time.Millisecond), "дедлайн метода по короткому имени")
+
+	assert.Equal(t, time.Duration(-1), remaining(context.Background(), userv1.UserService_DeleteUser_FullMethodName), "0 - без дедлайна")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	left = remaining(ctx, userv1.UserService_GetUser_FullMethodName)
+	assert.Greater(t, left, 50*time.Second, "дедлайн клиента не сокращается")
+}
+
+func TestParseMethodDeadlines(t *testing.T) {
+	t.Parallel()
+
+	got, err := ParseMethodDeadlines(" GetUser=2s; /user.v1.UserService/CreateUser=500ms;")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{
+		"GetUser":                         2 * time.Second,
+		"/user.v1.UserService/CreateUser": 500 * time.Millisecond,
+	}, got)
+
+	for _, bad := range []string{"GetUser", "=1s", "GetUser=fast", "GetUser=-1s"} {
+		_, err := ParseMethodDeadlines(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"github.com/Derbik-Git/user-service/internal/tracing"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDHeader - ключ metadata (и HTTP заголовок в шлюзе), в котором клиент может передать свой id запроса,
+// тот же id возвращается клиенту в заголовках ответа, по нему ищутся все логи запроса во всех слоях
+const RequestIDHeader = "x-request-id"
+
+// клиентский id длиннее этого считаем мусором и генерируем свой, что бы не раздувать каждую строку лога
+const maxRequestIDLen = 128
+
+// LoggingInterceptor назначает запросу id (берёт из metadata x-request-id или генерирует), кладёт в контекст логгер
+// с request_id и методом, через который логируют Server, Service и Storage (sl.FromContext),
+// и один раз на вызов пишет итог: метод, адрес клиента, длительность и код ответа
+func LoggingInterceptor(log *slog.Logger) grpc.UnaryServerInterceptor {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		requestID := incomingRequestID(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, requestID)) // ошибка только если заголовки уже отправлены, для unary такого не бывает
+
+		ctx, reqLog := withRequestLogger(ctx, log, requestID, info.FullMethod)
+
+		resp, err := handler(ctx, req)
+
+		logFinished(ctx, reqLog, "grpc call finished", start, err)
+		return resp, err
+	}
+}
+
+// LoggingStreamInterceptor - то же для стримов (WatchUsers), итог пишется, когда стрим закрывается
+func LoggingStreamInterceptor(log *slog.Logger) grpc.StreamServerInterceptor {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+
+		requestID := incomingRequestID(ss.Context())
+		_ = ss.SetHeader(metadata.Pairs(RequestIDHeader, requestID))
+
+		ctx, reqLog := withRequestLogger(ss.Context(), log, requestID, info.FullMethod)
+
+		err := handler(srv, WrapServerStream(ss, ctx))
+
+		logFinished(ctx, reqLog, "grpc stream finished", start, err)
+		return err
+	}
+}
+
+// withRequestLogger кладёт в контекст request_id и логгер запроса
+func withRequestLogger(ctx context.Context, log *slog.Logger, requestID, method string) (context.Context, *slog.Logger) {
+	reqLog := log.With(slog.String("request_id", requestID), slog.String("method", method))
+	if traceID := tracing.TraceID(ctx); traceID != "" { // спан вызова уже в ctx (otelgrpc работает раньше интерцепторов), по trace_id лог находит трассу
+		reqLog = reqLog.With(slog.String("trace_id", traceID))
+	}
+	ctx = sl.WithRequestID(ctx, requestID)
+	ctx = sl.WithLogger(ctx, reqLog)
+	return ctx, reqLog
+}
+
+func logFinished(ctx context.Context, reqLog *slog.Logger, msg string, start time.Time, err error) {
+	code := status.Code(err)
+	attrs := []any{
+		slog.String("peer", peerAddr(ctx)),
+		slog.Duration("duration", time.Since(start)),
+		slog.String("code", code.String()),
+	}
+	if err != nil {
+		attrs = append(attrs, sl.Err(err))
+	}
+	reqLog.Log(ctx, levelForCode(code), msg, attrs...)
+}
+
+// WrapServerStream подменяет контекст стрима: так интерцепторы стримов передают дальше то, что unary интерцепторы передают через ctx
+func WrapServerStream(ss grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	return &serverStream{ServerStream: ss, ctx: ctx}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// NewRequestID возвращает id запроса из значения клиента, если оно пригодно, иначе новый
+func NewRequestID(fromClient string) string {
+	if validRequestID(fromClient) {
+		return fromClient
+	}
+	return uuid.NewString()
+}
+
+func incomingRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(RequestIDHeader); len(vals) > 0 {
+			return NewRequestID(vals[0])
+		}
+	}
+	return NewRequestID("")
+}
+
+// validRequestID пропускает только короткие id из безопасных символов, id попадает в логи и заголовки ответа
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// levelForCode - ошибки клиента (невалидный запрос, нет пользователя) это Warn, проблемы сервера - Error
+func levelForCode(code codes.Code) slog.Level {
+	switch code {
+	case codes.OK:
+		return slog.LevelInfo
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable, codes.DeadlineExceeded, codes.Unimplemented:
+		return slog.LevelError
+	default:
+		return slog.LevelWarn
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var lines []map[string]any
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]any
+		require.NoError(t, json.Unmarshal([]byte(l), &m))
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		incoming string // x-request-id от клиента, пустая строка - не передан
+		wantSame bool   // id клиента должен сохраниться
+		err      error
+		level    string
+		code     string
+	}{
+		{name: "propagated", incoming: "req-123", wantSame: true, level: "INFO", code: "OK"},
+		{name: "generated", level: "INFO", code: "OK"},
+		{name: "garbage replaced", incoming: "bad id\nwith newline", level: "INFO", code: "OK"},
+		{name: "client error", incoming: "req-404", wantSame: true, err: status.Error(codes.NotFound, "user not found"), level: "WARN", code: "NotFound"},
+		{name: "server error", incoming: "req-500", wantSame: true, err: status.Error(codes.Internal, "db is down"), level: "ERROR", code: "Internal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			log := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+			ctx := context.Background()
+			if tt.incoming != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(RequestIDHeader, tt.incoming))
+			}
+
+			var seenID string
+			handler := func(ctx context.Context, req any) (any, error) {
+				seenID = sl.RequestID(ctx)
+				// так логируют Service и Storage
+				sl.FromContext(ctx, nil).Debug("inside service")
+				return "ok", tt.err
+			}
+
+			_, err := LoggingInterceptor(log)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/user.v1.UserService/GetUser"}, handler)
+			assert.Equal(t, tt.err, err)
+
+			require.NotEmpty(t, seenID)
+			if tt.wantSame {
+				assert.Equal(t, tt.incoming, seenID)
+			} else {
+				assert.NotEqual(t, tt.incoming, seenID)
+			}
+
+			lines := logLines(t, &buf)
+			require.Len(t, lines, 2)
+
+			for _, l := range lines {
+				assert.Equal(t, seenID, l["request_id"], "все строки запроса связаны одним request_id")
+				assert.Equal(t, "/user.v1.UserService/GetUser", l["method"])
+			}
+
+			final := lines[1]
+			assert.Equal(t, "grpc call finished", final["msg"])
+			assert.Equal(t, tt.level, final["level"])
+			assert.Equal(t, tt.code, final["code"])
+			assert.Contains(t, final, "duration")
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/Derbik-Git/user-service/internal/metrics"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RecoveryInterceptor превращает панику в обработчике в ответ codes.Internal, иначе одна паника (например разыменование nil)
+// роняет весь процесс вместе со всеми текущими запросами других клиентов
+// Стек пишется в лог запроса (с request_id из LoggingInterceptor), клиенту уходит только общий текст
+// Интерцептор ставится последним в цепочке, что бы логирование и метрики увидели ошибку Internal, как у обычного упавшего запроса
+func RecoveryInterceptor(log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				LogPanic(ctx, log, info.FullMethod, p)
+				resp, err = nil, status.Error(codes.Internal, "internal error")
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// RecoveryStreamInterceptor - то же для стримов
+func RecoveryStreamInterceptor(log *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				LogPanic(ss.Context(), log, info.FullMethod, p)
+				err = status.Error(codes.Internal, "internal error")
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// LogPanic пишет перехваченную панику со стеком и увеличивает счётчик паник, общий для gRPC и HTTP шлюза
+// request_id и метод добавляются явно, а не через логгер запроса, что бы они были в логе, даже если LoggingInterceptor не подключён
+func LogPanic(ctx context.Context, log *slog.Logger, method string, p any) {
+	const op = "server.LogPanic"
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	metrics.PanicRecovered(method)
+
+	log.Error("panic recovered",
+		slog.String("op", op),
+		slog.String("method", method),
+		slog.String("request_id", sl.RequestID(ctx)),
+		slog.String("panic", fmt.Sprint(p)),
+		slog.String("stack", string(debug.Stack())),
+	)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	userv1 "github.com/Derbik-Git/protos-tren-redis/user/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// panicCount - значение grpc_panics_total для метода, счётчик глобальный, поэтому тест сравнивает разницу
+func panicCount(t *testing.T, method string) float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	for _, f := range families {
+		if f.GetName() != "grpc_panics_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "method" && l.GetValue() == method {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	t.Parallel()
+
+	const method = "/user.v1.UserService/GetUser"
+
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	// сервер без сервиса: вызов метода на nil интерфейсе - настоящая паника разыменования nil
+	srv := NewServer(nil, log)
+
+	// та же цепочка, что в app.NewApp: логирование снаружи, recovery вплотную к обработчику
+	logging, recovery := LoggingInterceptor(log), RecoveryInterceptor(log)
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+	call := func(ctx context.Context, req any) (any, error) {
+		return logging(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+			return recovery(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				return srv.GetUser(ctx, req.(*userv1.GetUserRequest))
+			})
+		})
+	}
+
+	before := panicCount(t, method)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDHeader, "req-panic"))
+	resp, err := call(ctx, &userv1.GetUserRequest{Id: 1})
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.NotContains(t, status.Convert(err).Message(), "nil pointer", "детали паники клиенту не отдаются")
+
+	assert.Equal(t, before+1, panicCount(t, method))
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 2)
+
+	panicLine := lines[0]
+	assert.Equal(t, "panic recovered", panicLine["msg"])
+	assert.Equal(t, "req-panic", panicLine["request_id"])
+	assert.Contains(t, panicLine["panic"], "nil pointer dereference")
+	assert.Contains(t, panicLine["stack"], "server.(*Server).GetUser")
+
+	final := lines[1]
+	assert.Equal(t, "Internal", final["code"], "для логирования паника выглядит как обычный упавший запрос")
+	assert.Equal(t, "req-panic", final["request_id"])
+
+	// после паники сервер продолжает отвечать
+	_, err = call(context.Background(), &userv1.GetUserRequest{Id: 0})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// внешний recovery в начале цепочки app.NewApp ловит панику в самом интерцепторе, до которой внутренний не достаёт
+func TestRecoveryInterceptor_PanicInInterceptor(t *testing.T) {
+	t.Parallel()
+
+	const method = "/user.v1.UserService/DeleteUser"
+
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	outer, inner := RecoveryInterceptor(log), RecoveryInterceptor(log)
+	broken := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		panic("broken interceptor")
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+
+	before := panicCount(t, method)
+
+	resp, err := outer(context.Background(), &userv1.DeleteUserRequest{Id: 1}, info, func(ctx context.Context, req any) (any, error) {
+		return broken(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+			return inner(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				t.Fatal("обработчик не должен вызываться после паники в интерцепторе")
+				return nil, nil
+			})
+		})
+	})
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, before+1, panicCount(t, method))
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "broken interceptor", lines[0]["panic"])
+}
@@ -11,8 +11,6 @@ import (
 	errorsx "github.com/Derbik-Git/user-service/internal/errors"
 	"github.com/Derbik-Git/user-service/internal/sl"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 type UserService interface {
@@ -56,16 +54,19 @@ func NewServer(userService UserService, logger *slog.Logger) *Server {
 func (s *Server) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*userv1.GetUserResponse, error) {
 	const op = "app.Server.GetUser"
 
-	if req == nil || req.GetId() <= 0 {
-		s.logger.Warn("invalid request", slog.String("op", op))
-		return nil, status.Error(codes.InvalidArgument, "id must be > 0")
+	if err := ValidateID(req.GetId()); err != nil {
+		s.log(ctx).Warn("invalid request", slog.String("op", op), sl.Err(err))
+		return nil, errorsx.ToGRPC(err)
 	}
 
 	usr, err := s.UserService.GetUser(ctx, req.GetId())
 	if err != nil {
-		s.logger.Warn("get user failed", slog.String("op", op), sl.Err(err))
+		s.log(ctx).Warn("get user failed", slog.String("op", op), sl.Err(err))
 		return nil, errorsx.ToGRPC(err)
 	}
+	if usr == nil { // сервис возвращает nil, nil, если пользователя нет
+		return nil, errorsx.ToGRPC(ErrUserNotFound)
+	}
 
 	return &userv1.GetUserResponse{
 		User: &userv1.User{ // конвертируем структуру User в userv1.User(эта структура пришла из сервиса)
@@ -80,19 +81,14 @@ func (s *Server) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*user
 func (s *Server) CreateUser(ctx context.Context, req *userv1.CreateUserRequest) (*userv1.CreateUserResponse, error) {
 	const op = "app.Server.CreateUser"
 
-	if req == nil || req.GetEmail() == "" {
-		s.logger.Warn("missing email", slog.String("op", op))
-		return nil, status.Error(codes.InvalidArgument, "email is required")
-	}
-
-	if req.GetName() == "" {
-		s.logger.Warn("missing name", slog.String("op", op))
-		return nil, status.Error(codes.InvalidArgument, "name is required")
+	if err := ValidateCreate(req.GetEmail(), req.GetName()); err != nil {
+		s.log(ctx).Warn("invalid request", slog.String("op", op), sl.Err(err))
+		return nil, errorsx.ToGRPC(err)
 	}
 
 	usr, err := s.UserService.CreateUser(ctx, req.GetEmail(), req.GetName())
 	if err != nil {
-		s.logger.Error("CreateUser failed", slog.String("op", op), sl.Err(err))
+		s.log(ctx).Error("CreateUser failed", slog.String("op", op), sl.Err(err))
 		return nil, errorsx.ToGRPC(err)
 	}
 
@@ -110,13 +106,9 @@ func (s *Server) UpdateUser(ctx context.Context, req *userv1.UpdateUserRequest)
 	const op = "app.Server.UpdateUser"
 
 	// Проверка валидности запроса
-	if req == nil || req.GetId() <= 0 {
-		s.logger.Warn("invalid request: id must be > 0", slog.String("op", op))
-		return nil, status.Error(codes.InvalidArgument, "id must be > 0")
-	}
-	if req.GetEmail() == "" && req.GetName() == "" {
-		s.logger.Warn("invalid request: nothing to update", slog.String("op", op))
-		return nil, status.Error(codes.InvalidArgument, "nothing to update")
+	if err := ValidateUpdate(req.GetId(), req.GetEmail(), req.GetName()); err != nil {
+		s.log(ctx).Warn("invalid request", slog.String("op", op), sl.Err(err))
+		return nil, errorsx.ToGRPC(err)
 	}
 
 	// Формируем domain.User из данных запроса
@@ -129,9 +121,12 @@ func (s *Server) UpdateUser(ctx context.Context, req *userv1.UpdateUserRequest)
 	// Вызываем сервис
 	usr, err := s.UserService.UpdateUser(ctx, usrDomain)
 	if err != nil {
-		s.logger.Warn("UpdateUser failed", slog.String("op", op), sl.Err(err))
+		s.log(ctx).Warn("UpdateUser failed", slog.String("op", op), sl.Err(err))
 		return nil, errorsx.ToGRPC(err)
 	}
+	if usr == nil {
+		return nil, errorsx.ToGRPC(ErrUserNotFound)
+	}
 
 	// Возвращаем ответ protobuf
 	return &userv1.UpdateUserResponse{
@@ -147,14 +142,19 @@ func (s *Server) UpdateUser(ctx context.Context, req *userv1.UpdateUserRequest)
 func (s *Server) DeleteUser(ctx context.Context, req *userv1.DeleteUserRequest) (*userv1.DeleteUserResponse, error) {
 	const op = "app.Server.DeleteUser"
 
-	if req == nil || req.GetId() <= 0 {
-		s.logger.Warn("invalid request", slog.String("op", op))
-		return nil, status.Error(codes.InvalidArgument, "id must be > 0")
+	if err := ValidateID(req.GetId()); err != nil {
+		s.log(ctx).Warn("invalid request", slog.String("op", op), sl.Err(err))
+		return nil, errorsx.ToGRPC(err)
 	}
 
 	if err := s.UserService.DeleteUser(ctx, req.GetId()); err != nil {
-		s.logger.Warn("DeleteUser failed", slog.String("op", op))
+		s.log(ctx).Warn("DeleteUser failed", slog.String("op", op), sl.Err(err))
 		return nil, errorsx.ToGRPC(err)
 	}
 	return &userv1.DeleteUserResponse{Success: true}, nil
 }
+
+// log возвращает логгер запроса из LoggingInterceptor (с request_id), без интерцептора - логгер сервера
+func (s *Server) log(ctx context.Context) *slog.Logger {
+	return sl.FromContext(ctx, s.logger)
+}
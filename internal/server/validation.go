@@ -0,0 +1,56 @@
+package server
+
+import (
+	"fmt"
+
+	errorsx "github.com/Derbik-Git/user-service/internal/errors"
+)
+
+// ErrUserNotFound отдаётся клиенту, когда сервис вернул nil, nil (так репозиторий сообщает, что пользователя нет)
+var ErrUserNotFound = fmt.Errorf("user %w", errorsx.ErrNotFound)
+
+// Проверки запросов общие для gRPC сервера и HTTP шлюза (internal/gateway), что бы оба транспорта одинаково отвечали на кривой запрос:
+// ошибка оборачивает errorsx.ErrInvalidInput, поэтому ToGRPC превращает её в InvalidArgument, а ToHTTP - в 400
+
+// ValidationError - ошибка валидации запроса, текст уходит клиенту как есть
+type ValidationError struct {
+	msg string
+}
+
+func (e *ValidationError) Error() string { return e.msg }
+
+func (e *ValidationError) Unwrap() error { return errorsx.ErrInvalidInput }
+
+func invalid(msg string) error {
+	return &ValidationError{msg: msg}
+}
+
+// ValidateID проверяет id пользователя в Get/Delete
+func ValidateID(id int64) error {
+	if id <= 0 {
+		return invalid("id must be > 0")
+	}
+	return nil
+}
+
+// ValidateCreate проверяет поля нового пользователя
+func ValidateCreate(email, name string) error {
+	if email == "" {
+		return invalid("email is required")
+	}
+	if name == "" {
+		return invalid("name is required")
+	}
+	return nil
+}
+
+// ValidateUpdate проверяет запрос на обновление: нужен id и хотя бы одно поле
+func ValidateUpdate(id int64, email, name string) error {
+	if err := ValidateID(id); err != nil {
+		return err
+	}
+	if email == "" && name == "" {
+		return invalid("nothing to update")
+	}
+	return nil
+}
@@ -10,6 +10,8 @@ import (
 // EventProducerMock имитирует работу с Kafka для юнит-тестов
 type EventProducerMock struct {
 	PublishUserEventFunc func(ctx context.Context, topic string, eventType string, event *domain.User) error
+	PublishUserStateFunc func(ctx context.Context, topic string, user *domain.User) error
+	DeleteUserStateFunc  func(ctx context.Context, topic string, id int64) error
 }
 
 func (m *EventProducerMock) PublishUserEvent(ctx context.Context, topic string, eventType string, event *domain.User) error {
@@ -19,3 +21,19 @@ func (m *EventProducerMock) PublishUserEvent(ctx context.Context, topic string,
 
 	return m.PublishUserEventFunc(ctx, topic, eventType, event)
 }
+
+func (m *EventProducerMock) PublishUserState(ctx context.Context, topic string, user *domain.User) error {
+	if m.PublishUserStateFunc == nil {
+		return errors.New("PublishUserState method is not implemented in the unit tests of the service")
+	}
+
+	return m.PublishUserStateFunc(ctx, topic, user)
+}
+
+func (m *EventProducerMock) DeleteUserState(ctx context.Context, topic string, id int64) error {
+	if m.DeleteUserStateFunc == nil {
+		return errors.New("DeleteUserState method is not implemented in the unit tests of the service")
+	}
+
+	return m.DeleteUserStateFunc(ctx, topic, id)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"time"
 
@@ -9,9 +10,25 @@ import (
 	"github.com/Derbik-Git/user-service/internal/domain"
 	errorsx "github.com/Derbik-Git/user-service/internal/errors"
 	"github.com/Derbik-Git/user-service/internal/sl"
+	"github.com/Derbik-Git/user-service/internal/tracing"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// спан на каждый метод сервиса, внутри него - спаны запросов к postgres, redis и kafka
+var tracer = tracing.Tracer("github.com/Derbik-Git/user-service/internal/service")
+
+// endSpan - tracing.End для спанов сервиса: "пользователя нет" - обычный ответ клиенту, а не сбой,
+// поэтому спан ошибкой не помечается, а получает атрибут user.found = false
+func endSpan(span trace.Span, err error) {
+	if errors.Is(err, errorsx.ErrNotFound) {
+		span.SetAttributes(attribute.Bool("user.found", false))
+		err = nil
+	}
+	tracing.End(span, err)
+}
+
 type UserRepository interface {
 	GetUserByID(ctx context.Context, id int64) (*domain.User, error)
 	Create(ctx context.Context, email, name string) (*domain.User, error)
@@ -21,6 +38,10 @@ type UserRepository interface {
 
 type EventProducer interface {
 	PublishUserEvent(ctx context.Context, topic string, eventType string, user *domain.User) error
+
+	// состояние пользователя для compacted топика domain.TopicUserState, публикуется вместе с событием об изменении
+	PublishUserState(ctx context.Context, topic string, user *domain.User) error
+	DeleteUserState(ctx context.Context, topic string, id int64) error
 }
 
 // менять по мере интеграции новых технологий
@@ -30,6 +51,9 @@ type Service struct {
 	broker EventProducer
 	log    *slog.Logger
 	ttl    time.Duration
+
+	// Timeouts - бюджеты обращений к кешу, базе и брокеру, нулевое значение - без своих лимитов
+	Timeouts Timeouts
 }
 
 func NewUserService(repo UserRepository, cache cache.Cache, broker EventProducer, log *slog.Logger, ttl time.Duration) *Service {
@@ -46,18 +70,24 @@ func NewUserService(repo UserRepository, cache cache.Cache, broker EventProducer
 	}
 }
 
-func (s *Service) CreateUser(ctx context.Context, email, name string) (*domain.User, error) {
+func (s *Service) CreateUser(ctx context.Context, email, name string) (_ *domain.User, err error) {
 	const op = "service.CreateUser"
-	s.log.Info(op)
+	ctx, span := tracer.Start(ctx, op)
+	defer func() { endSpan(span, err) }()
+
+	s.logger(ctx).Info(op)
 
 	if email == "" || name == "" {
-		s.log.Error(op, sl.Err(errorsx.ErrInvalidInput))
+		s.logger(ctx).Error(op, sl.Err(errorsx.ErrInvalidInput))
 		return nil, errorsx.ErrInvalidInput
 	}
 
-	u, err := s.repo.Create(ctx, email, name)
+	// запись - без бюджета слоя, только дедлайн запроса (см. Timeouts.DB)
+	u, err := withTimeout(ctx, op, layerDB, noWriteTimeout, func(ctx context.Context) (*domain.User, error) {
+		return s.repo.Create(ctx, email, name)
+	})
 	if err != nil {
-		s.log.Error(op, sl.Err(err))
+		s.logger(ctx).Error(op, sl.Err(err))
 		return nil, err
 	}
 
@@ -69,66 +99,92 @@ func (s *Service) CreateUser(ctx context.Context, email, name string) (*domain.U
 	}
 
 	if s.broker != nil {
-		err = s.broker.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserCreated, u)
+		err = execWithTimeout(ctx, op, layerBroker, s.Timeouts.Broker, func(ctx context.Context) error {
+			return s.broker.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserCreated, u)
+		})
 		if err != nil {
-			s.log.Error(op, slog.String("msg", "failed to publish to kafka"), sl.Err(err))
+			s.logger(ctx).Error(op, slog.String("msg", "failed to publish to kafka"), sl.Err(err))
 		} else {
-			s.log.Info(op, slog.String("msg", "kafka event published"), slog.String("ivent_id", event.ID))
+			s.logger(ctx).Info(op, slog.String("msg", "kafka event published"), slog.String("ivent_id", event.ID))
+		}
+
+		err = execWithTimeout(ctx, op, layerBroker, s.Timeouts.Broker, func(ctx context.Context) error {
+			return s.broker.PublishUserState(ctx, domain.TopicUserState, u)
+		})
+		if err != nil {
+			s.logger(ctx).Error(op, slog.String("msg", "failed to publish user state to kafka"), sl.Err(err))
 		}
 	}
 
 	return u, nil
 }
 
-func (s *Service) GetUser(ctx context.Context, id int64) (*domain.User, error) {
+func (s *Service) GetUser(ctx context.Context, id int64) (_ *domain.User, err error) {
 	const op = "service.GetUser"
-	s.log.Info(op)
+	ctx, span := tracer.Start(ctx, op)
+	defer func() { endSpan(span, err) }()
+
+	s.logger(ctx).Info(op)
 
 	if id <= 0 {
-		s.log.Error(op, sl.Err(errorsx.ErrInvalidInput))
+		s.logger(ctx).Error(op, sl.Err(errorsx.ErrInvalidInput))
 		return nil, errorsx.ErrInvalidInput
 	}
 
 	if s.cache != nil { //если подключение redis не = 0, работаем с кэшем
-		u, err := s.cache.GetUser(ctx, id)
+		u, err := withTimeout(ctx, op, layerCache, s.Timeouts.Cache, func(ctx context.Context) (*domain.User, error) {
+			return s.cache.GetUser(ctx, id)
+		})
 		if err != nil {
-			s.log.Warn(op, sl.Err(err))
+			s.logger(ctx).Warn(op, sl.Err(err))
 		} else if u != nil {
 			return u, nil
 		}
 	}
 
-	u, err := s.repo.GetUserByID(ctx, id)
+	u, err := withTimeout(ctx, op, layerDB, s.Timeouts.DB, func(ctx context.Context) (*domain.User, error) {
+		return s.repo.GetUserByID(ctx, id)
+	})
 	if err != nil {
-		s.log.Error(op, sl.Err(err))
+		s.logger(ctx).Error(op, sl.Err(err))
 		return nil, err
 	}
 
 	if u == nil {
+		span.SetAttributes(attribute.Bool("user.found", false))
 		return nil, nil
 	}
 
 	if s.cache != nil {
-		if err := s.cache.SetUser(ctx, u, s.ttl); err != nil {
-			s.log.Warn(op, sl.Err(err))
+		err := execWithTimeout(ctx, op, layerCache, s.Timeouts.Cache, func(ctx context.Context) error {
+			return s.cache.SetUser(ctx, u, s.ttl)
+		})
+		if err != nil {
+			s.logger(ctx).Warn(op, sl.Err(err))
 		}
 	}
 
 	return u, nil
 }
 
-func (s *Service) UpdateUser(ctx context.Context, u *domain.User) (*domain.User, error) {
+func (s *Service) UpdateUser(ctx context.Context, u *domain.User) (_ *domain.User, err error) {
 	const op = "service.UpdateUser"
-	s.log.Info(op)
+	ctx, span := tracer.Start(ctx, op)
+	defer func() { endSpan(span, err) }()
+
+	s.logger(ctx).Info(op)
 
-	if u == nil || u.ID <= 0 || u.Email == "" || u.Name == "" {
-		s.log.Error(op, sl.Err(errorsx.ErrInvalidInput))
+	// обновление частичное: пустое поле репозиторий оставляет как было, но хотя бы одно поле нужно
+	if u == nil || u.ID <= 0 || (u.Email == "" && u.Name == "") {
+		s.logger(ctx).Error(op, sl.Err(errorsx.ErrInvalidInput))
 		return nil, errorsx.ErrInvalidInput
 	}
 
-	updated, err := s.repo.Update(ctx, u)
+	updated, err := withTimeout(ctx, op, layerDB, noWriteTimeout, func(ctx context.Context) (*domain.User, error) {
+		return s.repo.Update(ctx, u)
+	})
 	if err != nil {
-		s.log.Error(op, sl.Err(err))
+		s.logger(ctx).Error(op, sl.Err(err))
 		return nil, err
 	}
 
@@ -137,53 +193,88 @@ func (s *Service) UpdateUser(ctx context.Context, u *domain.User) (*domain.User,
 	}
 
 	if s.cache != nil {
-		if err := s.cache.SetUser(ctx, updated, s.ttl); err != nil {
-			s.log.Warn(op, sl.Err(err))
+		err := execWithTimeout(ctx, op, layerCache, s.Timeouts.Cache, func(ctx context.Context) error {
+			return s.cache.SetUser(ctx, updated, s.ttl)
+		})
+		if err != nil {
+			s.logger(ctx).Warn(op, sl.Err(err))
 			return nil, err
 		}
 	}
 
 	if s.broker != nil {
-		err := s.broker.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserUpdated, updated)
+		err := execWithTimeout(ctx, op, layerBroker, s.Timeouts.Broker, func(ctx context.Context) error {
+			return s.broker.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserUpdated, updated)
+		})
 		if err != nil {
-			s.log.Error(op, slog.String("msg", "failed publish to kafka"), sl.Err(err))
+			s.logger(ctx).Error(op, slog.String("msg", "failed publish to kafka"), sl.Err(err))
 		} else {
-			s.log.Info(op, slog.String("msg", "event publish"))
+			s.logger(ctx).Info(op, slog.String("msg", "event publish"))
+		}
+
+		err = execWithTimeout(ctx, op, layerBroker, s.Timeouts.Broker, func(ctx context.Context) error {
+			return s.broker.PublishUserState(ctx, domain.TopicUserState, updated)
+		})
+		if err != nil {
+			s.logger(ctx).Error(op, slog.String("msg", "failed to publish user state to kafka"), sl.Err(err))
 		}
 	}
 
 	return updated, nil
 }
 
-func (s *Service) DeleteUser(ctx context.Context, id int64) error {
+func (s *Service) DeleteUser(ctx context.Context, id int64) (err error) {
 	const op = "service.DeleteUser"
-	s.log.Info(op)
+	ctx, span := tracer.Start(ctx, op)
+	defer func() { endSpan(span, err) }()
+
+	s.logger(ctx).Info(op)
 
 	if id <= 0 {
-		s.log.Error(op, sl.Err(errorsx.ErrInvalidInput))
+		s.logger(ctx).Error(op, sl.Err(errorsx.ErrInvalidInput))
 		return errorsx.ErrInvalidInput
 	}
 
-	if err := s.repo.Delete(ctx, id); err != nil {
-		s.log.Error(op, sl.Err(err))
+	err = execWithTimeout(ctx, op, layerDB, noWriteTimeout, func(ctx context.Context) error {
+		return s.repo.Delete(ctx, id)
+	})
+	if err != nil {
+		s.logger(ctx).Error(op, sl.Err(err))
 		return err
 	}
 
 	if s.cache != nil {
-		if err := s.cache.DeleteUser(ctx, id); err != nil {
-			s.log.Warn(op, sl.Err(err))
+		err := execWithTimeout(ctx, op, layerCache, s.Timeouts.Cache, func(ctx context.Context) error {
+			return s.cache.DeleteUser(ctx, id)
+		})
+		if err != nil {
+			s.logger(ctx).Warn(op, sl.Err(err))
 			return err
 		}
 	}
 
 	if s.broker != nil {
-		err := s.broker.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserDeleted, &domain.User{ID: id})
+		err := execWithTimeout(ctx, op, layerBroker, s.Timeouts.Broker, func(ctx context.Context) error {
+			return s.broker.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserDeleted, &domain.User{ID: id})
+		})
 		if err != nil {
-			s.log.Error(op, slog.String("msg", "failed to publish to kafka"), sl.Err(err))
+			s.logger(ctx).Error(op, slog.String("msg", "failed to publish to kafka"), sl.Err(err))
 		} else {
-			s.log.Info(op, slog.String("msg", "event published"))
+			s.logger(ctx).Info(op, slog.String("msg", "event published"))
+		}
+
+		err = execWithTimeout(ctx, op, layerBroker, s.Timeouts.Broker, func(ctx context.Context) error {
+			return s.broker.DeleteUserState(ctx, domain.TopicUserState, id)
+		})
+		if err != nil {
+			s.logger(ctx).Error(op, slog.String("msg", "failed to publish user state tombstone to kafka"), sl.Err(err))
 		}
 	}
 
 	return nil
 }
+
+// logger возвращает логгер запроса из контекста (с request_id из gRPC интерцептора), если его нет - логгер сервиса
+func (s *Service) logger(ctx context.Context) *slog.Logger {
+	return sl.FromContext(ctx, s.log)
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/metrics"
+)
+
+// Timeouts - сколько сервис ждёт одно обращение к зависимости, 0 - своего лимита нет, только дедлайн запроса
+// у каждого слоя свой бюджет: зависший redis не должен съесть время, которое нужно на запрос в postgres,
+// а медленная kafka - держать ответ клиенту, когда пользователь уже записан
+type Timeouts struct {
+	Cache time.Duration
+	// DB - только для чтения: запись ограничена лишь дедлайном запроса, короткий бюджет мог бы сработать уже после COMMIT,
+	// и клиент получил бы DeadlineExceeded за записанного пользователя (а ключ идемпотентности освободился бы под дубль)
+	DB     time.Duration
+	Broker time.Duration
+}
+
+// ярлыки layer в метрике service_dependency_timeouts_total
+const (
+	layerCache  = "cache"
+	layerDB     = "db"
+	layerBroker = "broker"
+)
+
+// noWriteTimeout - бюджет слоя для записи в базу: его нет, но истёкший дедлайн запроса всё равно виден в метрике
+const noWriteTimeout time.Duration = 0
+
+// withTimeout выполняет call с бюджетом timeout (но не дольше дедлайна ctx)
+// если обращение прервано по дедлайну, это видно в метрике, а ошибка оборачивает context.DeadlineExceeded,
+// поэтому клиент получит DeadlineExceeded, а не Internal
+func withTimeout[T any](ctx context.Context, op, layer string, timeout time.Duration, call func(ctx context.Context) (T, error)) (T, error) {
+	callCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	res, err := call(callCtx)
+	if err != nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		deadline := "layer"
+		if ctx.Err() != nil {
+			deadline = "request"
+		}
+		metrics.DependencyTimeout(layer, op, deadline)
+
+		if !errors.Is(err, context.DeadlineExceeded) { // драйвер мог вернуть свою ошибку отмены запроса
+			err = fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+		}
+		return res, fmt.Errorf("%s: %s: %w", op, layer, err)
+	}
+	return res, err
+}
+
+// execWithTimeout - withTimeout для обращений без результата
+func execWithTimeout(ctx context.Context, op, layer string, timeout time.Duration, call func(ctx context.Context) error) error {
+	_, err := withTimeout(ctx, op, layer, timeout, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, call(ctx)
+	})
+	return err
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+	errorsx "github.com/Derbik-Git/user-service/internal/errors"
+	"github.com/Derbik-Git/user-service/internal/service/mocks"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// timeoutCount - значение service_dependency_timeouts_total, счётчик глобальный, поэтому тест сравнивает разницу
+func timeoutCount(t *testing.T, layer, op, deadline string) float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	want := map[string]string{"layer": layer, "op": op, "deadline": deadline}
+	for _, f := range families {
+		if f.GetName() != "service_dependency_timeouts_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			matched := 0
+			for _, l := range m.GetLabel() {
+				if want[l.GetName()] == l.GetValue() {
+					matched++
+				}
+			}
+			if matched == len(want) {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+// blockingGet - репозиторий, который отвечает только по отмене контекста, как зависший запрос в postgres
+func blockingGet(ctx context.Context, _ int64) (*domain.User, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestService_Timeouts(t *testing.T) {
+	t.Parallel()
+
+	t.Run("db budget", func(t *testing.T) {
+		before := timeoutCount(t, layerDB, "service.GetUser", "layer")
+
+		svc := NewUserService(&mocks.UserRepositoryMock{GetUserByIDFunc: blockingGet}, nil, nil, nil, time.Minute)
+		svc.Timeouts = Timeouts{DB: 20 * time.Millisecond}
+
+		start := time.Now()
+		_, err := svc.GetUser(context.Background(), 1)
+		require.Error(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(errorsx.ToGRPC(err)), "клиент видит DeadlineExceeded, а не Internal")
+		assert.Equal(t, before+1, timeoutCount(t, layerDB, "service.GetUser", "layer"))
+	})
+
+	t.Run("slow cache does not eat db budget", func(t *testing.T) {
+		before := timeoutCount(t, layerCache, "service.GetUser", "layer")
+
+		cache := &mocks.CacheMock{GetUserFunc: blockingGet}
+		repo := &mocks.UserRepositoryMock{GetUserByIDFunc: func(context.Context, int64) (*domain.User, error) {
+			return &domain.User{ID: 1}, nil
+		}}
+		svc := NewUserService(repo, cache, nil, nil, time.Minute)
+		svc.Timeouts = Timeouts{Cache: 20 * time.Millisecond}
+
+		u, err := svc.GetUser(context.Background(), 1)
+		require.NoError(t, err, "кеш не ответил вовремя - идём в базу")
+		assert.Equal(t, int64(1), u.ID)
+		assert.Equal(t, before+1, timeoutCount(t, layerCache, "service.GetUser", "layer"))
+	})
+
+	t.Run("request deadline", func(t *testing.T) {
+		before := timeoutCount(t, layerDB, "service.GetUser", "request")
+
+		svc := NewUserService(&mocks.UserRepositoryMock{GetUserByIDFunc: blockingGet}, nil, nil, nil, time.Minute)
+		svc.Timeouts = Timeouts{DB: time.Minute}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := svc.GetUser(ctx, 1)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, before+1, timeoutCount(t, layerDB, "service.GetUser", "request"), "бюджет слоя больше дедлайна запроса")
+	})
+
+	t.Run("writes are not limited by db budget", func(t *testing.T) {
+		// запись дольше бюджета DB: короткий таймаут мог бы сработать уже после COMMIT, поэтому для записи его нет
+		repo := &mocks.UserRepositoryMock{CreateFunc: func(ctx context.Context, email, name string) (*domain.User, error) {
+			select {
+			case <-time.After(50 * time.Millisecond):
+				return &domain.User{ID: 1, Email: email, Name: name}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}}
+		svc := NewUserService(repo, nil, nil, nil, time.Minute)
+		svc.Timeouts = Timeouts{DB: 10 * time.Millisecond}
+
+		u, err := svc.CreateUser(context.Background(), "a@b.c", "alice")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), u.ID)
+	})
+}
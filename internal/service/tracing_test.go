@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+	errorsx "github.com/Derbik-Git/user-service/internal/errors"
+	"github.com/Derbik-Git/user-service/internal/repository/postgres/storage"
+	"github.com/Derbik-Git/user-service/internal/service/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// "пользователя нет" - обычный ответ, спан сервиса ошибкой не помечается, а настоящий сбой - помечается
+// без t.Parallel: тест меняет глобальный TracerProvider
+func TestService_SpanStatus(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	lastSpan := func(name string) sdktrace.ReadOnlySpan {
+		t.Helper()
+
+		var found sdktrace.ReadOnlySpan
+		for _, s := range recorder.Ended() {
+			if s.Name() == name {
+				found = s
+			}
+		}
+		require.NotNil(t, found, name)
+		return found
+	}
+
+	// ошибки те же, что отдаёт postgres репозиторий: id 1 - пользователя нет, id 2 - сбой базы
+	repo := &mocks.UserRepositoryMock{
+		GetUserByIDFunc: func(context.Context, int64) (*domain.User, error) { return nil, nil },
+		DeleteFunc: func(ctx context.Context, id int64) error {
+			return fmt.Errorf("storage.postgres.Delete: %w", storage.ErrNotFound)
+		},
+		UpdateFunc: func(ctx context.Context, u *domain.User) (*domain.User, error) {
+			if u.ID == 2 {
+				return nil, errors.New("connection reset")
+			}
+			return nil, fmt.Errorf("storage.postgres.Update: %w", storage.ErrNotFound)
+		},
+	}
+	svc := NewUserService(repo, nil, nil, nil, time.Minute)
+	ctx := context.Background()
+
+	u, err := svc.GetUser(ctx, 1)
+	require.NoError(t, err)
+	require.Nil(t, u)
+	span := lastSpan("service.GetUser")
+	assert.Equal(t, codes.Unset, span.Status().Code)
+	assert.Contains(t, span.Attributes(), attribute.Bool("user.found", false))
+
+	require.ErrorIs(t, svc.DeleteUser(ctx, 1), errorsx.ErrNotFound)
+	span = lastSpan("service.DeleteUser")
+	assert.Equal(t, codes.Unset, span.Status().Code)
+	assert.Empty(t, span.Events(), "not found не записывается в спан как ошибка")
+
+	_, err = svc.UpdateUser(ctx, &domain.User{ID: 1, Name: "alice"})
+	require.ErrorIs(t, err, errorsx.ErrNotFound)
+	span = lastSpan("service.UpdateUser")
+	assert.Equal(t, codes.Unset, span.Status().Code)
+	assert.Contains(t, span.Attributes(), attribute.Bool("user.found", false))
+	assert.Empty(t, span.Events(), "not found не записывается в спан как ошибка")
+
+	_, err = svc.UpdateUser(ctx, &domain.User{ID: 2, Email: "a@b.c", Name: "alice"})
+	require.Error(t, err)
+	assert.Equal(t, codes.Error, lastSpan("service.UpdateUser").Status().Code)
+}
@@ -0,0 +1,38 @@
+package sl
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+type requestIDKey struct{}
+
+// WithLogger кладёт в контекст логгер запроса (с request_id, методом и т.д.), его достают слои ниже через FromContext
+func WithLogger(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
+}
+
+// FromContext возвращает логгер запроса из контекста, а если его там нет (фоновые задачи, тесты) - fallback,
+// если и fallback = nil - slog.Default()
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if log, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && log != nil {
+		return log
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return slog.Default()
+}
+
+// WithRequestID кладёт в контекст id запроса
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID возвращает id запроса из контекста, пустая строка - запрос пришёл не через gRPC/HTTP
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
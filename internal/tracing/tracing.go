@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// куда отправляются спаны
+const (
+	ExporterNone   = "none"   // спаны не записываются, но trace context из входящих запросов всё равно передаётся дальше (в kafka)
+	ExporterStdout = "stdout" // для локального запуска: спаны печатаются в stdout
+	ExporterOTLP   = "otlp"   // OTLP/gRPC коллектор (OpenTelemetry Collector, Jaeger, Tempo)
+)
+
+// DefaultServiceName - service.name в спанах, по нему трассы сервиса ищутся в Jaeger/Tempo
+const DefaultServiceName = "user-service"
+
+// Config - настройки трассировки, нулевое значение - трассировка выключена
+type Config struct {
+	Exporter    string
+	Endpoint    string  // host:port коллектора для otlp, пустой - из OTEL_EXPORTER_OTLP_ENDPOINT, иначе localhost:4317
+	Insecure    bool    // otlp без TLS, обычно коллектор - sidecar или в том же кластере
+	SampleRatio float64 // доля записываемых трасс, (0, 1], 1 - все, если входящий запрос уже в трассе - решение берётся у вызывающего
+	ServiceName string
+}
+
+// Setup настраивает глобальные TracerProvider и propagator (W3C traceparent + baggage), возвращает shutdown,
+// который дописывает накопленные спаны, его нужно вызвать при остановке, иначе последние спаны потеряются
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	const op = "tracing.Setup"
+
+	// propagator нужен и без экспорта: иначе trace context входящего запроса не дойдёт до заголовков kafka
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	// опечатка в доле (0 или 10 вместо 0.1) не должна молча включать запись всех трасс
+	exporting := cfg.Exporter != "" && cfg.Exporter != ExporterNone
+	if exporting && !(cfg.SampleRatio > 0 && cfg.SampleRatio <= 1) {
+		return nil, fmt.Errorf("%s: sample ratio must be in (0, 1], got %v", op, cfg.SampleRatio)
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err := stdouttrace.New()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		exporter = exp
+	case ExporterOTLP:
+		var opts []otlptracegrpc.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exp, err := otlptracegrpc.New(ctx, opts...) // не ждёт коллектор: соединение устанавливается в фоне, недоступный коллектор не мешает старту
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		exporter = exp
+	default:
+		return nil, fmt.Errorf("%s: unknown exporter %q, expected none | stdout | otlp", op, cfg.Exporter)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter), // спаны отправляются пачками в фоне, запрос не ждёт коллектор
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		if err := provider.Shutdown(ctx); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}, nil
+}
+
+// Tracer - трейсер пакета, можно получать до Setup: спаны начнут записываться, как только Setup установит провайдер
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// End записывает ошибку в спан (если она есть) и завершает его
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceID - id трассы из ctx для логов, пустая строка - запрос не в трассе
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,39 @@
+package tracing
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetup(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := Setup(ctx, Config{Exporter: "jaeger"})
+	require.Error(t, err)
+
+	// доля вне (0, 1] - ошибка конфигурации, а не "записывать все трассы"
+	for _, ratio := range []float64{0, -0.5, 1.5, math.NaN()} {
+		_, err = Setup(ctx, Config{Exporter: ExporterStdout, SampleRatio: ratio})
+		require.Error(t, err, ratio)
+	}
+
+	shutdown, err := Setup(ctx, Config{})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(ctx))
+	assert.Empty(t, TraceID(ctx), "без спана в ctx trace_id нет")
+
+	// даже без экспорта trace context входящего запроса передаётся дальше
+	carrier := propagation.MapCarrier{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	in := otel.GetTextMapPropagator().Extract(ctx, carrier)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceID(in))
+
+	out := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(in, out)
+	assert.Equal(t, carrier["traceparent"], out["traceparent"])
+}
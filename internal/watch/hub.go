@@ -0,0 +1,268 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/metrics"
+)
+
+const (
+	defaultBufferSize     = 1024 // сколько последних изменений хранится для переподключения с last_event_id
+	defaultSubscriberSize = 256  // сколько изменений может ждать отправки одному клиенту, пока его не отключат
+)
+
+var (
+	ErrResumeTooOld   = errors.New("event is no longer available, resync and watch without last_event_id")
+	ErrUnknownEventID = errors.New("unknown event id")
+	ErrSlowSubscriber = errors.New("subscriber is too slow, reconnect with last_event_id")
+	ErrHubClosed      = errors.New("watch hub is closed")
+)
+
+// Event - изменение пользователя, которое получают подписчики
+type Event struct {
+	ID   string // <instance>-<seq>, по нему клиент продолжает после переподключения
+	Type string // domain.UserCreated | domain.UserUpdated | domain.UserDeleted
+	User domain.User
+	At   time.Time
+
+	seq uint64
+}
+
+// Hub раздаёт изменения пользователей подписчикам WatchUsers
+// Изменения приходят из сервиса через Producer, поэтому подписчик видит изменения, сделанные через эту реплику
+//
+// WatchUsers рассчитан на одну реплику сервиса. При нескольких репликах подписчик не видит изменений, сделанных через другие,
+// а event id (<instance>-<seq>) действителен только в процессе, который его выдал: с last_event_id от другой реплики
+// или из прошлого запуска клиент получает ErrResumeTooOld и перечитывает пользователей. Для нескольких реплик Hub нужно
+// кормить из консьюмера user-events, а id строить из партиции и offset-а
+//
+// Последние изменения хранятся в кольцевом буфере: клиент, у которого оборвался стрим, продолжает с last_event_id без пропусков,
+// если это изменение ещё в буфере. Публикация никогда не ждёт подписчиков: у каждого свой буфер, и клиент,
+// который не успевает читать, отключается с ErrSlowSubscriber, а не тормозит запись пользователей
+type Hub struct {
+	log *slog.Logger
+
+	mu       sync.Mutex
+	instance string // меняется при каждом старте: id из прошлого запуска нельзя продолжить, буфер пропал вместе с процессом
+	seq      uint64
+	buffer   []Event // кольцо, events[(start+i) % len]
+	start    int
+	count    int
+	subs     map[*Subscription]struct{}
+	closed   bool
+
+	subscriberSize int
+}
+
+func NewHub(log *slog.Logger, bufferSize, subscriberSize int) *Hub {
+	if log == nil {
+		log = slog.Default()
+	}
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	if subscriberSize <= 0 {
+		subscriberSize = defaultSubscriberSize
+	}
+
+	return &Hub{
+		log:            log,
+		instance:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		buffer:         make([]Event, bufferSize),
+		subs:           map[*Subscription]struct{}{},
+		subscriberSize: subscriberSize,
+	}
+}
+
+// Publish добавляет изменение в буфер и раздаёт подписчикам, не блокируется
+func (h *Hub) Publish(eventType string, u domain.User) {
+	const op = "watch.Hub.Publish"
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	h.seq++
+	ev := Event{
+		ID:   h.instance + "-" + strconv.FormatUint(h.seq, 10),
+		Type: eventType,
+		User: u,
+		At:   time.Now(),
+		seq:  h.seq,
+	}
+
+	if h.count < len(h.buffer) {
+		h.buffer[(h.start+h.count)%len(h.buffer)] = ev
+		h.count++
+	} else {
+		h.buffer[h.start] = ev
+		h.start = (h.start + 1) % len(h.buffer)
+	}
+
+	for s := range h.subs {
+		if !s.matches(ev) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			h.log.Warn("watch subscriber is too slow, disconnecting", slog.String("op", op), slog.String("last_event_id", ev.ID))
+			metrics.WatchSubscriberDropped()
+			h.removeLocked(s, ErrSlowSubscriber)
+		}
+	}
+}
+
+// Subscribe подписывает на изменения пользователей ids (пустой - всех), начиная после lastEventID (пустой - только новые)
+// изменения из буфера после lastEventID отдаются первыми, затем новые, без пропусков и повторов между ними
+func (h *Hub) Subscribe(ids []int64, lastEventID string) (*Subscription, error) {
+	const op = "watch.Hub.Subscribe"
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+
+	s := &Subscription{
+		hub:  h,
+		ch:   make(chan Event, h.subscriberSize),
+		done: make(chan struct{}),
+	}
+	if len(ids) > 0 {
+		s.ids = make(map[int64]struct{}, len(ids))
+		for _, id := range ids {
+			s.ids[id] = struct{}{}
+		}
+	}
+
+	if lastEventID != "" {
+		backlog, err := h.backlogLocked(lastEventID, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		s.backlog = backlog
+	}
+
+	h.subs[s] = struct{}{}
+	metrics.SetWatchSubscribers(len(h.subs))
+	return s, nil
+}
+
+// backlogLocked - изменения из буфера после lastEventID, которые подходят подписке
+func (h *Hub) backlogLocked(lastEventID string, s *Subscription) ([]Event, error) {
+	i := strings.LastIndex(lastEventID, "-")
+	if i <= 0 {
+		return nil, ErrUnknownEventID
+	}
+	seq, err := strconv.ParseUint(lastEventID[i+1:], 10, 64)
+	if err != nil {
+		return nil, ErrUnknownEventID
+	}
+	if lastEventID[:i] != h.instance {
+		return nil, ErrResumeTooOld
+	}
+	if seq > h.seq {
+		return nil, ErrUnknownEventID
+	}
+
+	// изменение сразу после lastEventID должно быть в буфере, иначе часть изменений потеряна
+	oldest := h.seq - uint64(h.count) + 1
+	if seq+1 < oldest {
+		return nil, ErrResumeTooOld
+	}
+
+	var backlog []Event
+	for j := range h.count {
+		ev := h.buffer[(h.start+j)%len(h.buffer)]
+		if ev.seq > seq && s.matches(ev) {
+			backlog = append(backlog, ev)
+		}
+	}
+	return backlog, nil
+}
+
+// Close отключает всех подписчиков с ErrHubClosed, вызывается перед остановкой gRPC сервера:
+// стримы сами не завершаются, и GracefulStop ждал бы их вечно
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for s := range h.subs {
+		h.removeLocked(s, ErrHubClosed)
+	}
+}
+
+func (h *Hub) removeLocked(s *Subscription, err error) {
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+	delete(h.subs, s)
+	s.err = err
+	close(s.done)
+	metrics.SetWatchSubscribers(len(h.subs))
+}
+
+// Subscription - подписка одного клиента
+type Subscription struct {
+	hub *Hub
+
+	ids     map[int64]struct{} // nil - все пользователи
+	backlog []Event            // пропущенные изменения, отдаются до новых
+	ch      chan Event
+	done    chan struct{} // закрывается, когда подписку отключил Hub, причина в err
+	err     error
+}
+
+func (s *Subscription) matches(ev Event) bool {
+	if s.ids == nil {
+		return true
+	}
+	_, ok := s.ids[ev.User.ID]
+	return ok
+}
+
+// Next ждёт следующее изменение, ошибка - ctx отменён или подписку отключил Hub (ErrSlowSubscriber, ErrHubClosed)
+func (s *Subscription) Next(ctx context.Context) (Event, error) {
+	if len(s.backlog) > 0 {
+		ev := s.backlog[0]
+		s.backlog = s.backlog[1:]
+		return ev, nil
+	}
+
+	select {
+	case <-s.done:
+		return Event{}, s.err
+	default:
+	}
+
+	select {
+	case ev := <-s.ch:
+		return ev, nil
+	case <-s.done:
+		return Event{}, s.err
+	case <-ctx.Done():
+		return Event{}, ctx.Err()
+	}
+}
+
+// Close отписывает клиента, повторный вызов ничего не делает
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.removeLocked(s, ErrHubClosed)
+}
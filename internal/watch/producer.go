@@ -0,0 +1,55 @@
+package watch
+
+import (
+	"context"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+)
+
+// eventProducer - то же, что service.EventProducer
+type eventProducer interface {
+	PublishUserEvent(ctx context.Context, topic string, eventType string, user *domain.User) error
+	PublishUserState(ctx context.Context, topic string, user *domain.User) error
+	DeleteUserState(ctx context.Context, topic string, id int64) error
+}
+
+// Producer - service.EventProducer, который отдаёт события user-events в Hub и дальше в Next (kafka)
+// так WatchUsers получает те же события, что сервис публикует в kafka, без отдельного консьюмера
+type Producer struct {
+	Hub  *Hub
+	Next eventProducer // nil - kafka выключена, события получает только Hub
+}
+
+func NewProducer(hub *Hub, next eventProducer) *Producer {
+	return &Producer{Hub: hub, Next: next}
+}
+
+// PublishUserEvent отдаёт событие в Hub до отправки в kafka: пользователь уже изменён в базе,
+// поэтому подписчики должны узнать об этом, даже если kafka недоступна
+func (p *Producer) PublishUserEvent(ctx context.Context, topic string, eventType string, user *domain.User) error {
+	if topic == domain.TopicUserEvents && user != nil {
+		switch eventType {
+		case domain.UserCreated, domain.UserUpdated, domain.UserDeleted:
+			p.Hub.Publish(eventType, *user)
+		}
+	}
+
+	if p.Next == nil {
+		return nil
+	}
+	return p.Next.PublishUserEvent(ctx, topic, eventType, user)
+}
+
+func (p *Producer) PublishUserState(ctx context.Context, topic string, user *domain.User) error {
+	if p.Next == nil {
+		return nil
+	}
+	return p.Next.PublishUserState(ctx, topic, user)
+}
+
+func (p *Producer) DeleteUserState(ctx context.Context, topic string, id int64) error {
+	if p.Next == nil {
+		return nil
+	}
+	return p.Next.DeleteUserState(ctx, topic, id)
+}
@@ -0,0 +1,122 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/sl"
+	"github.com/Derbik-Git/user-service/internal/watch/watchpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// максимум id в фильтре, фильтр проверяется на каждом событии
+const maxFilterIDs = 1000
+
+// Server - реализация watchpb.UserWatchServiceServer поверх Hub
+type Server struct {
+	watchpb.UnimplementedUserWatchServiceServer
+
+	log *slog.Logger
+	hub *Hub
+}
+
+func Register(gRPCServer *grpc.Server, hub *Hub, log *slog.Logger) {
+	if log == nil {
+		log = slog.Default()
+	}
+	watchpb.RegisterUserWatchServiceServer(gRPCServer, &Server{log: log, hub: hub})
+}
+
+func (s *Server) WatchUsers(req *watchpb.WatchUsersRequest, stream grpc.ServerStreamingServer[watchpb.UserChange]) error {
+	const op = "watch.Server.WatchUsers"
+
+	ctx := stream.Context()
+	log := sl.FromContext(ctx, s.log).With(slog.String("op", op))
+
+	if len(req.GetIds()) > maxFilterIDs {
+		return status.Errorf(codes.InvalidArgument, "at most %d ids can be watched", maxFilterIDs)
+	}
+	for _, id := range req.GetIds() {
+		if id <= 0 {
+			return status.Error(codes.InvalidArgument, "id must be > 0")
+		}
+	}
+
+	sub, err := s.hub.Subscribe(req.GetIds(), req.GetLastEventId())
+	if err != nil {
+		return toStatus(err)
+	}
+	defer sub.Close()
+
+	// заголовки (с x-request-id) отправляем сразу: по ним клиент знает, что подписка оформлена и изменения с этого момента не потеряются
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	log.Info("watch started", slog.Int("ids", len(req.GetIds())), slog.String("last_event_id", req.GetLastEventId()))
+
+	for {
+		ev, err := sub.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil // клиент закрыл стрим
+			}
+			return toStatus(err)
+		}
+
+		// Send блокируется, пока клиент не примет данные (flow control HTTP/2), в это время новые изменения копятся в буфере подписки
+		if err := stream.Send(toProto(ev)); err != nil {
+			return err
+		}
+	}
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, ErrResumeTooOld):
+		return status.Error(codes.OutOfRange, ErrResumeTooOld.Error())
+	case errors.Is(err, ErrUnknownEventID):
+		return status.Error(codes.InvalidArgument, ErrUnknownEventID.Error())
+	case errors.Is(err, ErrSlowSubscriber):
+		return status.Error(codes.ResourceExhausted, ErrSlowSubscriber.Error())
+	case errors.Is(err, ErrHubClosed):
+		return status.Error(codes.Unavailable, "server is shutting down, reconnect with last_event_id")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func toProto(ev Event) *watchpb.UserChange {
+	change := &watchpb.UserChange{
+		EventId:    ev.ID,
+		OccurredAt: timestamppb.New(ev.At),
+		User:       &watchpb.User{Id: ev.User.ID},
+	}
+
+	switch ev.Type {
+	case domain.UserCreated:
+		change.Type = watchpb.UserChange_TYPE_CREATED
+	case domain.UserUpdated:
+		change.Type = watchpb.UserChange_TYPE_UPDATED
+	case domain.UserDeleted:
+		change.Type = watchpb.UserChange_TYPE_DELETED
+		return change
+	}
+
+	change.User.Email = ev.User.Email
+	change.User.Name = ev.User.Name
+	if !ev.User.CreatedAt.IsZero() {
+		change.User.CreatedAt = timestamppb.New(ev.User.CreatedAt)
+	}
+	if !ev.User.UpdatedAt.IsZero() {
+		change.User.UpdatedAt = timestamppb.New(ev.User.UpdatedAt)
+	}
+	return change
+}
@@ -0,0 +1,190 @@
+package watch
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Derbik-Git/user-service/internal/domain"
+	"github.com/Derbik-Git/user-service/internal/server"
+	"github.com/Derbik-Git/user-service/internal/watch/watchpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func next(t *testing.T, s *Subscription) Event {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	ev, err := s.Next(ctx)
+	require.NoError(t, err)
+	return ev
+}
+
+func TestHub_FilterAndResume(t *testing.T) {
+	t.Parallel()
+
+	h := NewHub(nil, 3, 10)
+
+	all, err := h.Subscribe(nil, "")
+	require.NoError(t, err)
+	onlyTwo, err := h.Subscribe([]int64{2}, "")
+	require.NoError(t, err)
+
+	h.Publish(domain.UserCreated, domain.User{ID: 1, Name: "alice"})
+	h.Publish(domain.UserCreated, domain.User{ID: 2, Name: "bob"})
+	h.Publish(domain.UserUpdated, domain.User{ID: 1, Name: "alice2"})
+
+	first := next(t, all)
+	assert.Equal(t, int64(1), first.User.ID)
+	assert.Equal(t, int64(2), next(t, all).User.ID)
+	third := next(t, all)
+	assert.Equal(t, domain.UserUpdated, third.Type)
+
+	assert.Equal(t, int64(2), next(t, onlyTwo).User.ID, "подписка с фильтром получает только своих пользователей")
+
+	// переподключение: пропущенное отдаётся из буфера, дальше - новые изменения
+	resumed, err := h.Subscribe(nil, first.ID)
+	require.NoError(t, err)
+	h.Publish(domain.UserDeleted, domain.User{ID: 2})
+
+	assert.Equal(t, int64(2), next(t, resumed).User.ID)
+	assert.Equal(t, third.ID, next(t, resumed).ID)
+	assert.Equal(t, domain.UserDeleted, next(t, resumed).Type)
+
+	// буфер на 3 изменения: после ещё одного first вытеснен, и продолжить после него без пропуска уже нельзя
+	h.Publish(domain.UserCreated, domain.User{ID: 3})
+	_, err = h.Subscribe(nil, first.ID)
+	assert.ErrorIs(t, err, ErrResumeTooOld)
+
+	_, err = h.Subscribe(nil, "otherinstance-1")
+	assert.ErrorIs(t, err, ErrResumeTooOld, "id из прошлого запуска продолжить нельзя")
+
+	_, err = h.Subscribe(nil, h.instance+"-100")
+	assert.ErrorIs(t, err, ErrUnknownEventID)
+
+	_, err = h.Subscribe(nil, "garbage")
+	assert.ErrorIs(t, err, ErrUnknownEventID)
+}
+
+func TestHub_SlowSubscriberIsDropped(t *testing.T) {
+	t.Parallel()
+
+	h := NewHub(nil, 100, 2)
+
+	slow, err := h.Subscribe(nil, "")
+	require.NoError(t, err)
+	fast, err := h.Subscribe(nil, "")
+	require.NoError(t, err)
+
+	for i := range 5 {
+		h.Publish(domain.UserCreated, domain.User{ID: int64(i + 1)})
+		next(t, fast) // быстрый клиент читает сразу
+	}
+
+	_, err = slow.Next(context.Background())
+	assert.ErrorIs(t, err, ErrSlowSubscriber, "публикация не ждёт медленного клиента, он отключается")
+
+	h.Close()
+	_, err = fast.Next(context.Background())
+	assert.ErrorIs(t, err, ErrHubClosed)
+
+	_, err = h.Subscribe(nil, "")
+	assert.ErrorIs(t, err, ErrHubClosed)
+}
+
+func TestProducer_FeedsHubAndNext(t *testing.T) {
+	t.Parallel()
+
+	h := NewHub(nil, 10, 10)
+	sub, err := h.Subscribe(nil, "")
+	require.NoError(t, err)
+
+	p := NewProducer(h, nil)
+	ctx := context.Background()
+
+	require.NoError(t, p.PublishUserState(ctx, domain.TopicUserState, &domain.User{ID: 1}))
+	require.NoError(t, p.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserSnapshot, &domain.User{ID: 1}))
+	require.NoError(t, p.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserCreated, &domain.User{ID: 7}))
+
+	ev := next(t, sub)
+	assert.Equal(t, int64(7), ev.User.ID, "снимки и состояние - не изменения, подписчикам не отправляются")
+}
+
+func startServer(t *testing.T, h *Hub) watchpb.UserWatchServiceClient {
+	t.Helper()
+
+	l := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.ChainStreamInterceptor(server.LoggingStreamInterceptor(nil)))
+	Register(srv, h, nil)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return watchpb.NewUserWatchServiceClient(conn)
+}
+
+func TestServer_WatchUsers(t *testing.T) {
+	t.Parallel()
+
+	h := NewHub(nil, 10, 10)
+	client := startServer(t, h)
+	p := NewProducer(h, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchUsers(ctx, &watchpb.WatchUsersRequest{Ids: []int64{1}})
+	require.NoError(t, err)
+	md, err := stream.Header() // сервер отправляет заголовки, когда подписка уже оформлена
+	require.NoError(t, err)
+	assert.NotEmpty(t, md.Get(server.RequestIDHeader))
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, p.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserCreated, &domain.User{ID: 2, Email: "b@b.c"}))
+	require.NoError(t, p.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserCreated, &domain.User{ID: 1, Email: "a@b.c", Name: "alice", CreatedAt: created}))
+	require.NoError(t, p.PublishUserEvent(ctx, domain.TopicUserEvents, domain.UserDeleted, &domain.User{ID: 1}))
+
+	change, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, watchpb.UserChange_TYPE_CREATED, change.GetType())
+	assert.Equal(t, "a@b.c", change.GetUser().GetEmail())
+	assert.True(t, created.Equal(change.GetUser().GetCreatedAt().AsTime()))
+	firstID := change.GetEventId()
+
+	change, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, watchpb.UserChange_TYPE_DELETED, change.GetType())
+	assert.Equal(t, int64(1), change.GetUser().GetId())
+
+	// новый стрим продолжает после первого изменения
+	resumed, err := client.WatchUsers(ctx, &watchpb.WatchUsersRequest{Ids: []int64{1}, LastEventId: firstID})
+	require.NoError(t, err)
+	change, err = resumed.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, watchpb.UserChange_TYPE_DELETED, change.GetType())
+
+	bad, err := client.WatchUsers(ctx, &watchpb.WatchUsersRequest{Ids: []int64{0}})
+	require.NoError(t, err)
+	_, err = bad.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// остановка сервиса завершает стримы, и клиент может переподключиться к другой реплике
+	h.Close()
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
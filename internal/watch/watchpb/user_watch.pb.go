@@ -0,0 +1,370 @@
+// Схема gRPC сервиса подписки на изменения пользователей.
+// UserService описан во внешнем модуле protos-tren-redis, поэтому стриминговый метод живёт в отдельном сервисе того же gRPC сервера.
+//
+// Go код в этой папке сгенерирован из этого файла через protoc-gen-go и protoc-gen-go-grpc:
+//   protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative internal/watch/watchpb/user_watch.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: internal/watch/watchpb/user_watch.proto
+
+package watchpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type UserChange_Type int32
+
+const (
+	UserChange_TYPE_UNSPECIFIED UserChange_Type = 0
+	UserChange_TYPE_CREATED     UserChange_Type = 1
+	UserChange_TYPE_UPDATED     UserChange_Type = 2
+	UserChange_TYPE_DELETED     UserChange_Type = 3 // у удалённого пользователя заполнен только id
+)
+
+// Enum value maps for UserChange_Type.
+var (
+	UserChange_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "TYPE_CREATED",
+		2: "TYPE_UPDATED",
+		3: "TYPE_DELETED",
+	}
+	UserChange_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED": 0,
+		"TYPE_CREATED":     1,
+		"TYPE_UPDATED":     2,
+		"TYPE_DELETED":     3,
+	}
+)
+
+func (x UserChange_Type) Enum() *UserChange_Type {
+	p := new(UserChange_Type)
+	*p = x
+	return p
+}
+
+func (x UserChange_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (UserChange_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_internal_watch_watchpb_user_watch_proto_enumTypes[0].Descriptor()
+}
+
+func (UserChange_Type) Type() protoreflect.EnumType {
+	return &file_internal_watch_watchpb_user_watch_proto_enumTypes[0]
+}
+
+func (x UserChange_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use UserChange_Type.Descriptor instead.
+func (UserChange_Type) EnumDescriptor() ([]byte, []int) {
+	return file_internal_watch_watchpb_user_watch_proto_rawDescGZIP(), []int{2, 0}
+}
+
+type WatchUsersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ids           []int64                `protobuf:"varint,1,rep,packed,name=ids,proto3" json:"ids,omitempty"`                              // только эти пользователи, пустой список - все
+	LastEventId   string                 `protobuf:"bytes,2,opt,name=last_event_id,json=lastEventId,proto3" json:"last_event_id,omitempty"` // продолжить после этого изменения, пустой - только новые изменения
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchUsersRequest) Reset() {
+	*x = WatchUsersRequest{}
+	mi := &file_internal_watch_watchpb_user_watch_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchUsersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchUsersRequest) ProtoMessage() {}
+
+func (x *WatchUsersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_watch_watchpb_user_watch_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchUsersRequest.ProtoReflect.Descriptor instead.
+func (*WatchUsersRequest) Descriptor() ([]byte, []int) {
+	return file_internal_watch_watchpb_user_watch_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *WatchUsersRequest) GetIds() []int64 {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+func (x *WatchUsersRequest) GetLastEventId() string {
+	if x != nil {
+		return x.LastEventId
+	}
+	return ""
+}
+
+type User struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Email         string                 `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	Name          string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *User) Reset() {
+	*x = User{}
+	mi := &file_internal_watch_watchpb_user_watch_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *User) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*User) ProtoMessage() {}
+
+func (x *User) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_watch_watchpb_user_watch_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use User.ProtoReflect.Descriptor instead.
+func (*User) Descriptor() ([]byte, []int) {
+	return file_internal_watch_watchpb_user_watch_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *User) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *User) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *User) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *User) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *User) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type UserChange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	EventId       string                 `protobuf:"bytes,1,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	Type          UserChange_Type        `protobuf:"varint,2,opt,name=type,proto3,enum=user.watch.v1.UserChange_Type" json:"type,omitempty"`
+	User          *User                  `protobuf:"bytes,3,opt,name=user,proto3" json:"user,omitempty"`
+	OccurredAt    *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=occurred_at,json=occurredAt,proto3" json:"occurred_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserChange) Reset() {
+	*x = UserChange{}
+	mi := &file_internal_watch_watchpb_user_watch_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserChange) ProtoMessage() {}
+
+func (x *UserChange) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_watch_watchpb_user_watch_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserChange.ProtoReflect.Descriptor instead.
+func (*UserChange) Descriptor() ([]byte, []int) {
+	return file_internal_watch_watchpb_user_watch_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UserChange) GetEventId() string {
+	if x != nil {
+		return x.EventId
+	}
+	return ""
+}
+
+func (x *UserChange) GetType() UserChange_Type {
+	if x != nil {
+		return x.Type
+	}
+	return UserChange_TYPE_UNSPECIFIED
+}
+
+func (x *UserChange) GetUser() *User {
+	if x != nil {
+		return x.User
+	}
+	return nil
+}
+
+func (x *UserChange) GetOccurredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.OccurredAt
+	}
+	return nil
+}
+
+var File_internal_watch_watchpb_user_watch_proto protoreflect.FileDescriptor
+
+const file_internal_watch_watchpb_user_watch_proto_rawDesc = "" +
+	"\n" +
+	"'internal/watch/watchpb/user_watch.proto\x12\ruser.watch.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"I\n" +
+	"\x11WatchUsersRequest\x12\x10\n" +
+	"\x03ids\x18\x01 \x03(\x03R\x03ids\x12\"\n" +
+	"\rlast_event_id\x18\x02 \x01(\tR\vlastEventId\"\xb6\x01\n" +
+	"\x04User\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x14\n" +
+	"\x05email\x18\x02 \x01(\tR\x05email\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x129\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"\x95\x02\n" +
+	"\n" +
+	"UserChange\x12\x19\n" +
+	"\bevent_id\x18\x01 \x01(\tR\aeventId\x122\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x1e.user.watch.v1.UserChange.TypeR\x04type\x12'\n" +
+	"\x04user\x18\x03 \x01(\v2\x13.user.watch.v1.UserR\x04user\x12;\n" +
+	"\voccurred_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"occurredAt\"R\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fTYPE_CREATED\x10\x01\x12\x10\n" +
+	"\fTYPE_UPDATED\x10\x02\x12\x10\n" +
+	"\fTYPE_DELETED\x10\x032_\n" +
+	"\x10UserWatchService\x12K\n" +
+	"\n" +
+	"WatchUsers\x12 .user.watch.v1.WatchUsersRequest\x1a\x19.user.watch.v1.UserChange0\x01BCZAgithub.com/Derbik-Git/user-service/internal/watch/watchpb;watchpbb\x06proto3"
+
+var (
+	file_internal_watch_watchpb_user_watch_proto_rawDescOnce sync.Once
+	file_internal_watch_watchpb_user_watch_proto_rawDescData []byte
+)
+
+func file_internal_watch_watchpb_user_watch_proto_rawDescGZIP() []byte {
+	file_internal_watch_watchpb_user_watch_proto_rawDescOnce.Do(func() {
+		file_internal_watch_watchpb_user_watch_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_internal_watch_watchpb_user_watch_proto_rawDesc), len(file_internal_watch_watchpb_user_watch_proto_rawDesc)))
+	})
+	return file_internal_watch_watchpb_user_watch_proto_rawDescData
+}
+
+var file_internal_watch_watchpb_user_watch_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_internal_watch_watchpb_user_watch_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_internal_watch_watchpb_user_watch_proto_goTypes = []any{
+	(UserChange_Type)(0),          // 0: user.watch.v1.UserChange.Type
+	(*WatchUsersRequest)(nil),     // 1: user.watch.v1.WatchUsersRequest
+	(*User)(nil),                  // 2: user.watch.v1.User
+	(*UserChange)(nil),            // 3: user.watch.v1.UserChange
+	(*timestamppb.Timestamp)(nil), // 4: google.protobuf.Timestamp
+}
+var file_internal_watch_watchpb_user_watch_proto_depIdxs = []int32{
+	4, // 0: user.watch.v1.User.created_at:type_name -> google.protobuf.Timestamp
+	4, // 1: user.watch.v1.User.updated_at:type_name -> google.protobuf.Timestamp
+	0, // 2: user.watch.v1.UserChange.type:type_name -> user.watch.v1.UserChange.Type
+	2, // 3: user.watch.v1.UserChange.user:type_name -> user.watch.v1.User
+	4, // 4: user.watch.v1.UserChange.occurred_at:type_name -> google.protobuf.Timestamp
+	1, // 5: user.watch.v1.UserWatchService.WatchUsers:input_type -> user.watch.v1.WatchUsersRequest
+	3, // 6: user.watch.v1.UserWatchService.WatchUsers:output_type -> user.watch.v1.UserChange
+	6, // [6:7] is the sub-list for method output_type
+	5, // [5:6] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_internal_watch_watchpb_user_watch_proto_init() }
+func file_internal_watch_watchpb_user_watch_proto_init() {
+	if File_internal_watch_watchpb_user_watch_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_watch_watchpb_user_watch_proto_rawDesc), len(file_internal_watch_watchpb_user_watch_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_internal_watch_watchpb_user_watch_proto_goTypes,
+		DependencyIndexes: file_internal_watch_watchpb_user_watch_proto_depIdxs,
+		EnumInfos:         file_internal_watch_watchpb_user_watch_proto_enumTypes,
+		MessageInfos:      file_internal_watch_watchpb_user_watch_proto_msgTypes,
+	}.Build()
+	File_internal_watch_watchpb_user_watch_proto = out.File
+	file_internal_watch_watchpb_user_watch_proto_goTypes = nil
+	file_internal_watch_watchpb_user_watch_proto_depIdxs = nil
+}
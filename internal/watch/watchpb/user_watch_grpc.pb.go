@@ -0,0 +1,142 @@
+// Схема gRPC сервиса подписки на изменения пользователей.
+// UserService описан во внешнем модуле protos-tren-redis, поэтому стриминговый метод живёт в отдельном сервисе того же gRPC сервера.
+//
+// Go код в этой папке сгенерирован из этого файла через protoc-gen-go и protoc-gen-go-grpc:
+//   protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative internal/watch/watchpb/user_watch.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: internal/watch/watchpb/user_watch.proto
+
+package watchpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	UserWatchService_WatchUsers_FullMethodName = "/user.watch.v1.UserWatchService/WatchUsers"
+)
+
+// UserWatchServiceClient is the client API for UserWatchService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type UserWatchServiceClient interface {
+	// WatchUsers присылает изменения пользователей, пока клиент не закроет стрим.
+	// Если стрим оборвался, клиент переподключается с last_event_id последнего полученного изменения и получает всё, что пропустил,
+	// пока это есть в буфере сервера, иначе - OUT_OF_RANGE, и клиенту нужно перечитать пользователей и подписаться заново без last_event_id.
+	// Клиент, который не успевает читать, отключается с RESOURCE_EXHAUSTED и так же переподключается с last_event_id.
+	// Буфер изменений есть только у реплики, которая выдала last_event_id, и пропадает при её рестарте, поэтому сервис рассчитан на одну реплику:
+	// с last_event_id от другой реплики или из прошлого запуска клиент получает OUT_OF_RANGE.
+	WatchUsers(ctx context.Context, in *WatchUsersRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[UserChange], error)
+}
+
+type userWatchServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUserWatchServiceClient(cc grpc.ClientConnInterface) UserWatchServiceClient {
+	return &userWatchServiceClient{cc}
+}
+
+func (c *userWatchServiceClient) WatchUsers(ctx context.Context, in *WatchUsersRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[UserChange], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UserWatchService_ServiceDesc.Streams[0], UserWatchService_WatchUsers_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchUsersRequest, UserChange]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserWatchService_WatchUsersClient = grpc.ServerStreamingClient[UserChange]
+
+// UserWatchServiceServer is the server API for UserWatchService service.
+// All implementations must embed UnimplementedUserWatchServiceServer
+// for forward compatibility.
+type UserWatchServiceServer interface {
+	// WatchUsers присылает изменения пользователей, пока клиент не закроет стрим.
+	// Если стрим оборвался, клиент переподключается с last_event_id последнего полученного изменения и получает всё, что пропустил,
+	// пока это есть в буфере сервера, иначе - OUT_OF_RANGE, и клиенту нужно перечитать пользователей и подписаться заново без last_event_id.
+	// Клиент, который не успевает читать, отключается с RESOURCE_EXHAUSTED и так же переподключается с last_event_id.
+	// Буфер изменений есть только у реплики, которая выдала last_event_id, и пропадает при её рестарте, поэтому сервис рассчитан на одну реплику:
+	// с last_event_id от другой реплики или из прошлого запуска клиент получает OUT_OF_RANGE.
+	WatchUsers(*WatchUsersRequest, grpc.ServerStreamingServer[UserChange]) error
+	mustEmbedUnimplementedUserWatchServiceServer()
+}
+
+// UnimplementedUserWatchServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedUserWatchServiceServer struct{}
+
+func (UnimplementedUserWatchServiceServer) WatchUsers(*WatchUsersRequest, grpc.ServerStreamingServer[UserChange]) error {
+	return status.Error(codes.Unimplemented, "method WatchUsers not implemented")
+}
+func (UnimplementedUserWatchServiceServer) mustEmbedUnimplementedUserWatchServiceServer() {}
+func (UnimplementedUserWatchServiceServer) testEmbeddedByValue()                          {}
+
+// UnsafeUserWatchServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UserWatchServiceServer will
+// result in compilation errors.
+type UnsafeUserWatchServiceServer interface {
+	mustEmbedUnimplementedUserWatchServiceServer()
+}
+
+func RegisterUserWatchServiceServer(s grpc.ServiceRegistrar, srv UserWatchServiceServer) {
+	// If the following call panics, it indicates UnimplementedUserWatchServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&UserWatchService_ServiceDesc, srv)
+}
+
+func _UserWatchService_WatchUsers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchUsersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UserWatchServiceServer).WatchUsers(m, &grpc.GenericServerStream[WatchUsersRequest, UserChange]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserWatchService_WatchUsersServer = grpc.ServerStreamingServer[UserChange]
+
+// UserWatchService_ServiceDesc is the grpc.ServiceDesc for UserWatchService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UserWatchService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "user.watch.v1.UserWatchService",
+	HandlerType: (*UserWatchServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchUsers",
+			Handler:       _UserWatchService_WatchUsers_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "internal/watch/watchpb/user_watch.proto",
+}
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE users SET updated_at = created_at;
\ No newline at end of file
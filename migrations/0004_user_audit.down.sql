@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_audit;
+DROP FUNCTION IF EXISTS user_audit_append_only();
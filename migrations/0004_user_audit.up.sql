@@ -0,0 +1,29 @@
+-- журнал изменений пользователей, пишется в той же транзакции, что и изменение
+-- user_id без внешнего ключа: записи остаются после удаления пользователя
+CREATE TABLE user_audit (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    operation TEXT NOT NULL, -- create | update | delete
+    actor TEXT NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    before JSONB, -- NULL для create
+    after JSONB, -- NULL для delete
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX user_audit_user_id_idx ON user_audit (user_id, id DESC);
+
+-- журнал только дописывается: UPDATE, DELETE и TRUNCATE падают с ошибкой
+CREATE FUNCTION user_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'user_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_audit_append_only
+    BEFORE UPDATE OR DELETE ON user_audit
+    FOR EACH ROW EXECUTE FUNCTION user_audit_append_only();
+
+CREATE TRIGGER user_audit_no_truncate
+    BEFORE TRUNCATE ON user_audit
+    FOR EACH STATEMENT EXECUTE FUNCTION user_audit_append_only();